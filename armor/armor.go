@@ -26,9 +26,15 @@ func ArmorWithTypeBuffered(w io.Writer, armorType string) (io.WriteCloser, error
 
 // ArmorWithType armors input with the given armorType.
 func ArmorWithType(input []byte, armorType string) (string, error) {
+	return ArmorWithTypeAndHeaders(input, armorType, internal.ArmorHeaders)
+}
+
+// ArmorWithTypeAndHeaders armors input with the given armorType and headers
+// instead of the default ones. An empty headers map produces no header lines.
+func ArmorWithTypeAndHeaders(input []byte, armorType string, headers map[string]string) (string, error) {
 	var b bytes.Buffer
 
-	w, err := armor.Encode(&b, armorType, internal.ArmorHeaders)
+	w, err := armor.Encode(&b, armorType, headers)
 
 	if err != nil {
 		return "", err
@@ -41,13 +47,34 @@ func ArmorWithType(input []byte, armorType string) (string, error) {
 	return b.String(), nil
 }
 
-// Unarmor unarmors an armored key.
+// Unarmor unarmors an armored key. If the armor checksum doesn't match the
+// contents, the returned error satisfies errors.Is(err, ErrBadChecksum).
 func Unarmor(input string) ([]byte, error) {
 	b, err := internal.Unarmor(input)
 	if err != nil {
 		return nil, err
 	}
-	return ioutil.ReadAll(b.Body)
+	data, err := ioutil.ReadAll(b.Body)
+	if err == armor.ArmorCorrupt {
+		if checksumErr := checkChecksum(input); checksumErr != nil {
+			return nil, checksumErr
+		}
+	}
+	return data, err
+}
+
+// UnarmorReader unarmors the armored data read from r and returns a reader of
+// the unarmored body. The body is decoded as it is read, without buffering the
+// whole input. If the armor checksum doesn't match the contents, reading the
+// body fails with an error that satisfies errors.Is(err, ErrBadChecksum).
+func UnarmorReader(r io.Reader) (io.Reader, error) {
+	body := &checksumReader{crc: crc24Init}
+	b, err := armor.Decode(io.TeeReader(r, body))
+	if err != nil {
+		return nil, err
+	}
+	body.body = b.Body
+	return body, nil
 }
 
 // ReadClearSignedMessage returns the message body from a clearsigned message.
@@ -0,0 +1,150 @@
+package armor
+
+import (
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/gopenpgp/constants"
+	"github.com/stretchr/testify/assert"
+
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+func TestUnarmorBadChecksum(t *testing.T) {
+	armored, err := ArmorWithType([]byte("some binary data"), "PGP MESSAGE")
+	if err != nil {
+		t.Fatal("Expected no error while armoring, got:", err)
+	}
+
+	data, err := Unarmor(armored)
+	if err != nil {
+		t.Fatal("Expected no error while unarmoring, got:", err)
+	}
+	assert.Exactly(t, []byte("some binary data"), data)
+
+	lines := strings.Split(armored, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, "=") {
+			lines[i] = "=AAAA"
+		}
+	}
+
+	_, err = Unarmor(strings.Join(lines, "\n"))
+	assert.True(t, errors.Is(err, ErrBadChecksum))
+	assert.Contains(t, err.Error(), "expected 000000")
+}
+
+func TestUnarmorReaderBadChecksum(t *testing.T) {
+	data := []byte(strings.Repeat("some binary data", 1024))
+	armored, err := ArmorWithType(data, "PGP MESSAGE")
+	if err != nil {
+		t.Fatal("Expected no error while armoring, got:", err)
+	}
+
+	r, err := UnarmorReader(strings.NewReader(armored))
+	if err != nil {
+		t.Fatal("Expected no error while unarmoring, got:", err)
+	}
+	unarmored, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal("Expected no error while reading unarmored data, got:", err)
+	}
+	assert.Exactly(t, data, unarmored)
+
+	lines := strings.Split(armored, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, "=") {
+			lines[i] = "=AAAA"
+		}
+	}
+
+	r, err = UnarmorReader(strings.NewReader(strings.Join(lines, "\n")))
+	if err != nil {
+		t.Fatal("Expected no error while unarmoring, got:", err)
+	}
+	_, err = ioutil.ReadAll(r)
+	assert.True(t, errors.Is(err, ErrBadChecksum))
+	assert.Contains(t, err.Error(), "expected 000000")
+}
+
+func TestArmorWithTypeAndHeaders(t *testing.T) {
+	armored, err := ArmorWithTypeAndHeaders([]byte("some binary data"), "PGP MESSAGE", map[string]string{})
+	if err != nil {
+		t.Fatal("Expected no error while armoring, got:", err)
+	}
+	assert.True(t, strings.HasPrefix(armored, "-----BEGIN PGP MESSAGE-----\n\n"))
+
+	block, err := armor.Decode(strings.NewReader(armored))
+	if err != nil {
+		t.Fatal("Expected no error while decoding, got:", err)
+	}
+	assert.Empty(t, block.Header)
+
+	headers := map[string]string{"Comment": "custom comment"}
+	armored, err = ArmorWithTypeAndHeaders([]byte("some binary data"), "PGP MESSAGE", headers)
+	if err != nil {
+		t.Fatal("Expected no error while armoring, got:", err)
+	}
+	assert.Contains(t, armored, "\nComment: custom comment\n")
+	assert.NotContains(t, armored, "Version:")
+
+	block, err = armor.Decode(strings.NewReader(armored))
+	if err != nil {
+		t.Fatal("Expected no error while decoding, got:", err)
+	}
+	assert.Exactly(t, headers, block.Header)
+
+	data, err := Unarmor(armored)
+	if err != nil {
+		t.Fatal("Expected no error while unarmoring, got:", err)
+	}
+	assert.Exactly(t, []byte("some binary data"), data)
+}
+
+func TestGetArmorType(t *testing.T) {
+	for _, blockType := range []string{
+		constants.PublicKeyHeader, constants.PrivateKeyHeader,
+		constants.PGPMessageHeader, constants.PGPSignatureHeader,
+	} {
+		armored, err := ArmorWithType([]byte{0xc6, 0x00}, blockType)
+		if err != nil {
+			t.Fatal("Expected no error while armoring, got:", err)
+		}
+
+		detected, err := GetArmorType([]byte("\n" + armored))
+		if err != nil {
+			t.Fatal("Expected no error while detecting armor type, got:", err)
+		}
+		assert.Exactly(t, blockType, detected)
+	}
+
+	detected, err := GetArmorType([]byte("-----BEGIN PGP SIGNED MESSAGE-----\nHash: SHA256\n\nhello\n"))
+	if err != nil {
+		t.Fatal("Expected no error while detecting cleartext message, got:", err)
+	}
+	assert.Exactly(t, constants.PGPSignedMessageHeader, detected)
+
+	packets := map[string]string{
+		"\xc6\x01\x04":     constants.PublicKeyHeader,  // New format public key
+		"\x99\x00\x01\x04": constants.PublicKeyHeader,  // Old format public key
+		"\x95\x01\x04":     constants.PrivateKeyHeader, // Old format private key
+		"\xc2\x01\x04":     constants.PGPSignatureHeader,
+		"\x85\x01\x03":     constants.PGPMessageHeader, // Old format session key
+		"\xd2\x01\x01":     constants.PGPMessageHeader, // SEIPD packet
+		"\xa3\x01":         constants.PGPMessageHeader, // Compressed data
+	}
+	for packet, blockType := range packets {
+		detected, err := GetArmorType([]byte(packet))
+		if err != nil {
+			t.Fatal("Expected no error while detecting packet type, got:", err)
+		}
+		assert.Exactly(t, blockType, detected)
+	}
+
+	for _, invalid := range []string{"", " \n", "hello", "\xcd\x00", "-----BEGIN PGP ARMORED FILE-----\n"} {
+		_, err := GetArmorType([]byte(invalid))
+		assert.Error(t, err)
+	}
+}
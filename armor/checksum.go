@@ -0,0 +1,158 @@
+package armor
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+// ErrBadChecksum is returned when the CRC-24 checksum of an armored block
+// doesn't match its contents, which usually means it got corrupted in transit.
+var ErrBadChecksum = errors.New("gopenpgp: armor checksum mismatch")
+
+// checksumError carries the expected and actual checksums of a corrupted block.
+type checksumError struct {
+	expected, actual uint32
+}
+
+func (e *checksumError) Error() string {
+	return fmt.Sprintf("%v: expected %06x, got %06x", ErrBadChecksum, e.expected, e.actual)
+}
+
+// Unwrap makes errors.Is(err, ErrBadChecksum) hold for checksum errors.
+func (e *checksumError) Unwrap() error {
+	return ErrBadChecksum
+}
+
+const (
+	crc24Init = 0xb704ce
+	crc24Poly = 0x1864cfb
+	crc24Mask = 0xffffff
+)
+
+// crc24 calculates the OpenPGP checksum as specified in RFC 4880, section 6.1.
+func crc24(d []byte) uint32 {
+	return crc24Update(crc24Init, d) & crc24Mask
+}
+
+// crc24Update adds d to the unmasked checksum crc.
+func crc24Update(crc uint32, d []byte) uint32 {
+	for _, b := range d {
+		crc ^= uint32(b) << 16
+		for i := 0; i < 8; i++ {
+			crc <<= 1
+			if crc&0x1000000 != 0 {
+				crc ^= crc24Poly
+			}
+		}
+	}
+	return crc
+}
+
+// checkChecksum recomputes the checksum of an armored block. It returns a
+// checksum error if the block is well-formed but its checksum doesn't match,
+// and nil otherwise.
+func checkChecksum(input string) error {
+	lines := strings.Split(input, "\n")
+
+	i := 0
+	for i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "-----BEGIN ") {
+		i++
+	}
+	// Skip the armor headers, which end with an empty line
+	for i++; i < len(lines) && strings.TrimSpace(lines[i]) != ""; i++ {
+	}
+
+	var body strings.Builder
+	var checksum string
+	for i++; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(line, "=") {
+			checksum = line[1:]
+			break
+		}
+		if strings.HasPrefix(line, "-----END ") {
+			break
+		}
+		body.WriteString(line)
+	}
+
+	expected, ok := parseChecksum(checksum)
+	if !ok {
+		return nil
+	}
+	data, err := base64.StdEncoding.DecodeString(body.String())
+	if err != nil {
+		return nil
+	}
+
+	if actual := crc24(data); actual != expected {
+		return &checksumError{expected: expected, actual: actual}
+	}
+	return nil
+}
+
+// parseChecksum decodes the base64 checksum of an armored block, without its
+// leading "=".
+func parseChecksum(checksum string) (uint32, bool) {
+	expectedBytes, err := base64.StdEncoding.DecodeString(checksum)
+	if err != nil || len(expectedBytes) != 3 {
+		return 0, false
+	}
+	return uint32(expectedBytes[0])<<16 | uint32(expectedBytes[1])<<8 | uint32(expectedBytes[2]), true
+}
+
+// maxChecksumTail is the size of the end of the armored input kept by
+// checksumReader to find the checksum line. It covers the read-ahead of the
+// armor decoder past the end line.
+const maxChecksumTail = 8192
+
+// checksumReader reads the body of an armored block decoded as it is read,
+// and turns the armor error of a checksum mismatch into a checksum error, as
+// Unarmor does.
+type checksumReader struct {
+	body io.Reader
+	tail []byte
+	crc  uint32
+}
+
+// Write keeps the end of the armored input read by the armor decoder.
+func (r *checksumReader) Write(b []byte) (int, error) {
+	r.tail = append(r.tail, b...)
+	if len(r.tail) > maxChecksumTail {
+		r.tail = append(r.tail[:0], r.tail[len(r.tail)-maxChecksumTail:]...)
+	}
+	return len(b), nil
+}
+
+func (r *checksumReader) Read(b []byte) (n int, err error) {
+	n, err = r.body.Read(b)
+	r.crc = crc24Update(r.crc, b[:n])
+	if err == armor.ArmorCorrupt {
+		if expected, ok := r.findChecksum(); ok {
+			if actual := r.crc & crc24Mask; actual != expected {
+				err = &checksumError{expected: expected, actual: actual}
+			}
+		}
+	}
+	return
+}
+
+// findChecksum returns the checksum of the line preceding the end line.
+func (r *checksumReader) findChecksum() (uint32, bool) {
+	lines := strings.Split(string(r.tail), "\n")
+	for i := len(lines) - 1; i > 0; i-- {
+		if strings.HasPrefix(strings.TrimSpace(lines[i]), "-----END ") {
+			line := strings.TrimSpace(lines[i-1])
+			if !strings.HasPrefix(line, "=") {
+				return 0, false
+			}
+			return parseChecksum(line[1:])
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,77 @@
+package armor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ProtonMail/gopenpgp/constants"
+)
+
+const armorBegin = "-----BEGIN "
+
+// GetArmorType classifies armored or binary OpenPGP data without parsing it.
+// It returns the armor block type the data is or would be armored with: one of
+// constants.PublicKeyHeader, PrivateKeyHeader, PGPMessageHeader,
+// PGPSignatureHeader or PGPSignedMessageHeader for cleartext-signed messages.
+func GetArmorType(b []byte) (string, error) {
+	trimmed := bytes.TrimLeft(b, " \t\r\n")
+	if len(trimmed) == 0 {
+		return "", errors.New("gopenpgp: cannot detect type of empty data")
+	}
+
+	if bytes.HasPrefix(trimmed, []byte(armorBegin)) {
+		return getArmorHeaderType(trimmed)
+	}
+	return getPacketType(trimmed)
+}
+
+// getArmorHeaderType reads the block type from the armor header line.
+func getArmorHeaderType(b []byte) (string, error) {
+	line := b[len(armorBegin):]
+	end := bytes.Index(line, []byte("-----"))
+	if end < 0 {
+		return "", errors.New("gopenpgp: malformed armor header")
+	}
+
+	blockType := string(line[:end])
+	switch blockType {
+	case constants.PublicKeyHeader, constants.PrivateKeyHeader, constants.PGPMessageHeader,
+		constants.PGPSignatureHeader, constants.PGPSignedMessageHeader:
+		return blockType, nil
+	}
+	// PGP/MIME style multipart messages, RFC 4880 section 6.2
+	if strings.HasPrefix(blockType, constants.PGPMessageHeader+", PART ") {
+		return constants.PGPMessageHeader, nil
+	}
+	return "", fmt.Errorf("gopenpgp: unknown armor type %q", blockType)
+}
+
+// getPacketType classifies binary data by the tag of its first packet,
+// RFC 4880 section 4.2.
+func getPacketType(b []byte) (string, error) {
+	if b[0]&0x80 == 0 {
+		return "", errors.New("gopenpgp: data is neither armored nor an OpenPGP packet")
+	}
+
+	var tag byte
+	if b[0]&0x40 != 0 {
+		tag = b[0] & 0x3f
+	} else {
+		tag = (b[0] & 0x3c) >> 2
+	}
+
+	switch tag {
+	case 6:
+		return constants.PublicKeyHeader, nil
+	case 5:
+		return constants.PrivateKeyHeader, nil
+	case 2:
+		return constants.PGPSignatureHeader, nil
+	case 1, 3, 4, 8, 9, 11, 18, 20:
+		return constants.PGPMessageHeader, nil
+	default:
+		return "", fmt.Errorf("gopenpgp: cannot detect type of data starting with packet tag %d", tag)
+	}
+}
@@ -0,0 +1,15 @@
+package constants
+
+// Compression algorithm names.
+const (
+	CompressionNone = "none"
+	CompressionZIP  = "zip"
+	CompressionZLIB = "zlib"
+)
+
+// Compression levels, see compress/flate.
+const (
+	DefaultCompressionLevel = -1
+	BestSpeed               = 1
+	BestCompression         = 9
+)
@@ -0,0 +1,17 @@
+package constants
+
+// Error codes of crypto.CryptoError. They are stable and can be mapped to
+// enums by the bindings.
+const (
+	ErrorCodeUnknown         = 0
+	ErrorCodeWrongPassphrase = 1
+	ErrorCodeKeyExpired      = 2
+	ErrorCodeKeyRevoked      = 3
+	ErrorCodeBadSignature    = 4
+	ErrorCodeNotSigned       = 5
+	ErrorCodeNoDecryptionKey = 6
+	ErrorCodeWeakKey         = 7
+	ErrorCodeNotProtected    = 8
+	ErrorCodeMalformedInput  = 9
+	ErrorCodeLimitExceeded   = 10
+)
@@ -0,0 +1,12 @@
+package constants
+
+// Hash algorithm names.
+const (
+	MD5       = "md5"
+	SHA1      = "sha1"
+	RIPEMD160 = "ripemd160"
+	SHA224    = "sha224"
+	SHA256    = "sha256"
+	SHA384    = "sha384"
+	SHA512    = "sha512"
+)
@@ -0,0 +1,9 @@
+package constants
+
+// Reasons for revocation, see RFC 4880, section 5.2.3.23.
+const (
+	RevocationReasonNoReason       = 0
+	RevocationReasonKeySuperseded  = 1
+	RevocationReasonKeyCompromised = 2
+	RevocationReasonKeyRetired     = 3
+)
@@ -0,0 +1,51 @@
+package crypto
+
+import (
+	"sort"
+
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// CipherInfo describes a symmetric cipher supported for session keys.
+type CipherInfo struct {
+	// Name is the name of the cipher, e.g. constants.AES256.
+	Name string
+	// CipherFunction is the OpenPGP identifier of the cipher.
+	CipherFunction packet.CipherFunction
+	// KeySize is the size of its keys in bytes.
+	KeySize int
+}
+
+// SupportedSymmetricCiphers returns the ciphers accepted as SymmetricKey.Algo,
+// sorted by name. constants.ThreeDES and constants.TripleDES are both listed,
+// they name the same cipher.
+func SupportedSymmetricCiphers() []CipherInfo {
+	ciphers := make([]CipherInfo, 0, len(symKeyAlgos))
+	for name, cf := range symKeyAlgos {
+		ciphers = append(ciphers, CipherInfo{Name: name, CipherFunction: cf, KeySize: cf.KeySize()})
+	}
+	sort.Slice(ciphers, func(i, j int) bool { return ciphers[i].Name < ciphers[j].Name })
+	return ciphers
+}
+
+// SupportedHashAlgorithms returns the names of the hash algorithms accepted by
+// SetSignatureHash and S2KOptions, sorted.
+func SupportedHashAlgorithms() []string {
+	names := make([]string, 0, len(signatureHashes))
+	for name := range signatureHashes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SupportedCompressionAlgorithms returns the names of the compression
+// algorithms accepted by EncryptMessageWithCompression and the like, sorted.
+func SupportedCompressionAlgorithms() []string {
+	names := make([]string, 0, len(compressionAlgos))
+	for name := range compressionAlgos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
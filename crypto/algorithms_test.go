@@ -0,0 +1,28 @@
+package crypto
+
+import (
+	"testing"
+
+	"github.com/ProtonMail/gopenpgp/constants"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+func TestSupportedAlgorithms(t *testing.T) {
+	assert.Exactly(t, []CipherInfo{
+		{Name: constants.ThreeDES, CipherFunction: packet.Cipher3DES, KeySize: 24},
+		{Name: constants.AES128, CipherFunction: packet.CipherAES128, KeySize: 16},
+		{Name: constants.AES192, CipherFunction: packet.CipherAES192, KeySize: 24},
+		{Name: constants.AES256, CipherFunction: packet.CipherAES256, KeySize: 32},
+		{Name: constants.CAST5, CipherFunction: packet.CipherCAST5, KeySize: 16},
+		{Name: constants.TripleDES, CipherFunction: packet.Cipher3DES, KeySize: 24},
+	}, SupportedSymmetricCiphers())
+
+	assert.Exactly(t, []string{
+		constants.SHA1, constants.SHA224, constants.SHA256, constants.SHA384, constants.SHA512,
+	}, SupportedHashAlgorithms())
+
+	assert.Exactly(t, []string{
+		constants.CompressionNone, constants.CompressionZIP, constants.CompressionZLIB,
+	}, SupportedCompressionAlgorithms())
+}
@@ -0,0 +1,63 @@
+package crypto
+
+import (
+	"errors"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// minArgon2SaltSize is the minimum salt size accepted by
+// DeriveHardenedPassphrase, as recommended by RFC 9106.
+const minArgon2SaltSize = 16
+
+// Argon2Params are the cost parameters of Argon2id. They must be stored with
+// the salt, to derive the same passphrase again.
+type Argon2Params struct {
+	// Time is the number of passes over the memory.
+	Time int
+	// Memory is the memory size in KiB.
+	Memory int
+	// Threads is the number of lanes, between 1 and 255.
+	Threads int
+	// KeyLength is the size of the derived passphrase in bytes.
+	KeyLength int
+}
+
+// DefaultArgon2Params returns the second recommended Argon2id parameters of
+// RFC 9106: 3 passes over 64 MiB with 4 lanes, deriving 32 bytes.
+func DefaultArgon2Params() *Argon2Params {
+	return &Argon2Params{Time: 3, Memory: 64 * 1024, Threads: 4, KeyLength: 32}
+}
+
+// DeriveHardenedPassphrase stretches password with Argon2id, which is much more
+// costly to attack with GPUs than the S2K of OpenPGP. salt must be random, at
+// least 16 bytes long, and stored with params alongside the message.
+//
+// The result is binary. To use it as the password of e.g.
+// SymmetricKeyPacketWithPassword or EncryptMessageWithPassword, encode it first,
+// for instance with base64.StdEncoding.EncodeToString. The OpenPGP S2K is still
+// applied on top of it.
+func DeriveHardenedPassphrase(password, salt []byte, params *Argon2Params) ([]byte, error) {
+	if len(password) == 0 {
+		return nil, errors.New("gopenpgp: password can't be empty")
+	}
+	if len(salt) < minArgon2SaltSize {
+		return nil, errors.New("gopenpgp: Argon2 salt must be at least 16 bytes long")
+	}
+	if params.Time < 1 {
+		return nil, errors.New("gopenpgp: Argon2 time must be at least 1")
+	}
+	if params.Threads < 1 || params.Threads > 255 {
+		return nil, errors.New("gopenpgp: Argon2 threads must be between 1 and 255")
+	}
+	if params.Memory < 8*params.Threads {
+		return nil, errors.New("gopenpgp: Argon2 memory must be at least 8 KiB per thread")
+	}
+	if params.KeyLength < 16 {
+		return nil, errors.New("gopenpgp: Argon2 key length must be at least 16 bytes")
+	}
+
+	return argon2.IDKey(
+		password, salt, uint32(params.Time), uint32(params.Memory), uint8(params.Threads), uint32(params.KeyLength),
+	), nil
+}
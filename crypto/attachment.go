@@ -2,6 +2,7 @@ package crypto
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -24,26 +25,39 @@ type AttachmentProcessor struct {
 	split            *models.EncryptedSplit
 	garbageCollector int
 	err              error
+	splitErr         error
 }
 
-// Process writes attachment data to be encrypted
+// Process writes a chunk of attachment data to be encrypted. Chunks can have
+// any size and are all encrypted with the same session key. If encryption
+// fails, the remaining chunks are ignored and Finish returns the error.
 func (ap *AttachmentProcessor) Process(plainData []byte) {
+	if ap.err != nil {
+		return
+	}
 	if _, err := (*ap.w).Write(plainData); err != nil {
-		panic(err)
+		ap.err = err
 	}
 }
 
-// Finish closes the attachment and returns the encrypted data
+// Finish closes the attachment, flushing the integrity protection, and returns
+// its session key packet and encrypted data packet.
 func (ap *AttachmentProcessor) Finish() (*models.EncryptedSplit, error) {
-	if ap.err != nil {
-		return nil, ap.err
-	}
-	(*ap.w).Close()
+	closeErr := (*ap.w).Close()
 	(*ap.pipe).Close()
 	ap.done.Wait()
 	if ap.garbageCollector > 0 {
 		runtime.GC()
 	}
+	if ap.splitErr != nil {
+		return nil, ap.splitErr
+	}
+	if ap.err != nil {
+		return nil, ap.err
+	}
+	if closeErr != nil {
+		return nil, closeErr
+	}
 	return ap.split, nil
 }
 
@@ -62,25 +76,32 @@ func (pgp *GopenPGP) encryptAttachment(
 	}
 
 	config := &packet.Config{
-		DefaultCipher: packet.CipherAES256,
+		DefaultCipher: pgp.getRecipientsCipher(publicKey.entities),
 		Time:          pgp.getTimeGenerator(),
 	}
+	algo, err := getAlgo(config.DefaultCipher)
+	if err != nil {
+		return nil, err
+	}
 
 	reader, writer := io.Pipe()
 
 	go func() {
 		defer attachmentProc.done.Done()
 		split, splitError := SeparateKeyAndData(nil, reader, estimatedSize, garbageCollector)
-		if attachmentProc.err != nil {
-			attachmentProc.err = splitError
+		if splitError != nil {
+			attachmentProc.splitErr = splitError
+			// Unblock the writer, the rest of the stream is ignored
+			reader.CloseWithError(splitError)
+			return
 		}
-		split.Algo = constants.AES256
+		split.Algo = algo
 		attachmentProc.split = split
 	}()
 
 	var ew io.WriteCloser
 	var encryptErr error
-	ew, encryptErr = openpgp.Encrypt(writer, publicKey.entities, nil, hints, config)
+	ew, encryptErr = encryptWithConfig(writer, publicKey.entities, nil, hints, config, false)
 	if encryptErr != nil {
 		return nil, encryptErr
 	}
@@ -90,20 +111,24 @@ func (pgp *GopenPGP) encryptAttachment(
 	return attachmentProc, nil
 }
 
-// EncryptAttachment encrypts a file. fileName
+// EncryptAttachment encrypts a file with a fresh session key and returns its
+// session key packet and encrypted data packet separately. fileName is stored
+// in the literal data packet. The data packet can be stored once, while the key
+// packet is re-encrypted for other recipients with GetSessionFromKeyPacket and
+// KeyPacketWithPublicKey, without touching the data.
 func (pgp *GopenPGP) EncryptAttachment(
 	plainData []byte, fileName string, publicKey *KeyRing,
-) (*models.EncryptedSplit, error) {
+) (keyPacket []byte, dataPacket []byte, err error) {
 	ap, err := pgp.encryptAttachment(len(plainData), fileName, publicKey, -1)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	ap.Process(plainData)
 	split, err := ap.Finish()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	return split, nil
+	return split.KeyPacket, split.DataPacket, nil
 }
 
 // EncryptAttachmentLowMemory creates an AttachmentProcessor which can be used
@@ -131,16 +156,91 @@ func SplitArmor(encrypted string) (*models.EncryptedSplit, error) {
 	return SeparateKeyAndData(nil, encryptedReader, len(encrypted), -1)
 }
 
+// SplitMessage splits an armored message into its session key packets and its
+// encrypted data packet. Both public-key and symmetrically encrypted session
+// key packets are returned, concatenated in the order they appear, so that the
+// data packet can be stored once and the key packets re-wrapped per recipient.
+func SplitMessage(armored string) (keyPacket []byte, dataPacket []byte, err error) {
+	encryptedRaw, err := armorUtils.Unarmor(armored)
+	if err != nil {
+		return nil, nil, err
+	}
+	return splitPackets(encryptedRaw)
+}
+
+// JoinMessage is the inverse of SplitMessage. It concatenates the session key
+// packets and the encrypted data packet into an armored message, checking that
+// the result is a single well-formed encrypted message.
+func JoinMessage(keyPacket, dataPacket []byte) (string, error) {
+	op, err := packet.NewOpaqueReader(bytes.NewReader(keyPacket)).Next()
+	if err != nil {
+		return "", fmt.Errorf("gopenpgp: cannot read key packet: %v", err)
+	}
+	if op.Tag != encryptedKeyTag && op.Tag != symmetricKeyEncryptedTag {
+		return "", fmt.Errorf("gopenpgp: key packet has tag %d, not a session key packet", op.Tag)
+	}
+
+	joined := append(append([]byte{}, keyPacket...), dataPacket...)
+	if _, _, err = splitPackets(joined); err != nil {
+		return "", err
+	}
+	return armorUtils.ArmorWithType(joined, constants.PGPMessageHeader)
+}
+
+// splitPackets splits a binary encrypted message into its session key packets
+// and its encrypted data packet, see SplitMessage.
+func splitPackets(encryptedRaw []byte) (keyPacket []byte, dataPacket []byte, err error) {
+	var keyPackets, dataPackets bytes.Buffer
+	packets := packet.NewOpaqueReader(bytes.NewReader(encryptedRaw))
+	for {
+		op, err := packets.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("gopenpgp: cannot read message packets: %v", err)
+		}
+
+		switch op.Tag {
+		case encryptedKeyTag, symmetricKeyEncryptedTag:
+			if dataPackets.Len() != 0 {
+				return nil, nil, errors.New("gopenpgp: session key packet after encrypted data packet")
+			}
+			err = op.Serialize(&keyPackets)
+		case symmetricallyEncryptedTag, symmetricallyEncryptedMDCTag, aeadEncryptedTag:
+			if dataPackets.Len() != 0 {
+				return nil, nil, errors.New("gopenpgp: message contains more than one encrypted data packet")
+			}
+			err = op.Serialize(&dataPackets)
+		default:
+			return nil, nil, fmt.Errorf("gopenpgp: unexpected packet with tag %d in encrypted message", op.Tag)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if keyPackets.Len() == 0 {
+		return nil, nil, errors.New("gopenpgp: packets don't include a session key packet")
+	}
+	if dataPackets.Len() == 0 {
+		return nil, nil, errors.New("gopenpgp: packets don't include an encrypted data packet")
+	}
+	return keyPackets.Bytes(), dataPackets.Bytes(), nil
+}
+
 // DecryptAttachment takes a session key packet and symmetrically encrypted data
-// packet. privateKeys is a KeyRing that can contain multiple keys. The
-// passphrase is used to unlock keys in privateKeys.
+// packet, as returned by EncryptAttachment or SplitMessage. kr is a KeyRing that
+// can contain multiple keys. The passphrase is used to unlock keys in kr.
 func (pgp *GopenPGP) DecryptAttachment(
 	keyPacket, dataPacket []byte,
-	kr *KeyRing, passphrase string,
-) ([]byte, error) {
+	kr *KeyRing, passphrase []byte,
+) (plainData []byte, err error) {
+	defer recoverMalformedInput(&err)
+
 	privKeyEntries := kr.entities
 
-	if err := kr.Unlock([]byte(passphrase)); err != nil {
+	if err := kr.Unlock(passphrase); err != nil {
 		err = fmt.Errorf("gopenpgp: cannot decrypt attachment: %v", err)
 		return nil, err
 	}
@@ -154,10 +254,16 @@ func (pgp *GopenPGP) DecryptAttachment(
 
 	md, err := openpgp.ReadMessage(encryptedReader, privKeyEntries, nil, config)
 	if err != nil {
-		return nil, err
+		if isAEADEncrypted(bytes.NewReader(dataPacket)) {
+			return nil, errAEADDataUnsupported
+		}
+		if isUnprotected(bytes.NewReader(dataPacket)) {
+			return nil, ErrMessageNotProtected
+		}
+		return nil, convertReadMessageError(err)
 	}
 
-	decrypted := md.UnverifiedBody
+	decrypted := pgp.limitDecompressedSize(md.UnverifiedBody)
 	b, err := ioutil.ReadAll(decrypted)
 	if err != nil {
 		return nil, err
@@ -1,7 +1,10 @@
 package crypto
 
 import (
+	"bytes"
 	"encoding/base64"
+	"errors"
+	"io"
 	"strings"
 	"testing"
 
@@ -52,15 +55,223 @@ func TestAttachmentSetKey(t *testing.T) {
 func TestAttachnentEncryptDecrypt(t *testing.T) {
 	var testAttachmentCleartext = "cc,\ndille."
 
-	encSplit, err := pgp.EncryptAttachment([]byte(testAttachmentCleartext), "s.txt", testPrivateKeyRing)
+	keyPacket, dataPacket, err := pgp.EncryptAttachment([]byte(testAttachmentCleartext), "s.txt", testPrivateKeyRing)
 	if err != nil {
 		t.Fatal("Expected no error while encrypting attachment, got:", err)
 	}
 
-	redecData, err := pgp.DecryptAttachment(encSplit.KeyPacket, encSplit.DataPacket, testPrivateKeyRing, "")
+	redecData, err := pgp.DecryptAttachment(keyPacket, dataPacket, testPrivateKeyRing, nil)
 	if err != nil {
 		t.Fatal("Expected no error while decrypting attachment, got:", err)
 	}
 
 	assert.Exactly(t, testAttachmentCleartext, string(redecData))
 }
+
+func TestAttachmentProcessorChunks(t *testing.T) {
+	var testAttachmentCleartext = strings.Repeat("cc,\ndille. ", 10000)
+
+	ap, err := pgp.EncryptAttachmentLowMemory(len(testAttachmentCleartext), "s.txt", testPublicKeyRing)
+	if err != nil {
+		t.Fatal("Expected no error while creating attachment processor, got:", err)
+	}
+	for i := 0; i < len(testAttachmentCleartext); i += 4096 {
+		end := i + 4096
+		if end > len(testAttachmentCleartext) {
+			end = len(testAttachmentCleartext)
+		}
+		ap.Process([]byte(testAttachmentCleartext[i:end]))
+	}
+	encSplit, err := ap.Finish()
+	if err != nil {
+		t.Fatal("Expected no error while finishing attachment, got:", err)
+	}
+
+	redecData, err := pgp.DecryptAttachment(encSplit.KeyPacket, encSplit.DataPacket, testPrivateKeyRing, []byte(testMailboxPassword))
+	if err != nil {
+		t.Fatal("Expected no error while decrypting attachment, got:", err)
+	}
+	assert.Exactly(t, testAttachmentCleartext, string(redecData))
+}
+
+// failingWriteCloser fails to write with writeErr and to close with closeErr.
+type failingWriteCloser struct {
+	writeErr, closeErr error
+}
+
+func (w failingWriteCloser) Write(b []byte) (int, error) {
+	if w.writeErr != nil {
+		return 0, w.writeErr
+	}
+	return len(b), nil
+}
+
+func (w failingWriteCloser) Close() error {
+	return w.closeErr
+}
+
+func TestAttachmentProcessorErrors(t *testing.T) {
+	writeErr := errors.New("write error")
+	var w io.WriteCloser = failingWriteCloser{writeErr: writeErr, closeErr: errors.New("close error")}
+	_, pipe := io.Pipe()
+	ap := &AttachmentProcessor{w: &w, pipe: pipe}
+	ap.Process([]byte("plain text"))
+	ap.Process([]byte("ignored plain text"))
+	split, err := ap.Finish()
+	assert.Nil(t, split)
+	assert.Exactly(t, writeErr, err)
+
+	closeErr := errors.New("close error")
+	w = failingWriteCloser{closeErr: closeErr}
+	_, pipe = io.Pipe()
+	ap = &AttachmentProcessor{w: &w, pipe: pipe}
+	ap.Process([]byte("plain text"))
+	split, err = ap.Finish()
+	assert.Nil(t, split)
+	assert.Exactly(t, closeErr, err)
+
+	// The data packet can't be read once the pipe fails
+	ap, err = pgp.EncryptAttachmentLowMemory(10, "s.txt", testPublicKeyRing)
+	if err != nil {
+		t.Fatal("Expected no error while creating attachment processor, got:", err)
+	}
+	ap.pipe.CloseWithError(errors.New("read error"))
+	ap.Process([]byte("plain text"))
+	split, err = ap.Finish()
+	assert.Nil(t, split)
+	assert.Error(t, err)
+}
+
+func TestAttachmentReencryptKeyPacket(t *testing.T) {
+	var testAttachmentCleartext = "cc,\ndille."
+
+	keyPacket, dataPacket, err := pgp.EncryptAttachment([]byte(testAttachmentCleartext), "s.txt", testPublicKeyRing)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting attachment, got:", err)
+	}
+
+	sessionKey, err := pgp.GetSessionFromKeyPacket(keyPacket, testPrivateKeyRing, testMailboxPassword)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting attachment key packet, got:", err)
+	}
+
+	recipientKey := generateTestKey(t, "recipient")
+	recipientPublicKey, err := pgp.GetPublicKeyFromPrivate(recipientKey)
+	if err != nil {
+		t.Fatal("Expected no error while extracting public key, got:", err)
+	}
+	recipientKeyRing, err := ReadArmoredKeyRing(strings.NewReader(recipientKey))
+	if err != nil {
+		t.Fatal("Expected no error while reading private key, got:", err)
+	}
+
+	recipientKeyPacket, err := pgp.KeyPacketWithPublicKey(sessionKey, recipientPublicKey)
+	if err != nil {
+		t.Fatal("Expected no error while re-encrypting attachment key packet, got:", err)
+	}
+
+	redecData, err := pgp.DecryptAttachment(recipientKeyPacket, dataPacket, recipientKeyRing, []byte("recipient"))
+	if err != nil {
+		t.Fatal("Expected no error while decrypting re-encrypted attachment, got:", err)
+	}
+	assert.Exactly(t, testAttachmentCleartext, string(redecData))
+
+	_, err = pgp.DecryptAttachment(recipientKeyPacket, dataPacket, testPrivateKeyRing, []byte(testMailboxPassword))
+	assert.Error(t, err)
+}
+
+func TestAttachmentTruncated(t *testing.T) {
+	// Large enough to be written with partial packet lengths
+	plainData := bytes.Repeat([]byte("cc,\ndille. "), 10000)
+	keyPacket, dataPacket, err := pgp.EncryptAttachment(plainData, "s.txt", testPublicKeyRing)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting attachment, got:", err)
+	}
+
+	truncated := append(append([]byte{}, keyPacket...), dataPacket[:len(dataPacket)/2]...)
+	_, err = SeparateKeyAndData(nil, bytes.NewReader(truncated), len(truncated), -1)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "gopenpgp: cannot read encrypted data packet")
+
+	_, err = SeparateKeyAndData(nil, bytes.NewReader(keyPacket[:len(keyPacket)/2]), len(keyPacket), -1)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "gopenpgp: cannot read message packets")
+
+	_, err = pgp.DecryptAttachment(keyPacket, dataPacket[:len(dataPacket)/2], testPrivateKeyRing, []byte(testMailboxPassword))
+	assert.Error(t, err)
+}
+
+func TestSplitMessage(t *testing.T) {
+	var message = "Hello!\nThis message is split."
+
+	armored, err := pgp.EncryptMessage(message, testPublicKeyRing, nil, "", false)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting message, got:", err)
+	}
+
+	keyPacket, dataPacket, err := SplitMessage(armored)
+	if err != nil {
+		t.Fatal("Expected no error while splitting message, got:", err)
+	}
+
+	decrypted, err := pgp.DecryptAttachment(keyPacket, dataPacket, testPrivateKeyRing, nil)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting split message, got:", err)
+	}
+	assert.Exactly(t, message, string(decrypted))
+
+	armored, err = pgp.EncryptMessageWithPassword(message, "pass")
+	if err != nil {
+		t.Fatal("Expected no error while encrypting message with password, got:", err)
+	}
+
+	keyPacket, dataPacket, err = SplitMessage(armored)
+	if err != nil {
+		t.Fatal("Expected no error while splitting message, got:", err)
+	}
+
+	sessionKey, err := pgp.GetSessionFromSymmetricPacket(keyPacket, "pass")
+	if err != nil {
+		t.Fatal("Expected no error while decrypting session key, got:", err)
+	}
+	assert.NotEmpty(t, sessionKey.Key)
+	assert.NotEmpty(t, dataPacket)
+
+	signature, err := testPrivateKeyRing.SignDetachedArmored([]byte(message))
+	if err != nil {
+		t.Fatal("Expected no error while signing, got:", err)
+	}
+	_, _, err = SplitMessage(signature)
+	assert.EqualError(t, err, "gopenpgp: unexpected packet with tag 2 in encrypted message")
+}
+
+func TestJoinMessage(t *testing.T) {
+	var message = "Hello!\nThis message is joined."
+
+	armored, err := pgp.EncryptMessage(message, testPublicKeyRing, nil, "", false)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting message, got:", err)
+	}
+
+	keyPacket, dataPacket, err := SplitMessage(armored)
+	if err != nil {
+		t.Fatal("Expected no error while splitting message, got:", err)
+	}
+
+	joined, err := JoinMessage(keyPacket, dataPacket)
+	if err != nil {
+		t.Fatal("Expected no error while joining message, got:", err)
+	}
+
+	decrypted, err := pgp.DecryptMessage(joined, testPrivateKeyRing, "")
+	if err != nil {
+		t.Fatal("Expected no error while decrypting joined message, got:", err)
+	}
+	assert.Exactly(t, message, decrypted)
+
+	_, err = JoinMessage(dataPacket, keyPacket)
+	assert.EqualError(t, err, "gopenpgp: key packet has tag 18, not a session key packet")
+
+	_, err = JoinMessage(keyPacket, keyPacket)
+	assert.EqualError(t, err, "gopenpgp: packets don't include an encrypted data packet")
+}
@@ -1,8 +1,16 @@
 package crypto
 
 import (
+	"bytes"
 	"io/ioutil"
 	"strings"
+	"testing"
+
+	"github.com/ProtonMail/gopenpgp/armor"
+	"github.com/ProtonMail/gopenpgp/constants"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
 )
 
 var err error
@@ -17,3 +25,46 @@ func readTestFile(name string, trimNewlines bool) string {
 	}
 	return string(data)
 }
+
+// generateTestEntity generates an unencrypted 1024-bit RSA key for the user ID
+// "userName <email>".
+func generateTestEntity(t *testing.T, userName, email string) *openpgp.Entity {
+	entity, err := openpgp.NewEntity(userName, "", email, &packet.Config{RSABits: 1024})
+	if err != nil {
+		t.Fatal("Expected no error while generating key, got:", err)
+	}
+	return entity
+}
+
+// generateTestKey generates an armored 1024-bit RSA private key for
+// user@example.com, with user as its passphrase.
+func generateTestKey(t *testing.T, user string) string {
+	key, err := pgp.GenerateKey(user, "example.com", user, "rsa", 1024)
+	if err != nil {
+		t.Fatal("Expected no error while generating key, got:", err)
+	}
+	return key
+}
+
+// revokeTestEntity returns a key revocation signature of the unencrypted
+// entity, made by its primary key.
+func revokeTestEntity(t *testing.T, entity *openpgp.Entity) *packet.Signature {
+	kr := &KeyRing{entities: openpgp.EntityList{entity}}
+	certificate, err := pgp.GenerateRevocationCertificate(kr, nil, constants.RevocationReasonKeyRetired, "")
+	if err != nil {
+		t.Fatal("Expected no error while generating revocation certificate, got:", err)
+	}
+	rawCertificate, err := armor.Unarmor(certificate)
+	if err != nil {
+		t.Fatal("Expected no error while unarmoring certificate, got:", err)
+	}
+	p, err := packet.Read(bytes.NewReader(rawCertificate))
+	if err != nil {
+		t.Fatal("Expected no error while reading certificate, got:", err)
+	}
+	sig, ok := p.(*packet.Signature)
+	if !ok {
+		t.Fatal("Expected a signature packet")
+	}
+	return sig
+}
@@ -0,0 +1,287 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/ProtonMail/gopenpgp/armor"
+	"github.com/ProtonMail/gopenpgp/constants"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// CleanKey normalizes the armored public key, so that two copies of the same
+// key produce the same output: superseded self-signatures and duplicate
+// signatures and subkeys are dropped, and user IDs, signatures and subkeys are
+// serialized in a fixed order. Keys are sorted by fingerprint. Private keys
+// are rejected.
+func (pgp *GopenPGP) CleanKey(armoredKey string) (string, error) {
+	kr, err := pgp.BuildKeyRingArmored(armoredKey)
+	if err != nil {
+		return "", err
+	}
+
+	entities := kr.entities
+	sort.Slice(entities, func(i, j int) bool {
+		return bytes.Compare(entities[i].PrimaryKey.Fingerprint[:], entities[j].PrimaryKey.Fingerprint[:]) < 0
+	})
+
+	var b bytes.Buffer
+	for _, e := range entities {
+		if e.PrivateKey != nil {
+			return "", errors.New("gopenpgp: cannot clean private key")
+		}
+		if err := serializeCleanEntity(&b, e); err != nil {
+			return "", err
+		}
+	}
+
+	return armorCleanKey(b.Bytes())
+}
+
+// armorCleanKey armors a cleaned public key without armor headers, which
+// armor.ArmorKey writes in map order, so that the output is byte-identical.
+func armorCleanKey(key []byte) (string, error) {
+	return armor.ArmorWithTypeAndHeaders(key, constants.PublicKeyHeader, nil)
+}
+
+// MergeKeys merges two copies a and b of the same armored public key, for
+// instance fetched from different sources. The result contains the union of
+// their user IDs, subkeys and signatures, without duplicates, cleaned like
+// CleanKey does. An error is returned if a and b aren't the same key.
+func (pgp *GopenPGP) MergeKeys(a, b string) (string, error) {
+	entityA, err := pgp.readSinglePublicEntity(a)
+	if err != nil {
+		return "", err
+	}
+	entityB, err := pgp.readSinglePublicEntity(b)
+	if err != nil {
+		return "", err
+	}
+
+	if entityA.PrimaryKey.Fingerprint != entityB.PrimaryKey.Fingerprint {
+		return "", fmt.Errorf(
+			"gopenpgp: cannot merge different keys %x and %x",
+			entityA.PrimaryKey.Fingerprint, entityB.PrimaryKey.Fingerprint,
+		)
+	}
+
+	merged := &openpgp.Entity{
+		PrimaryKey:  entityA.PrimaryKey,
+		Identities:  make(map[string]*openpgp.Identity),
+		Revocations: append(append([]*packet.Signature(nil), entityA.Revocations...), entityB.Revocations...),
+		Subkeys:     append(append([]openpgp.Subkey(nil), entityA.Subkeys...), entityB.Subkeys...),
+	}
+	for _, e := range []*openpgp.Entity{entityA, entityB} {
+		for id, ident := range e.Identities {
+			existing, ok := merged.Identities[id]
+			if !ok {
+				merged.Identities[id] = &openpgp.Identity{
+					Name:          ident.Name,
+					UserId:        ident.UserId,
+					SelfSignature: ident.SelfSignature,
+					Signatures:    append([]*packet.Signature(nil), ident.Signatures...),
+				}
+				continue
+			}
+			if ident.SelfSignature.CreationTime.After(existing.SelfSignature.CreationTime) {
+				existing.SelfSignature = ident.SelfSignature
+			}
+			existing.Signatures = append(existing.Signatures, ident.Signatures...)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := serializeCleanEntity(&buf, merged); err != nil {
+		return "", err
+	}
+	return armorCleanKey(buf.Bytes())
+}
+
+// StripForeignCertifications removes the signatures made by other keys from
+// the armored public key, e.g. third-party certifications of its user IDs, and
+// returns it cleaned like CleanKey does. Self-signatures, subkey bindings and
+// revocations made by the primary key are kept. Private keys are rejected.
+func (pgp *GopenPGP) StripForeignCertifications(armoredKey string) (string, error) {
+	kr, err := pgp.BuildKeyRingArmored(armoredKey)
+	if err != nil {
+		return "", err
+	}
+
+	var b bytes.Buffer
+	for _, e := range kr.entities {
+		if e.PrivateKey != nil {
+			return "", errors.New("gopenpgp: cannot strip private key")
+		}
+
+		stripped := &openpgp.Entity{
+			PrimaryKey:  e.PrimaryKey,
+			Identities:  make(map[string]*openpgp.Identity),
+			Revocations: getSelfSignatures(e.Revocations, e.PrimaryKey.VerifyRevocationSignature),
+			Subkeys:     e.Subkeys,
+		}
+		for id, ident := range e.Identities {
+			verifyUserID := func(sig *packet.Signature) error {
+				return e.PrimaryKey.VerifyUserIdSignature(ident.Name, e.PrimaryKey, sig)
+			}
+			stripped.Identities[id] = &openpgp.Identity{
+				Name:          ident.Name,
+				UserId:        ident.UserId,
+				SelfSignature: ident.SelfSignature,
+				Signatures:    getSelfSignatures(ident.Signatures, verifyUserID),
+			}
+		}
+		if err := serializeCleanEntity(&b, stripped); err != nil {
+			return "", err
+		}
+	}
+
+	return armorCleanKey(b.Bytes())
+}
+
+// getSelfSignatures returns the signatures of sigs that verify made by the
+// primary key. The issuer key ID of a signature can be forged, so it is not
+// enough to tell self-signatures apart.
+func getSelfSignatures(sigs []*packet.Signature, verify func(*packet.Signature) error) []*packet.Signature {
+	var self []*packet.Signature
+	for _, sig := range sigs {
+		if verify(sig) == nil {
+			self = append(self, sig)
+		}
+	}
+	return self
+}
+
+// readSinglePublicEntity reads an armored key ring that must contain exactly
+// one public key.
+func (pgp *GopenPGP) readSinglePublicEntity(armoredKey string) (*openpgp.Entity, error) {
+	kr, err := pgp.BuildKeyRingArmored(armoredKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(kr.entities) != 1 {
+		return nil, fmt.Errorf("gopenpgp: expected a single key, got %d", len(kr.entities))
+	}
+	if kr.entities[0].PrivateKey != nil {
+		return nil, errors.New("gopenpgp: cannot merge private keys")
+	}
+	return kr.entities[0], nil
+}
+
+// serializeCleanEntity writes the public key e in canonical form: the primary
+// key and its revocations, then the user IDs sorted by ID, each with its latest
+// self-signature followed by its other signatures, then the subkeys sorted by
+// creation time and fingerprint.
+func serializeCleanEntity(b *bytes.Buffer, e *openpgp.Entity) error {
+	if err := e.PrimaryKey.Serialize(b); err != nil {
+		return err
+	}
+	if err := writeSortedSignatures(b, e.Revocations); err != nil {
+		return err
+	}
+
+	ids := make([]string, 0, len(e.Identities))
+	for id := range e.Identities {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		ident := e.Identities[id]
+		if err := ident.UserId.Serialize(b); err != nil {
+			return err
+		}
+		if err := ident.SelfSignature.Serialize(b); err != nil {
+			return err
+		}
+
+		var others []*packet.Signature
+		for _, sig := range ident.Signatures {
+			if !isSelfCertification(e, sig) {
+				others = append(others, sig)
+			}
+		}
+		if err := writeSortedSignatures(b, others); err != nil {
+			return err
+		}
+	}
+
+	for _, subKey := range getCleanSubkeys(e) {
+		if err := subKey.PublicKey.Serialize(b); err != nil {
+			return err
+		}
+		if err := subKey.Sig.Serialize(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isSelfCertification returns whether sig is a self-signature over a user ID
+// of e. Only the latest one is kept, in Identity.SelfSignature.
+func isSelfCertification(e *openpgp.Entity, sig *packet.Signature) bool {
+	return (sig.SigType == packet.SigTypePositiveCert || sig.SigType == packet.SigTypeGenericCert) &&
+		sig.IssuerKeyId != nil && *sig.IssuerKeyId == e.PrimaryKey.KeyId
+}
+
+// getCleanSubkeys returns the subkeys of e without duplicates, preferring
+// revoked copies and then the latest binding signature, sorted by creation
+// time and fingerprint.
+func getCleanSubkeys(e *openpgp.Entity) []openpgp.Subkey {
+	byFingerprint := make(map[[20]byte]openpgp.Subkey)
+	for _, subKey := range e.Subkeys {
+		existing, ok := byFingerprint[subKey.PublicKey.Fingerprint]
+		if !ok || shouldReplaceCleanSubkey(existing.Sig, subKey.Sig) {
+			byFingerprint[subKey.PublicKey.Fingerprint] = subKey
+		}
+	}
+
+	subKeys := make([]openpgp.Subkey, 0, len(byFingerprint))
+	for _, subKey := range byFingerprint {
+		subKeys = append(subKeys, subKey)
+	}
+	sort.Slice(subKeys, func(i, j int) bool {
+		a, b := subKeys[i].PublicKey, subKeys[j].PublicKey
+		if !a.CreationTime.Equal(b.CreationTime) {
+			return a.CreationTime.Before(b.CreationTime)
+		}
+		return bytes.Compare(a.Fingerprint[:], b.Fingerprint[:]) < 0
+	})
+	return subKeys
+}
+
+func shouldReplaceCleanSubkey(existing, sig *packet.Signature) bool {
+	existingRevoked := existing.SigType == packet.SigTypeSubkeyRevocation
+	revoked := sig.SigType == packet.SigTypeSubkeyRevocation
+	if existingRevoked != revoked {
+		return revoked
+	}
+	return sig.CreationTime.After(existing.CreationTime)
+}
+
+// writeSortedSignatures writes sigs without duplicates, sorted by their
+// serialization.
+func writeSortedSignatures(b *bytes.Buffer, sigs []*packet.Signature) error {
+	serialized := make([][]byte, 0, len(sigs))
+	for _, sig := range sigs {
+		var sigBuf bytes.Buffer
+		if err := sig.Serialize(&sigBuf); err != nil {
+			return err
+		}
+		serialized = append(serialized, sigBuf.Bytes())
+	}
+	sort.Slice(serialized, func(i, j int) bool {
+		return bytes.Compare(serialized[i], serialized[j]) < 0
+	})
+
+	for i, sig := range serialized {
+		if i > 0 && bytes.Equal(sig, serialized[i-1]) {
+			continue
+		}
+		b.Write(sig)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+
+	"github.com/ProtonMail/gopenpgp/internal"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
+	errorsPGP "golang.org/x/crypto/openpgp/errors"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// SignCleartext creates a cleartext signed message (RFC 4880, section 7) of a
+// given string, with the keyring's signing key. The keyring must be unlocked.
+func (kr *KeyRing) SignCleartext(text string) (string, error) {
+	config := &packet.Config{
+		DefaultCipher: packet.CipherAES256, DefaultHash: pgp.getSignatureHash(), Time: pgp.getTimeGenerator(),
+	}
+
+	signingKey, err := kr.getSigningKey(config.Now())
+	if err != nil {
+		return "", err
+	}
+
+	var outBuf bytes.Buffer
+	w, err := clearsign.Encode(&outBuf, signingKey, config)
+	if err != nil {
+		return "", err
+	}
+	if _, err = w.Write([]byte(text)); err != nil {
+		return "", err
+	}
+	if err = w.Close(); err != nil {
+		return "", err
+	}
+
+	return outBuf.String(), nil
+}
+
+// VerifyCleartext verifies a cleartext signed message and returns its
+// dash-unescaped text. Trailing whitespace is removed from each line, as it is
+// not covered by the signature. verifyTime works as in VerifyTextDetachedSig.
+func (kr *KeyRing) VerifyCleartext(signedMessage string, verifyTime int64) (text string, err error) {
+	defer recoverMalformedInput(&err)
+
+	block, err := verifyCleartext(kr.entities, signedMessage, verifyTime, internal.CreationTimeOffset)
+	if err == errorsPGP.ErrSignatureExpired && verifyTime > 0 {
+		// Maybe the creation time offset pushed it over the edge
+		// Retry with the actual verification time
+		block, err = verifyCleartext(kr.entities, signedMessage, verifyTime, 0)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(string(block.Plaintext), "\n"), nil
+}
+
+func verifyCleartext(entities openpgp.EntityList, signedMessage string, verifyTime, offset int64) (*clearsign.Block, error) {
+	block, _ := clearsign.Decode([]byte(signedMessage))
+	if block == nil {
+		return nil, errors.New("gopenpgp: not a cleartext signed message")
+	}
+
+	signer, err := block.VerifySignature(entities, getVerifyConfig(verifyTime, offset))
+	if err != nil {
+		return nil, err
+	}
+	if signer == nil {
+		return nil, errors.New("gopenpgp: signer is empty")
+	}
+
+	return block, nil
+}
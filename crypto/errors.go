@@ -0,0 +1,133 @@
+package crypto
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+
+	"github.com/ProtonMail/gopenpgp/constants"
+
+	pgpErrors "golang.org/x/crypto/openpgp/errors"
+)
+
+// CryptoError is an error with one of the constants.ErrorCode* codes, so that
+// callers, including the mobile bindings, can tell errors apart without
+// parsing their message.
+type CryptoError struct {
+	Code    int
+	Message string
+	cause   error
+}
+
+func newCryptoError(code int, message string) *CryptoError {
+	return &CryptoError{Code: code, Message: message}
+}
+
+// wrapCryptoError returns a CryptoError with the code of cause if it is a
+// CryptoError, and constants.ErrorCodeUnknown otherwise.
+func wrapCryptoError(cause error, message string) error {
+	code := constants.ErrorCodeUnknown
+	var cryptoErr *CryptoError
+	if errors.As(cause, &cryptoErr) {
+		code = cryptoErr.Code
+	}
+	return &CryptoError{Code: code, Message: message + ": " + cause.Error(), cause: cause}
+}
+
+func (e *CryptoError) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the error that caused e, if any.
+func (e *CryptoError) Unwrap() error {
+	return e.cause
+}
+
+// GetErrorCode returns the code of err if it is or wraps a CryptoError, and
+// constants.ErrorCodeUnknown otherwise.
+func GetErrorCode(err error) int {
+	var cryptoErr *CryptoError
+	if errors.As(err, &cryptoErr) {
+		return cryptoErr.Code
+	}
+	return constants.ErrorCodeUnknown
+}
+
+// convertReadMessageError returns a CryptoError for the errors of
+// openpgp.ReadMessage that have a code, and err otherwise.
+func convertReadMessageError(err error) error {
+	if err == pgpErrors.ErrKeyIncorrect {
+		return &CryptoError{
+			Code:    constants.ErrorCodeNoDecryptionKey,
+			Message: "gopenpgp: cannot decrypt message, no matching private key",
+			cause:   err,
+		}
+	}
+	return err
+}
+
+// recoverMalformedInput turns a panic of the crypto library, which some
+// malformed packets trigger, into a CryptoError with code
+// constants.ErrorCodeMalformedInput stored in err. It is deferred by the
+// functions that parse untrusted input, err being their named error result.
+// Panics raised elsewhere, such as programming errors of the caller, are
+// propagated.
+func recoverMalformedInput(err *error) {
+	if r := recover(); r != nil {
+		if !panickedInCryptoLibrary() {
+			panic(r)
+		}
+		*err = newCryptoError(constants.ErrorCodeMalformedInput, fmt.Sprintf("gopenpgp: malformed input: %v", r))
+	}
+}
+
+// panickedInCryptoLibrary returns whether the panic being recovered was raised
+// by the crypto library rather than by this module or its callers. It must be
+// called by the deferred function that recovers the panic.
+func panickedInCryptoLibrary() bool {
+	pc := make([]uintptr, 64)
+	frames := runtime.CallersFrames(pc[:runtime.Callers(1, pc)])
+	panicking := false
+	for {
+		frame, more := frames.Next()
+		switch {
+		case frame.Function == "runtime.gopanic":
+			panicking = true
+		case !panicking || strings.HasPrefix(frame.Function, "runtime."):
+			// Frames of the recovery, and of the runtime raising the panic
+		case strings.Contains(frame.Function, "golang.org/x/crypto/"):
+			return true
+		case strings.HasPrefix(frame.Function, "github.com/ProtonMail/gopenpgp/"):
+			return false
+		}
+		if !more {
+			return false
+		}
+	}
+}
+
+// recoverReader recovers the panics of the crypto library while r is read, as
+// recoverMalformedInput does, for the lazily decrypted readers returned to
+// callers.
+type recoverReader struct {
+	r io.Reader
+}
+
+func (r *recoverReader) Read(b []byte) (n int, err error) {
+	defer recoverMalformedInput(&err)
+	return r.r.Read(b)
+}
+
+// errSignerEmpty is returned when no key of the verifier keyring made a
+// signature.
+var errSignerEmpty = newCryptoError(constants.ErrorCodeBadSignature, "gopenpgp: signer is empty")
+
+func newBadSignatureError(cause error) *CryptoError {
+	return &CryptoError{
+		Code:    constants.ErrorCodeBadSignature,
+		Message: "gopenpgp: invalid signature: " + cause.Error(),
+		cause:   cause,
+	}
+}
@@ -0,0 +1,177 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/gopenpgp/constants"
+	"github.com/stretchr/testify/assert"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+	xrsa "golang.org/x/crypto/rsa"
+)
+
+func TestCryptoErrorCodes(t *testing.T) {
+	var pgp = GopenPGP{}
+
+	lockedKeyRing, err := ReadArmoredKeyRing(strings.NewReader(readTestFile("keyring_privateKey", false)))
+	if err != nil {
+		t.Fatal("Expected no error while reading key ring, got:", err)
+	}
+	err = lockedKeyRing.Unlock([]byte("wrong passphrase"))
+	assert.Exactly(t, constants.ErrorCodeWrongPassphrase, GetErrorCode(err))
+
+	encrypted, err := pgp.EncryptMessage("plain text", testPublicKeyRing, nil, "", false)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	_, err = pgp.DecryptMessage(encrypted, lockedKeyRing, "wrong passphrase")
+	assert.Exactly(t, constants.ErrorCodeWrongPassphrase, GetErrorCode(err))
+	assert.Regexp(t, "^gopenpgp: cannot decrypt passphrase: gopenpgp: cannot unlock key ", err.Error())
+
+	entity := generateTestEntity(t, "Other", "other@example.com")
+	otherKeyRing := &KeyRing{entities: openpgp.EntityList{entity}}
+	_, err = pgp.DecryptMessage(encrypted, otherKeyRing, "")
+	assert.Exactly(t, constants.ErrorCodeNoDecryptionKey, GetErrorCode(err))
+
+	_, err = pgp.DecryptMessageVerifyRequired(encrypted, testPublicKeyRing, testPrivateKeyRing, testMailboxPassword, 0)
+	assert.Exactly(t, constants.ErrorCodeNotSigned, GetErrorCode(err))
+
+	signature, err := testPrivateKeyRing.SignTextDetached("plain text", "", false)
+	if err != nil {
+		t.Fatal("Expected no error while signing, got:", err)
+	}
+	_, err = otherKeyRing.VerifyTextDetachedSig(signature, "plain text", 0, false)
+	assert.Exactly(t, constants.ErrorCodeBadSignature, GetErrorCode(err))
+
+	// Encrypted by GnuPG with "password" and a key derived from it, which
+	// "wrong password" fails to decrypt
+	symEncrypted := readTestFile("message_passwordEncrypted", false)
+	_, err = pgp.DecryptMessageWithPassword(symEncrypted, "wrong password")
+	assert.Exactly(t, constants.ErrorCodeWrongPassphrase, GetErrorCode(err))
+	assert.EqualError(t, err, "password incorrect")
+	plainText, err := pgp.DecryptMessageWithPassword(symEncrypted, "password")
+	if err != nil {
+		t.Fatal("Expected no error when decrypting with password, got:", err)
+	}
+	assert.Exactly(t, "plain text", plainText)
+
+	assert.Exactly(t, constants.ErrorCodeUnknown, GetErrorCode(nil))
+}
+
+func TestMalformedInputRecovered(t *testing.T) {
+	keyPacket, dataPacket := malformedMessage(t)
+
+	_, err := pgp.GetSessionFromKeyPacket(keyPacket, testPrivateKeyRing, testMailboxPassword)
+	assert.Exactly(t, constants.ErrorCodeMalformedInput, GetErrorCode(err))
+	assert.Regexp(t, "^gopenpgp: malformed input: ", err.Error())
+
+	armored, err := JoinMessage(keyPacket, dataPacket)
+	if err != nil {
+		t.Fatal("Expected no error while joining message, got:", err)
+	}
+	_, err = pgp.DecryptMessage(armored, testPrivateKeyRing, testMailboxPassword)
+	assert.Exactly(t, constants.ErrorCodeMalformedInput, GetErrorCode(err))
+}
+
+// panickingReader makes the crypto library panic once r has been read to the
+// end, by decrypting the malformed session key packet keyPacket.
+type panickingReader struct {
+	r         io.Reader
+	keyPacket []byte
+}
+
+func (r panickingReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	if err == io.EOF {
+		p, readErr := packet.Read(bytes.NewReader(r.keyPacket))
+		if readErr != nil {
+			return n, readErr
+		}
+		priv := testPrivateKeyRing.GetEntities()[0].Subkeys[0].PrivateKey
+		return n, p.(*packet.EncryptedKey).Decrypt(priv, nil)
+	}
+	return n, err
+}
+
+func TestMalformedInputRecoveredWhileReading(t *testing.T) {
+	var pgp = GopenPGP{}
+
+	plainData, err := pgp.RandomTokenWith(1 << 20)
+	if err != nil {
+		t.Fatal("Expected no error while generating plain data, got:", err)
+	}
+	encrypted, err := pgp.EncryptMessageBinary(plainData, testPublicKeyRing, nil, "")
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	truncated := encrypted[:len(encrypted)/2]
+	keyPacket, _ := malformedMessage(t)
+
+	decrypted, _, err := testPrivateKeyRing.Decrypt(panickingReader{bytes.NewReader(truncated), keyPacket})
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+	_, err = ioutil.ReadAll(decrypted)
+	assert.Exactly(t, constants.ErrorCodeMalformedInput, GetErrorCode(err))
+
+	decrypted, _, err = pgp.DecryptStream(
+		panickingReader{bytes.NewReader(truncated), keyPacket}, testPrivateKeyRing, testPublicKeyRing, 0,
+	)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting stream, got:", err)
+	}
+	_, err = ioutil.ReadAll(decrypted)
+	assert.Exactly(t, constants.ErrorCodeMalformedInput, GetErrorCode(err))
+}
+
+func TestProgrammingErrorsNotRecovered(t *testing.T) {
+	armored, err := pgp.EncryptMessage("plain text", testPublicKeyRing, nil, "", false)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	assert.Panics(t, func() {
+		_, _ = pgp.DecryptMessage(armored, nil, testMailboxPassword)
+	})
+
+	var nilKeyRing *KeyRing
+	assert.Panics(t, func() {
+		_, _, _ = nilKeyRing.Decrypt(strings.NewReader(armored))
+	})
+}
+
+// malformedMessage returns a session key packet for testPrivateKeyRing whose
+// RSA plaintext is a single byte, too short for the cipher and checksum, which
+// makes the crypto library slice out of range, and a data packet to go with it.
+func malformedMessage(t *testing.T) (keyPacket, dataPacket []byte) {
+	pub := getEntityEncryptionKey(testPublicKeyRing.GetEntities()[0])
+	encrypted, err := xrsa.EncryptPKCS1v15(rand.Reader, pub.PublicKey.(*xrsa.PublicKey), []byte{9})
+	if err != nil {
+		t.Fatal("Expected no error while encrypting, got:", err)
+	}
+	var body bytes.Buffer
+	body.WriteByte(3)
+	keyID := make([]byte, 8)
+	binary.BigEndian.PutUint64(keyID, pub.KeyId)
+	body.Write(keyID)
+	body.WriteByte(byte(packet.PubKeyAlgoRSA))
+	writeMPI(&body, encrypted)
+
+	var packets bytes.Buffer
+	writePacketHeader(&packets, encryptedKeyTag, body.Len())
+	body.WriteTo(&packets)
+
+	dataPacket, err = pgp.EncryptWithSessionKey([]byte("plain text"), &SymmetricKey{
+		Key: bytes.Repeat([]byte{1}, 32), Algo: constants.AES256,
+	})
+	if err != nil {
+		t.Fatal("Expected no error while encrypting data packet, got:", err)
+	}
+	return packets.Bytes(), dataPacket
+}
@@ -0,0 +1,50 @@
+package crypto
+
+import (
+	"github.com/ProtonMail/gopenpgp/constants"
+	"github.com/ProtonMail/gopenpgp/internal"
+)
+
+// Sizes used by EstimateEncryptedSize, in bytes.
+const (
+	// Public-key encrypted session key packet for a 2048-bit RSA key
+	estimatedKeyPacketSize = 271
+	// Literal data packet header, without file name
+	literalHeaderSize = 6
+	// SEIPD version, AES random prefix and modification detection code packet
+	integrityProtectionSize = 1 + 16 + 2 + 22
+	// Partial body lengths are written in chunks of at most 16 KiB
+	partialChunkSize = 1 << 14
+	// Armor line length of golang.org/x/crypto/openpgp/armor
+	armorLineLength = 64
+)
+
+// EstimateEncryptedSize approximates the size of the message produced by
+// encrypting plaintextLen bytes to recipientCount recipients without
+// compression, armored like EncryptMessage does if armored is true. The
+// estimate assumes 2048-bit RSA keys, for which it is a slight overestimate
+// suitable for quota checks. Keys of other types and sizes change it by a
+// constant amount per recipient.
+func (pgp *GopenPGP) EstimateEncryptedSize(plaintextLen int, recipientCount int, armored bool) int {
+	literal := streamedPacketSize(literalHeaderSize + plaintextLen)
+	size := recipientCount*estimatedKeyPacketSize + streamedPacketSize(integrityProtectionSize+literal)
+	if !armored {
+		return size
+	}
+
+	encoded := (size + 2) / 3 * 4
+	lines := (encoded + armorLineLength - 1) / armorLineLength
+	armor := len("-----BEGIN "+constants.PGPMessageHeader+"-----\n") + 1 // Blank line after the headers
+	for name, value := range internal.ArmorHeaders {
+		armor += len(name) + len(": ") + len(value) + 1
+	}
+	armor += len("=XXXX\n") + len("-----END "+constants.PGPMessageHeader+"-----")
+	return armor + encoded + lines
+}
+
+// streamedPacketSize returns the size of a packet with a body of bodyLen bytes
+// written with partial body lengths: a tag byte, a length byte per chunk and
+// a final length of up to 5 bytes.
+func streamedPacketSize(bodyLen int) int {
+	return 1 + bodyLen + bodyLen/partialChunkSize + 5
+}
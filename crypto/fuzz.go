@@ -0,0 +1,37 @@
+package crypto
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	pgpErrors "golang.org/x/crypto/openpgp/errors"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// FuzzDecrypt parses data as a binary message, decrypts it with the unlocked
+// privateKey, reads it to the end and checks its signature, if any, against
+// privateKey. It is meant to be driven by a fuzzer: it is deterministic, uses
+// neither the global GopenPGP nor the clock, and reports panics of the crypto
+// library as errors. The plaintext is limited to DefaultMaxDecompressedSize.
+// Without a clock, signature times are not checked. It
+// returns nil only if data is a valid message.
+func FuzzDecrypt(data []byte, privateKey *KeyRing) (err error) {
+	defer recoverMalformedInput(&err)
+
+	config := &packet.Config{Time: func() time.Time { return time.Unix(0, 0) }}
+	md, err := openpgp.ReadMessage(bytes.NewReader(data), privateKey.entities, nil, config)
+	if err != nil {
+		return convertReadMessageError(err)
+	}
+	body := limitSize(md.UnverifiedBody, DefaultMaxDecompressedSize)
+	if _, err = io.Copy(ioutil.Discard, body); err != nil {
+		return err
+	}
+	if md.IsSigned && md.SignatureError != nil && md.SignatureError != pgpErrors.ErrSignatureExpired {
+		return newBadSignatureError(md.SignatureError)
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package crypto
+
+import (
+	"testing"
+
+	"github.com/ProtonMail/gopenpgp/armor"
+	"github.com/ProtonMail/gopenpgp/constants"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFuzzDecrypt(t *testing.T) {
+	armored, err := pgp.EncryptMessage("plain text", testPublicKeyRing, testPrivateKeyRing, testMailboxPassword, false)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	message, err := armor.Unarmor(armored)
+	if err != nil {
+		t.Fatal("Expected no error when unarmoring, got:", err)
+	}
+	assert.NoError(t, FuzzDecrypt(message, testPrivateKeyRing))
+
+	for i := 0; i < len(message); i++ {
+		assert.Error(t, FuzzDecrypt(message[:i], testPrivateKeyRing))
+	}
+	corrupted := append([]byte{}, message...)
+	corrupted[len(corrupted)-1] ^= 0xff
+	assert.Error(t, FuzzDecrypt(corrupted, testPrivateKeyRing))
+
+	keyPacket, dataPacket := malformedMessage(t)
+	err = FuzzDecrypt(append(keyPacket, dataPacket...), testPrivateKeyRing)
+	assert.Exactly(t, constants.ErrorCodeMalformedInput, GetErrorCode(err))
+}
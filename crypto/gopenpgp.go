@@ -1,11 +1,253 @@
 // Package crypto provides a high-level API for common OpenPGP functionality.
 package crypto
 
-import "time"
+import (
+	"crypto"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ProtonMail/gopenpgp/constants"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+)
 
 // GopenPGP is used as a "namespace" for many of the functions in this package.
 // It is a struct that keeps track of time skew between server and client.
 type GopenPGP struct {
 	latestServerTime int64
 	latestClientTime time.Time
+	timeFunc         func() time.Time
+	config           *packet.Config
+	signatureHash    crypto.Hash
+	defaultCipher    packet.CipherFunction
+	allowedCiphers   []packet.CipherFunction
+
+	maxDecompressedSize int64
+}
+
+// defaultConfig is used when no config was set with SetConfig.
+var defaultConfig = &packet.Config{DefaultCipher: packet.CipherAES256}
+
+// SetConfig sets the config used to generate random tokens and session key
+// packets, for instance to use another random number generator. A nil config
+// restores the default, which uses AES-256 and the system random number
+// generator.
+func (pgp *GopenPGP) SetConfig(config *packet.Config) {
+	pgp.config = config
+}
+
+func (pgp *GopenPGP) getConfig() *packet.Config {
+	config := defaultConfig
+	if pgp.config != nil {
+		config = pgp.config
+	}
+	if pgp.defaultCipher != 0 {
+		withCipher := *config
+		withCipher.DefaultCipher = pgp.defaultCipher
+		return &withCipher
+	}
+	return config
+}
+
+// SetDefaultCipher sets the cipher of new session keys, used by RandomToken
+// and to encrypt messages, in place of AES-256. When encrypting to public keys,
+// the cipher is only used if it is allowed and the recipients' keys accept it,
+// see SetAllowedCiphers. c must be AES-128, AES-192 or AES-256: the weak
+// ciphers CAST5 and 3DES are only used for recipients that accept nothing
+// else. 0 restores the default.
+func (pgp *GopenPGP) SetDefaultCipher(c packet.CipherFunction) error {
+	switch c {
+	case 0, packet.CipherAES128, packet.CipherAES192, packet.CipherAES256:
+	case packet.CipherCAST5, packet.Cipher3DES:
+		return fmt.Errorf("gopenpgp: weak cipher function %v can't be the default", c)
+	default:
+		return fmt.Errorf("gopenpgp: unsupported cipher function: %v", c)
+	}
+	pgp.defaultCipher = c
+	return nil
+}
+
+// getDefaultCipher returns the cipher set with SetDefaultCipher, AES-256 by
+// default.
+func (pgp *GopenPGP) getDefaultCipher() packet.CipherFunction {
+	if pgp.defaultCipher != 0 {
+		return pgp.defaultCipher
+	}
+	return packet.CipherAES256
+}
+
+// cipherStrength lists the supported ciphers from the strongest to the
+// weakest.
+var cipherStrength = []packet.CipherFunction{
+	packet.CipherAES256, packet.CipherAES192, packet.CipherAES128, packet.CipherCAST5, packet.Cipher3DES,
+}
+
+// SetAllowedCiphers sets the ciphers that may be used to encrypt messages to
+// public keys. The cipher set with SetDefaultCipher is used if the recipients'
+// keys all prefer it, otherwise the strongest allowed cipher they all prefer,
+// e.g. AES-128 or 3DES for old clients. If they share none, AES-256 is used.
+// Keys that don't state preferences accept any cipher. Each cipher must be one
+// of SupportedSymmetricCiphers; nil allows them all, which is the default.
+func (pgp *GopenPGP) SetAllowedCiphers(ciphers []packet.CipherFunction) error {
+	for _, c := range ciphers {
+		if _, err := getAlgo(c); err != nil {
+			return err
+		}
+	}
+	pgp.allowedCiphers = ciphers
+	return nil
+}
+
+// getRecipientsCipher returns the cipher to encrypt a message to recipients
+// with, see SetAllowedCiphers.
+func (pgp *GopenPGP) getRecipientsCipher(recipients []*openpgp.Entity) packet.CipherFunction {
+	var candidates []packet.CipherFunction
+	for _, c := range cipherStrength {
+		if (pgp.allowedCiphers == nil || containsCipher(pgp.allowedCiphers, c)) && acceptCipher(recipients, c) {
+			candidates = append(candidates, c)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return packet.CipherAES256
+	}
+	if pgp.defaultCipher != 0 && containsCipher(candidates, pgp.defaultCipher) {
+		return pgp.defaultCipher
+	}
+	return candidates[0]
+}
+
+// getEncryptConfig returns the config to encrypt a message to recipients with,
+// using the negotiated cipher and the signature hash and time of pgp.
+func (pgp *GopenPGP) getEncryptConfig(recipients []*openpgp.Entity) *packet.Config {
+	return &packet.Config{
+		DefaultCipher: pgp.getRecipientsCipher(recipients),
+		DefaultHash:   pgp.getSignatureHash(),
+		Time:          pgp.getTimeGenerator(),
+	}
+}
+
+// acceptCipher returns whether the primary identities of all recipients which
+// state cipher preferences prefer c.
+func acceptCipher(recipients []*openpgp.Entity, c packet.CipherFunction) bool {
+	for _, e := range recipients {
+		i := getPrimaryIdentity(e)
+		if i == nil || i.SelfSignature == nil || len(i.SelfSignature.PreferredSymmetric) == 0 {
+			continue
+		}
+		if !containsPreference(i.SelfSignature.PreferredSymmetric, c) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsPreference(preferences []uint8, c packet.CipherFunction) bool {
+	for _, preferred := range preferences {
+		if packet.CipherFunction(preferred) == c {
+			return true
+		}
+	}
+	return false
+}
+
+func containsCipher(ciphers []packet.CipherFunction, c packet.CipherFunction) bool {
+	for _, cipher := range ciphers {
+		if cipher == c {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultMaxDecompressedSize is a reasonable maximum size in bytes of the
+// plaintext of untrusted messages, see SetMaxDecompressedSize and DecryptLimits.
+const DefaultMaxDecompressedSize = 100 << 20
+
+// SetMaxDecompressedSize limits the size in bytes of the plaintext of the
+// messages decrypted afterwards. A small compressed message can expand to
+// gigabytes: once the plaintext exceeds size, reading it fails with
+// ErrDecompressedSizeExceeded. The size is not limited by default, and 0 or a
+// negative size removes the limit again.
+func (pgp *GopenPGP) SetMaxDecompressedSize(size int64) {
+	pgp.maxDecompressedSize = size
+}
+
+// limitDecompressedSize returns a reader reading r, which fails once more than
+// the maximum decompressed size has been read.
+func (pgp *GopenPGP) limitDecompressedSize(r io.Reader) io.Reader {
+	return limitSize(r, pgp.maxDecompressedSize)
+}
+
+// limitSize returns a reader reading r, which fails once more than size bytes
+// have been read. If size is not positive, r is returned.
+func limitSize(r io.Reader, size int64) io.Reader {
+	if size <= 0 {
+		return r
+	}
+	return &sizeLimitReader{r: r, remaining: size}
+}
+
+// DecryptLimits bounds the resources used to decrypt an untrusted message,
+// see DecryptMessageWithLimits.
+type DecryptLimits struct {
+	// MaxSize is the maximum size in bytes of the plaintext, for instance
+	// DefaultMaxDecompressedSize. If 0, the size is not limited.
+	MaxSize int64
+	// MaxCompressionDepth is the maximum number of nested compressed packets.
+	// If 0, only the limit of the crypto library applies.
+	MaxCompressionDepth int
+}
+
+// DecryptOptions are the options of DecryptMessageWithOptions. Use
+// NewDecryptOptions to get the defaults.
+type DecryptOptions struct {
+	// Limits bounds the resources used to decrypt the message, see
+	// DecryptMessageWithLimits. If nil, only the size limit set with
+	// SetMaxDecompressedSize applies.
+	Limits *DecryptLimits
+	// RequireIntegrityProtection refuses messages whose data packet has no
+	// integrity protection (MDC) with ErrMessageNotProtected. Only disable it to
+	// decrypt old archives, an attacker can modify such messages without being
+	// detected.
+	RequireIntegrityProtection bool
+}
+
+// NewDecryptOptions returns the default DecryptOptions, which require integrity
+// protection.
+func NewDecryptOptions() *DecryptOptions {
+	return &DecryptOptions{RequireIntegrityProtection: true}
+}
+
+// ErrDecompressedSizeExceeded is returned when reading a decrypted message
+// larger than the limit set with SetMaxDecompressedSize or DecryptLimits.
+var ErrDecompressedSizeExceeded = newCryptoError(
+	constants.ErrorCodeLimitExceeded, "gopenpgp: decrypted message exceeds the maximum size",
+)
+
+// ErrCompressionTooDeep is returned when decrypting a message with more nested
+// compressed packets than allowed by DecryptLimits.
+var ErrCompressionTooDeep = newCryptoError(
+	constants.ErrorCodeLimitExceeded, "gopenpgp: decrypted message has too many nested compressed packets",
+)
+
+// An io.Reader that fails with ErrDecompressedSizeExceeded once more than
+// remaining bytes have been read.
+type sizeLimitReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (r *sizeLimitReader) Read(b []byte) (n int, err error) {
+	// Read one byte more than allowed to tell an exact fit from an overflow
+	if int64(len(b)) > r.remaining {
+		b = b[:r.remaining+1]
+	}
+	n, err = r.r.Read(b)
+	if int64(n) > r.remaining {
+		return int(r.remaining), ErrDecompressedSizeExceeded
+	}
+	r.remaining -= int64(n)
+	return n, err
 }
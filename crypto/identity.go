@@ -0,0 +1,113 @@
+package crypto
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// AddUserID adds a new user ID to the first key of this KeyRing and self-signs
+// it with the primary key, which is unlocked with passphrase if needed. The
+// keyring keeps its lock state.
+func (kr *KeyRing) AddUserID(name, comment, email string, passphrase []byte) error {
+	if len(kr.entities) == 0 {
+		return errors.New("gopenpgp: cannot add user ID, no private key available")
+	}
+	e := kr.entities[0]
+	priv, err := getUnlockedPrimaryKey(e, passphrase)
+	if err != nil {
+		return err
+	}
+
+	uid := packet.NewUserId(name, comment, email)
+	if uid == nil {
+		return errors.New("gopenpgp: cannot add user ID, it contains invalid characters")
+	}
+	if _, ok := e.Identities[uid.Id]; ok {
+		return fmt.Errorf("gopenpgp: cannot add user ID, %s already exists", uid.Id)
+	}
+
+	config := &packet.Config{Time: pgp.getTimeGenerator(), DefaultHash: pgp.getSignatureHash()}
+	sig := &packet.Signature{
+		CreationTime: config.Now(),
+		SigType:      packet.SigTypePositiveCert,
+		PubKeyAlgo:   e.PrimaryKey.PubKeyAlgo,
+		Hash:         config.Hash(),
+		FlagsValid:   true,
+		FlagSign:     true,
+		FlagCertify:  true,
+		IssuerKeyId:  &e.PrimaryKey.KeyId,
+	}
+	if primary := getPrimaryIdentity(e); primary != nil {
+		sig.PreferredSymmetric = primary.SelfSignature.PreferredSymmetric
+		sig.PreferredHash = primary.SelfSignature.PreferredHash
+		sig.PreferredCompression = primary.SelfSignature.PreferredCompression
+	}
+	if err = sig.SignUserId(uid.Id, e.PrimaryKey, priv, config); err != nil {
+		return fmt.Errorf("gopenpgp: cannot sign user ID: %v", err)
+	}
+
+	e.Identities[uid.Id] = &openpgp.Identity{
+		Name:          uid.Id,
+		UserId:        uid,
+		SelfSignature: sig,
+		Signatures:    []*packet.Signature{sig},
+	}
+	return nil
+}
+
+// RevokeUserID adds a revocation signature by the primary key to every user ID
+// with the given email in this KeyRing. The primary key is unlocked with
+// passphrase if needed, and the keyring keeps its lock state.
+func (kr *KeyRing) RevokeUserID(email string, passphrase []byte) error {
+	config := &packet.Config{Time: pgp.getTimeGenerator(), DefaultHash: pgp.getSignatureHash()}
+	found := false
+	for _, e := range kr.entities {
+		for _, ident := range e.Identities {
+			if ident.UserId.Email != email {
+				continue
+			}
+			found = true
+
+			priv, err := getUnlockedPrimaryKey(e, passphrase)
+			if err != nil {
+				return err
+			}
+
+			sig := &packet.Signature{
+				CreationTime: config.Now(),
+				SigType:      sigTypeCertificationRevocation,
+				PubKeyAlgo:   e.PrimaryKey.PubKeyAlgo,
+				Hash:         config.Hash(),
+				IssuerKeyId:  &e.PrimaryKey.KeyId,
+			}
+			if err = sig.SignUserId(ident.UserId.Id, e.PrimaryKey, priv, config); err != nil {
+				return fmt.Errorf("gopenpgp: cannot revoke user ID: %v", err)
+			}
+			ident.Signatures = append(ident.Signatures, sig)
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("gopenpgp: cannot revoke user ID, no user ID with email %s", email)
+	}
+	return nil
+}
+
+// getUnlockedPrimaryKey returns the primary private key of e, decrypted with
+// passphrase if needed. The key of e itself is left untouched.
+func getUnlockedPrimaryKey(e *openpgp.Entity, passphrase []byte) (*packet.PrivateKey, error) {
+	if e.PrivateKey == nil {
+		return nil, fmt.Errorf("gopenpgp: key %x has no private key", e.PrimaryKey.KeyId)
+	}
+
+	priv := *e.PrivateKey
+	if priv.Encrypted {
+		if err := priv.Decrypt(passphrase); err != nil {
+			return nil, fmt.Errorf("gopenpgp: cannot unlock key %x: %v", priv.KeyId, err)
+		}
+	}
+	return &priv, nil
+}
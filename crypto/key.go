@@ -3,11 +3,13 @@ package crypto
 import (
 	"bytes"
 	"crypto"
+	"crypto/subtle"
 	"encoding/base64"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"math/big"
 	"runtime"
 	"strings"
@@ -49,6 +51,22 @@ func (sk *SymmetricKey) GetCipherFunc() packet.CipherFunction {
 	panic("gopenpgp: unsupported cipher function: " + sk.Algo)
 }
 
+// Equals returns true if both session keys have the same algorithm and key. The
+// keys are compared in constant time.
+func (sk *SymmetricKey) Equals(other *SymmetricKey) bool {
+	if sk == nil || other == nil {
+		return sk == other
+	}
+
+	// "3des" and "tripledes" refer to the same cipher
+	sameAlgo := sk.Algo == other.Algo
+	if cf, ok := symKeyAlgos[sk.Algo]; ok {
+		sameAlgo = cf == symKeyAlgos[other.Algo]
+	}
+
+	return subtle.ConstantTimeCompare(sk.Key, other.Key) == 1 && sameAlgo
+}
+
 // GetBase64Key returns the session key as base64 encoded string.
 func (sk *SymmetricKey) GetBase64Key() string {
 	return base64.StdEncoding.EncodeToString(sk.Key)
@@ -126,6 +144,9 @@ func SeparateKeyAndData(
 			err = nil
 			break
 		}
+		if err != nil {
+			return nil, fmt.Errorf("gopenpgp: cannot read message packets: %v", err)
+		}
 		switch p := p.(type) {
 		case *packet.EncryptedKey:
 			// We got an encrypted key. Try to decrypt it with each available key
@@ -161,9 +182,6 @@ func SeparateKeyAndData(
 			block := make([]byte, 128)
 			for {
 				n, err := p.Contents.Read(block)
-				if err == io.EOF {
-					break
-				}
 				b.Write(block[:n])
 				actualLength += n
 				gcCounter += n
@@ -171,6 +189,12 @@ func SeparateKeyAndData(
 					runtime.GC()
 					gcCounter = 0
 				}
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					return nil, fmt.Errorf("gopenpgp: cannot read encrypted data packet: %v", err)
+				}
 			}
 
 			// quick encoding
@@ -260,7 +284,7 @@ func (kr *KeyRing) EncryptKey(symKey *SymmetricKey) (packets string, err error)
 		return "", err
 	}
 
-	if err = packet.SerializeEncryptedKey(w, pub, cf, symKey.Key, nil); err != nil {
+	if err = serializeEncryptedKey(w, pub, cf, symKey.Key, pgp.getConfig()); err != nil {
 		err = fmt.Errorf("gopenpgp: cannot set key: %v", err)
 		return "", err
 	}
@@ -345,6 +369,7 @@ func (pgp *GopenPGP) generateKey(
 	userName, domain, passphrase, keyType string,
 	bits int,
 	prime1, prime2, prime3, prime4 []byte,
+	keyLifetimeSecs uint32,
 ) (string, error) {
 	if len(userName) <= 0 {
 		return "", errors.New("invalid user name format")
@@ -365,8 +390,13 @@ func (pgp *GopenPGP) generateKey(
 		DefaultCipher: packet.CipherAES256,
 	}
 
-	if keyType == "x25519" {
+	switch keyType {
+	case "rsa":
+	case "x25519", "ed25519":
+		// Ed25519 signing primary key with an X25519 encryption subkey
 		cfg.Algorithm = packet.PubKeyAlgoEdDSA
+	default:
+		return "", errors.New("gopenpgp: unsupported key type: " + keyType)
 	}
 
 	if prime1 != nil && prime2 != nil && prime3 != nil && prime4 != nil {
@@ -388,6 +418,15 @@ func (pgp *GopenPGP) generateKey(
 		return "", err
 	}
 
+	if keyLifetimeSecs != 0 {
+		for _, identity := range newEntity.Identities {
+			identity.SelfSignature.KeyLifetimeSecs = &keyLifetimeSecs
+		}
+		for _, sub := range newEntity.Subkeys {
+			sub.Sig.KeyLifetimeSecs = &keyLifetimeSecs
+		}
+	}
+
 	if err := newEntity.SelfSign(nil); err != nil {
 		return "", err
 	}
@@ -415,20 +454,76 @@ func (pgp *GopenPGP) generateKey(
 	return armor.ArmorWithType(serialized, constants.PrivateKeyHeader)
 }
 
-// GenerateRSAKeyWithPrimes generates a RSA key using the given primes.
+// GenerateRSAKeyWithPrimes generates a RSA key using the given primes instead
+// of random ones: primeone and primetwo for the primary key, primethree and
+// primefour for the encryption subkey. The product of each pair must be bits
+// long. An error is returned if a prime is missing or invalid.
 func (pgp *GopenPGP) GenerateRSAKeyWithPrimes(
 	userName, domain, passphrase string,
 	bits int,
 	primeone, primetwo, primethree, primefour []byte,
 ) (string, error) {
-	return pgp.generateKey(userName, domain, passphrase, "rsa", bits, primeone, primetwo, primethree, primefour)
+	if err := checkRSAPrimes(bits, primeone, primetwo); err != nil {
+		return "", fmt.Errorf("gopenpgp: invalid primary key primes: %v", err)
+	}
+	if err := checkRSAPrimes(bits, primethree, primefour); err != nil {
+		return "", fmt.Errorf("gopenpgp: invalid subkey primes: %v", err)
+	}
+	return pgp.generateKey(userName, domain, passphrase, "rsa", bits, primeone, primetwo, primethree, primefour, 0)
 }
 
-// GenerateKey generates a key of the given keyType ("rsa" or "x25519"). If
-// keyType is "rsa", bits is the RSA bitsize of the key. If keyType is "x25519",
-// bits is unused.
+// rsaPublicExponent is the public exponent of the RSA keys generated by the
+// crypto library.
+const rsaPublicExponent = 65537
+
+// checkRSAPrimes checks that p and q can form a bits long RSA key with the
+// public exponent used by the crypto library. Otherwise, the library would
+// silently replace them with random primes.
+func checkRSAPrimes(bits int, p, q []byte) error {
+	if len(p) == 0 || len(q) == 0 {
+		return errors.New("missing prime")
+	}
+
+	bigP := new(big.Int).SetBytes(p)
+	bigQ := new(big.Int).SetBytes(q)
+	if !bigP.ProbablyPrime(20) || !bigQ.ProbablyPrime(20) {
+		return errors.New("not a prime")
+	}
+	if bigP.Cmp(bigQ) == 0 {
+		return errors.New("primes are equal")
+	}
+	if n := new(big.Int).Mul(bigP, bigQ); n.BitLen() != bits {
+		return fmt.Errorf("modulus is %d bits long, expected %d", n.BitLen(), bits)
+	}
+
+	one := big.NewInt(1)
+	totient := new(big.Int).Mul(new(big.Int).Sub(bigP, one), new(big.Int).Sub(bigQ, one))
+	if new(big.Int).GCD(nil, nil, big.NewInt(rsaPublicExponent), totient).Cmp(one) != 0 {
+		return fmt.Errorf("primes are incompatible with public exponent %d", rsaPublicExponent)
+	}
+	return nil
+}
+
+// GenerateKey generates a key of the given keyType ("rsa", "x25519" or
+// "ed25519"). If keyType is "rsa", bits is the RSA bitsize of the key. If
+// keyType is "x25519" or "ed25519", an Ed25519 primary key with an X25519
+// encryption subkey is generated and bits is unused.
 func (pgp *GopenPGP) GenerateKey(userName, domain, passphrase, keyType string, bits int) (string, error) {
-	return pgp.generateKey(userName, domain, passphrase, keyType, bits, nil, nil, nil, nil)
+	return pgp.generateKey(userName, domain, passphrase, keyType, bits, nil, nil, nil, nil, 0)
+}
+
+// GenerateKeyWithExpiration generates a key like GenerateKey, which expires
+// lifetimeSecs seconds after its creation. The expiration is set on the
+// self-signatures of the primary key and on the subkey binding signatures. A
+// lifetimeSecs of 0 generates a key that never expires.
+func (pgp *GopenPGP) GenerateKeyWithExpiration(
+	userName, domain, passphrase, keyType string,
+	bits int, lifetimeSecs int,
+) (string, error) {
+	if lifetimeSecs < 0 || int64(lifetimeSecs) > math.MaxUint32 {
+		return "", fmt.Errorf("gopenpgp: invalid key lifetime %d", lifetimeSecs)
+	}
+	return pgp.generateKey(userName, domain, passphrase, keyType, bits, nil, nil, nil, nil, uint32(lifetimeSecs))
 }
 
 // UpdatePrivateKeyPassphrase decrypts the given armored privateKey with
@@ -436,6 +531,17 @@ func (pgp *GopenPGP) GenerateKey(userName, domain, passphrase, keyType string, b
 // key.
 func (pgp *GopenPGP) UpdatePrivateKeyPassphrase(
 	privateKey string, oldPassphrase string, newPassphrase string,
+) (string, error) {
+	return pgp.ChangePrivateKeyPassphrase(privateKey, []byte(oldPassphrase), []byte(newPassphrase))
+}
+
+// ChangePrivateKeyPassphrase decrypts every private key and subkey of the given
+// armored privateKey with oldPassphrase, re-encrypts them with newPassphrase,
+// and returns the new armored key. Keys that are not encrypted are encrypted
+// with newPassphrase too. If any key can't be decrypted, an error is returned
+// and no key is re-encrypted.
+func (pgp *GopenPGP) ChangePrivateKeyPassphrase(
+	privateKey string, oldPassphrase, newPassphrase []byte,
 ) (string, error) {
 	privKey := strings.NewReader(privateKey)
 	privKeyEntries, err := openpgp.ReadArmoredKeyRing(privKey)
@@ -443,33 +549,34 @@ func (pgp *GopenPGP) UpdatePrivateKeyPassphrase(
 		return "", err
 	}
 
-	oldrawPwd := []byte(oldPassphrase)
-	newRawPwd := []byte(newPassphrase)
-	w := bytes.NewBuffer(nil)
+	var keys []*packet.PrivateKey
 	for _, e := range privKeyEntries {
-		if e.PrivateKey != nil && e.PrivateKey.Encrypted {
-			if err := e.PrivateKey.Decrypt(oldrawPwd); err != nil {
-				return "", err
-			}
+		if e.PrivateKey != nil {
+			keys = append(keys, e.PrivateKey)
 		}
-		if e.PrivateKey != nil && !e.PrivateKey.Encrypted {
-			if err := e.PrivateKey.Encrypt(newRawPwd); err != nil {
-				return "", err
+		for _, sub := range e.Subkeys {
+			if sub.PrivateKey != nil {
+				keys = append(keys, sub.PrivateKey)
 			}
 		}
+	}
 
-		for _, sub := range e.Subkeys {
-			if sub.PrivateKey != nil && sub.PrivateKey.Encrypted {
-				if err := sub.PrivateKey.Decrypt(oldrawPwd); err != nil {
-					return "", err
-				}
-			}
-			if sub.PrivateKey != nil && !sub.PrivateKey.Encrypted {
-				if err := sub.PrivateKey.Encrypt(newRawPwd); err != nil {
-					return "", err
-				}
+	for _, key := range keys {
+		if key.Encrypted {
+			if err := key.Decrypt(oldPassphrase); err != nil {
+				return "", fmt.Errorf("gopenpgp: cannot decrypt key %x: %v", key.KeyId, err)
 			}
 		}
+	}
+
+	for _, key := range keys {
+		if err := key.Encrypt(newPassphrase); err != nil {
+			return "", fmt.Errorf("gopenpgp: cannot encrypt key %x: %v", key.KeyId, err)
+		}
+	}
+
+	w := bytes.NewBuffer(nil)
+	for _, e := range privKeyEntries {
 		if err := e.SerializePrivateNoSign(w, nil); err != nil {
 			return "", err
 		}
@@ -479,6 +586,63 @@ func (pgp *GopenPGP) UpdatePrivateKeyPassphrase(
 	return armor.ArmorWithType(serialized, constants.PrivateKeyHeader)
 }
 
+// CheckPassphrase reports whether passphrase decrypts every encrypted private
+// key and subkey of the given armored privateKey. Unlike
+// KeyRing.CheckPassphrase, which leaves the keys it checks decrypted, the keys
+// are decrypted in a copy that is discarded. An error is returned if
+// privateKey can't be read or has no private key.
+func (pgp *GopenPGP) CheckPassphrase(privateKey string, passphrase []byte) (bool, error) {
+	privKeyEntries, err := openpgp.ReadArmoredKeyRing(strings.NewReader(privateKey))
+	if err != nil {
+		return false, err
+	}
+
+	var keys []*packet.PrivateKey
+	for _, e := range privKeyEntries {
+		if e.PrivateKey != nil {
+			keys = append(keys, e.PrivateKey)
+		}
+		for _, sub := range e.Subkeys {
+			if sub.PrivateKey != nil {
+				keys = append(keys, sub.PrivateKey)
+			}
+		}
+	}
+	if len(keys) == 0 {
+		return false, errors.New("gopenpgp: key has no private key")
+	}
+
+	for _, key := range keys {
+		if key.Encrypted && key.Decrypt(passphrase) != nil {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// GetPublicKeyFromPrivate returns the armored public key of the given armored
+// privateKey: its primary keys, user IDs, subkeys and their signatures, without
+// any secret key material.
+func (pgp *GopenPGP) GetPublicKeyFromPrivate(privateKey string) (string, error) {
+	privKeyReader := strings.NewReader(privateKey)
+	entries, err := openpgp.ReadArmoredKeyRing(privKeyReader)
+	if err != nil {
+		return "", err
+	}
+
+	w := bytes.NewBuffer(nil)
+	for _, e := range entries {
+		if e.PrivateKey == nil {
+			return "", errors.New("gopenpgp: cannot get public key, not a private key")
+		}
+		if err := e.Serialize(w); err != nil {
+			return "", err
+		}
+	}
+
+	return armor.ArmorKey(w.Bytes())
+}
+
 // CheckKey is a debug helper function that prints the key and subkey
 // fingerprints.
 func (pgp *GopenPGP) CheckKey(pubKey string) (string, error) {
@@ -498,3 +662,68 @@ func (pgp *GopenPGP) CheckKey(pubKey string) (string, error) {
 	}
 	return "", nil
 }
+
+// VerifyKeyStructure checks the binding signatures of every subkey of the
+// armored public or private armoredKey, and the validity of the key as a
+// whole. Signing subkeys must also carry a primary key binding signature made
+// by the subkey, without which anyone could claim another's signing key as
+// their own. The error names the first subkey that isn't properly bound.
+func (pgp *GopenPGP) VerifyKeyStructure(armoredKey string) error {
+	rawKey, err := armor.Unarmor(armoredKey)
+	if err != nil {
+		return err
+	}
+
+	var primaryKey, subKey *packet.PublicKey
+	bound := true
+	packets := packet.NewReader(bytes.NewReader(rawKey))
+	for {
+		p, err := packets.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("gopenpgp: cannot read key: %v", err)
+		}
+
+		var pub *packet.PublicKey
+		switch p := p.(type) {
+		case *packet.PublicKey:
+			pub = p
+		case *packet.PrivateKey:
+			pub = &p.PublicKey
+		case *packet.Signature:
+			if subKey == nil || p.SigType != packet.SigTypeSubkeyBinding {
+				continue
+			}
+			if p.FlagsValid && p.FlagSign && p.EmbeddedSignature == nil {
+				return fmt.Errorf("gopenpgp: signing subkey %x has no primary key binding signature", subKey.KeyId)
+			}
+			if err := primaryKey.VerifyKeySignature(subKey, p); err != nil {
+				return fmt.Errorf("gopenpgp: invalid binding signature of subkey %x: %v", subKey.KeyId, err)
+			}
+			bound = true
+			continue
+		default:
+			continue
+		}
+
+		if !bound {
+			return fmt.Errorf("gopenpgp: subkey %x has no binding signature", subKey.KeyId)
+		}
+		if pub.IsSubkey {
+			if primaryKey == nil {
+				return errors.New("gopenpgp: subkey without primary key")
+			}
+			subKey, bound = pub, false
+		} else {
+			primaryKey, subKey = pub, nil
+		}
+	}
+	if !bound {
+		return fmt.Errorf("gopenpgp: subkey %x has no binding signature", subKey.KeyId)
+	}
+
+	_, err = openpgp.ReadKeyRing(bytes.NewReader(rawKey))
+	return err
+}
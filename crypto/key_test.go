@@ -1,13 +1,24 @@
 package crypto
 
 import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
 	"encoding/base64"
+	"fmt"
+	"io"
+	"math/big"
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/ProtonMail/gopenpgp/armor"
 	"github.com/ProtonMail/gopenpgp/constants"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+	xrsa "golang.org/x/crypto/rsa"
 )
 
 const name = "richard.stallman"
@@ -124,6 +135,71 @@ func TestUpdatePrivateKeysPassphrase(t *testing.T) {
 	passphrase = newPassphrase
 }
 
+func TestCheckPassphraseArmored(t *testing.T) {
+	privateKey := readTestFile("keyring_privateKey", false)
+
+	ok, err := pgp.CheckPassphrase(privateKey, []byte(testMailboxPassword))
+	if err != nil {
+		t.Fatal("Expected no error while checking passphrase, got:", err)
+	}
+	assert.True(t, ok)
+
+	ok, err = pgp.CheckPassphrase(privateKey, []byte("wrong"))
+	if err != nil {
+		t.Fatal("Expected no error while checking passphrase, got:", err)
+	}
+	assert.False(t, ok)
+
+	_, err = pgp.CheckPassphrase(readTestFile("keyring_publicKey", false), []byte(testMailboxPassword))
+	assert.EqualError(t, err, "gopenpgp: key has no private key")
+
+	kr, err := pgp.BuildKeyRingArmored(privateKey)
+	if err != nil {
+		t.Fatal("Expected no error while building key ring, got:", err)
+	}
+	if _, err = pgp.CheckPassphrase(privateKey, []byte(testMailboxPassword)); err != nil {
+		t.Fatal("Expected no error while checking passphrase, got:", err)
+	}
+	assert.True(t, kr.GetEntities()[0].PrivateKey.Encrypted)
+}
+
+func TestChangePrivateKeyPassphrase(t *testing.T) {
+	// Encrypt the primary key only, leaving the subkey unencrypted
+	entity := generateTestEntity(t, name, name+"@"+domain)
+	if err = entity.PrivateKey.Encrypt([]byte(passphrase)); err != nil {
+		t.Fatal("Expected no error while encrypting primary key, got:", err)
+	}
+
+	var serialized bytes.Buffer
+	if err = entity.SerializePrivateNoSign(&serialized, nil); err != nil {
+		t.Fatal("Expected no error while serializing key, got:", err)
+	}
+	mixedKey, err := armor.ArmorWithType(serialized.Bytes(), constants.PrivateKeyHeader)
+	if err != nil {
+		t.Fatal("Expected no error while armoring key, got:", err)
+	}
+
+	_, err = pgp.ChangePrivateKeyPassphrase(mixedKey, []byte("wrong"), []byte("new"))
+	assert.Regexp(t, fmt.Sprintf("^gopenpgp: cannot decrypt key %x: ", entity.PrimaryKey.KeyId), err.Error())
+
+	changedKey, err := pgp.ChangePrivateKeyPassphrase(mixedKey, []byte(passphrase), []byte("new"))
+	if err != nil {
+		t.Fatal("Expected no error while changing passphrase, got:", err)
+	}
+
+	changedKeyRing, err := ReadArmoredKeyRing(strings.NewReader(changedKey))
+	if err != nil {
+		t.Fatal("Expected no error while reading changed key, got:", err)
+	}
+	changedEntity := changedKeyRing.GetEntities()[0]
+	assert.True(t, changedEntity.PrivateKey.Encrypted)
+	assert.True(t, changedEntity.Subkeys[0].PrivateKey.Encrypted)
+
+	assert.Error(t, changedKeyRing.Unlock([]byte(passphrase)))
+	assert.NoError(t, changedEntity.PrivateKey.Decrypt([]byte("new")))
+	assert.NoError(t, changedEntity.Subkeys[0].PrivateKey.Decrypt([]byte("new")))
+}
+
 func ExampleCheckKeys() {
 	_, _ = pgp.CheckKey(readTestFile("keyring_publicKey", false))
 	// Output:
@@ -155,3 +231,470 @@ func TestIsKeyExpired(t *testing.T) {
 	assert.EqualError(t, expErr, "keys expired")
 	assert.EqualError(t, futureErr, "keys expired")
 }
+
+func TestSymmetricKeyEquals(t *testing.T) {
+	var pass, _ = base64.StdEncoding.DecodeString("H2CAwzpdexjxXucVYMERDiAc/td8aGPrr6ZhfMnZlLI=")
+	var other, _ = base64.StdEncoding.DecodeString("ExXmnSiQ2QCey20YLH6qlLhkY3xnIBC1AwlIXwK/HvY=")
+
+	sk := &SymmetricKey{Key: pass, Algo: constants.AES256}
+
+	assert.True(t, sk.Equals(&SymmetricKey{Key: pass, Algo: constants.AES256}))
+	assert.False(t, sk.Equals(&SymmetricKey{Key: other, Algo: constants.AES256}))
+	assert.False(t, sk.Equals(&SymmetricKey{Key: pass, Algo: constants.AES128}))
+	assert.False(t, sk.Equals(nil))
+
+	tripleDES := &SymmetricKey{Key: pass[:24], Algo: constants.ThreeDES}
+	assert.True(t, tripleDES.Equals(&SymmetricKey{Key: pass[:24], Algo: constants.TripleDES}))
+}
+
+func TestGenerateEd25519Key(t *testing.T) {
+	edKey, err := pgp.GenerateKey(name, domain, passphrase, "ed25519", 0)
+	if err != nil {
+		t.Fatal("Cannot generate Ed25519 key:", err)
+	}
+
+	edKeyRing, err := ReadArmoredKeyRing(strings.NewReader(edKey))
+	if err != nil {
+		t.Fatal("Cannot read Ed25519 key:", err)
+	}
+
+	entity := edKeyRing.GetEntities()[0]
+	assert.Exactly(t, packet.PubKeyAlgoEdDSA, entity.PrimaryKey.PubKeyAlgo)
+	assert.Len(t, entity.Subkeys, 1)
+	assert.Exactly(t, packet.PubKeyAlgoECDH, entity.Subkeys[0].PublicKey.PubKeyAlgo)
+
+	_, err = pgp.GenerateKey(name, domain, passphrase, "dsa", 1024)
+	assert.EqualError(t, err, "gopenpgp: unsupported key type: dsa")
+}
+
+func TestGenerateKeyWithExpiration(t *testing.T) {
+	expiringKey, err := pgp.GenerateKeyWithExpiration(name, domain, passphrase, "x25519", 0, 3600)
+	if err != nil {
+		t.Fatal("Cannot generate expiring key:", err)
+	}
+
+	expiringKeyRing, err := ReadArmoredKeyRing(strings.NewReader(expiringKey))
+	if err != nil {
+		t.Fatal("Cannot read expiring key:", err)
+	}
+
+	entity := expiringKeyRing.GetEntities()[0]
+	created := entity.PrimaryKey.CreationTime
+	for _, identity := range entity.Identities {
+		assert.False(t, entity.PrimaryKey.KeyExpired(identity.SelfSignature, created.Add(time.Minute)))
+		assert.True(t, entity.PrimaryKey.KeyExpired(identity.SelfSignature, created.Add(2*time.Hour)))
+	}
+	for _, sub := range entity.Subkeys {
+		assert.False(t, sub.PublicKey.KeyExpired(sub.Sig, created.Add(time.Minute)))
+		assert.True(t, sub.PublicKey.KeyExpired(sub.Sig, created.Add(2*time.Hour)))
+	}
+
+	_, err = pgp.GenerateKeyWithExpiration(name, domain, passphrase, "x25519", 0, -1)
+	assert.EqualError(t, err, "gopenpgp: invalid key lifetime -1")
+}
+
+func TestGetPublicKeyFromPrivate(t *testing.T) {
+	publicKey, err := pgp.GetPublicKeyFromPrivate(readTestFile("keyring_privateKey", false))
+	if err != nil {
+		t.Fatal("Expected no error while extracting public key, got:", err)
+	}
+
+	rTest := regexp.MustCompile("(?s)^-----BEGIN PGP PUBLIC KEY BLOCK-----.*-----END PGP PUBLIC KEY BLOCK-----$")
+	assert.Regexp(t, rTest, publicKey)
+
+	publicKeyRing, err := ReadArmoredKeyRing(strings.NewReader(publicKey))
+	if err != nil {
+		t.Fatal("Expected no error while reading public key, got:", err)
+	}
+
+	entity := publicKeyRing.GetEntities()[0]
+	assert.Nil(t, entity.PrivateKey)
+	assert.Len(t, entity.Subkeys, 1)
+	assert.Nil(t, entity.Subkeys[0].PrivateKey)
+	assert.Len(t, entity.Identities, 1)
+	assert.Exactly(t, testPublicKeyRing.GetEntities()[0].PrimaryKey.Fingerprint, entity.PrimaryKey.Fingerprint)
+
+	_, err = pgp.GetPublicKeyFromPrivate(readTestFile("keyring_publicKey", false))
+	assert.EqualError(t, err, "gopenpgp: cannot get public key, not a private key")
+}
+
+func TestGenerateRSAKeyWithPrimes(t *testing.T) {
+	var primes [4][]byte
+	for i := range primes {
+		prime, err := rand.Prime(rand.Reader, 512)
+		if err != nil {
+			t.Fatal("Expected no error while generating prime, got:", err)
+		}
+		primes[i] = prime.Bytes()
+	}
+
+	key, err := pgp.GenerateRSAKeyWithPrimes(name, domain, passphrase, 1024, primes[0], primes[1], primes[2], primes[3])
+	if err != nil {
+		t.Fatal("Expected no error while generating key with primes, got:", err)
+	}
+
+	keyRing, err := ReadArmoredKeyRing(strings.NewReader(key))
+	if err != nil {
+		t.Fatal("Expected no error while reading key, got:", err)
+	}
+	entity := keyRing.GetEntities()[0]
+	expectedN := new(big.Int).Mul(new(big.Int).SetBytes(primes[0]), new(big.Int).SetBytes(primes[1]))
+	assert.Exactly(t, 0, expectedN.Cmp(entity.PrimaryKey.PublicKey.(*xrsa.PublicKey).N))
+	expectedN.Mul(new(big.Int).SetBytes(primes[2]), new(big.Int).SetBytes(primes[3]))
+	assert.Exactly(t, 0, expectedN.Cmp(entity.Subkeys[0].PublicKey.PublicKey.(*xrsa.PublicKey).N))
+
+	_, err = pgp.GenerateRSAKeyWithPrimes(name, domain, passphrase, 1024, primes[0], primes[1], primes[2], nil)
+	assert.EqualError(t, err, "gopenpgp: invalid subkey primes: missing prime")
+
+	_, err = pgp.GenerateRSAKeyWithPrimes(name, domain, passphrase, 1024, primes[0], primes[0], primes[2], primes[3])
+	assert.EqualError(t, err, "gopenpgp: invalid primary key primes: primes are equal")
+
+	_, err = pgp.GenerateRSAKeyWithPrimes(name, domain, passphrase, 2048, primes[0], primes[1], primes[2], primes[3])
+	assert.EqualError(t, err, "gopenpgp: invalid primary key primes: modulus is 1024 bits long, expected 2048")
+
+	notPrime := new(big.Int).Add(new(big.Int).SetBytes(primes[1]), big.NewInt(1)).Bytes()
+	_, err = pgp.GenerateRSAKeyWithPrimes(name, domain, passphrase, 1024, primes[0], notPrime, primes[2], primes[3])
+	assert.EqualError(t, err, "gopenpgp: invalid primary key primes: not a prime")
+}
+
+func TestCheckKeyStrength(t *testing.T) {
+	assert.NoError(t, pgp.CheckKeyStrength(readTestFile("keyring_publicKey", false)))
+	assert.NoError(t, pgp.CheckKeyStrength(ecPublicKey))
+
+	err := pgp.CheckKeyStrength(rsaPublicKey)
+	assert.Exactly(t, constants.ErrorCodeWeakKey, GetErrorCode(err))
+	assert.Regexp(t, "^gopenpgp: key [0-9a-f]+ is too weak: RSA key is 1024 bits long, expected at least 2048$", err.Error())
+
+	entity, err := openpgp.NewEntity(name, "", name+"@"+domain, &packet.Config{DefaultHash: crypto.SHA1})
+	if err != nil {
+		t.Fatal("Expected no error while generating key, got:", err)
+	}
+	var b bytes.Buffer
+	if err = entity.Serialize(&b); err != nil {
+		t.Fatal("Expected no error while serializing key, got:", err)
+	}
+	sha1Key, err := armor.ArmorKey(b.Bytes())
+	if err != nil {
+		t.Fatal("Expected no error while armoring key, got:", err)
+	}
+
+	err = pgp.CheckKeyStrength(sha1Key)
+	assert.Exactly(t, constants.ErrorCodeWeakKey, GetErrorCode(err))
+	assert.EqualError(t, err, fmt.Sprintf(
+		"gopenpgp: key %x is too weak: no self-signature uses a strong hash algorithm", entity.PrimaryKey.KeyId,
+	))
+}
+
+// armorTestPackets serializes packets and armors them as a public key.
+func armorTestPackets(t *testing.T, packets ...interface{ Serialize(io.Writer) error }) string {
+	var b bytes.Buffer
+	for _, p := range packets {
+		if err := p.Serialize(&b); err != nil {
+			t.Fatal("Expected no error while serializing packet, got:", err)
+		}
+	}
+	armored, err := armor.ArmorKey(b.Bytes())
+	if err != nil {
+		t.Fatal("Expected no error while armoring key, got:", err)
+	}
+	return armored
+}
+
+func TestCleanKey(t *testing.T) {
+	entity := generateTestEntity(t, name, name+"@"+domain)
+	ident := entity.Identities[name+" <"+name+"@"+domain+">"]
+	oldSig := ident.SelfSignature
+	newSig := *oldSig
+	newSig.CreationTime = oldSig.CreationTime.Add(time.Hour)
+	if err = newSig.SignUserId(ident.UserId.Id, entity.PrimaryKey, entity.PrivateKey, nil); err != nil {
+		t.Fatal("Expected no error while signing user ID, got:", err)
+	}
+
+	subKey := entity.Subkeys[0]
+	messy := armorTestPackets(
+		t, entity.PrimaryKey, ident.UserId, oldSig, &newSig, &newSig,
+		subKey.PublicKey, subKey.Sig, subKey.PublicKey, subKey.Sig,
+	)
+	clean := armorTestPackets(t, entity.PrimaryKey, ident.UserId, &newSig, subKey.PublicKey, subKey.Sig)
+
+	cleanedMessy, err := pgp.CleanKey(messy)
+	if err != nil {
+		t.Fatal("Expected no error while cleaning key, got:", err)
+	}
+	cleanedClean, err := pgp.CleanKey(clean)
+	if err != nil {
+		t.Fatal("Expected no error while cleaning key, got:", err)
+	}
+	assert.Exactly(t, cleanedClean, cleanedMessy)
+	assert.NotContains(t, cleanedMessy, "Version:")
+
+	rawCleaned, err := armor.Unarmor(cleanedMessy)
+	if err != nil {
+		t.Fatal("Expected no error while unarmoring, got:", err)
+	}
+	rawClean, err := armor.Unarmor(clean)
+	if err != nil {
+		t.Fatal("Expected no error while unarmoring, got:", err)
+	}
+	assert.Exactly(t, rawClean, rawCleaned)
+
+	_, err = pgp.CleanKey(readTestFile("keyring_privateKey", false))
+	assert.EqualError(t, err, "gopenpgp: cannot clean private key")
+}
+
+func TestStripForeignCertifications(t *testing.T) {
+	entity := generateTestEntity(t, name, name+"@"+domain)
+	other := generateTestEntity(t, "Other", "other@example.com")
+
+	ident := entity.Identities[name+" <"+name+"@"+domain+">"]
+	certification := &packet.Signature{
+		SigType:      packet.SigTypeGenericCert,
+		PubKeyAlgo:   other.PrimaryKey.PubKeyAlgo,
+		Hash:         crypto.SHA256,
+		CreationTime: time.Now(),
+		IssuerKeyId:  &other.PrimaryKey.KeyId,
+	}
+	if err = certification.SignUserId(ident.UserId.Id, entity.PrimaryKey, other.PrivateKey, nil); err != nil {
+		t.Fatal("Expected no error while certifying user ID, got:", err)
+	}
+	revocation := &packet.Signature{
+		SigType:      sigTypeCertificationRevocation,
+		PubKeyAlgo:   entity.PrimaryKey.PubKeyAlgo,
+		Hash:         crypto.SHA256,
+		CreationTime: time.Now(),
+		IssuerKeyId:  &entity.PrimaryKey.KeyId,
+	}
+	if err = revocation.SignUserId(ident.UserId.Id, entity.PrimaryKey, entity.PrivateKey, nil); err != nil {
+		t.Fatal("Expected no error while revoking user ID, got:", err)
+	}
+	// Made by other, but claiming to be issued by entity. It is a casual
+	// certification, so that it isn't dropped as a superseded self-signature
+	forged := &packet.Signature{
+		SigType:      packet.SigTypeCasualCert,
+		PubKeyAlgo:   other.PrimaryKey.PubKeyAlgo,
+		Hash:         crypto.SHA256,
+		CreationTime: time.Now(),
+		IssuerKeyId:  &entity.PrimaryKey.KeyId,
+	}
+	if err = forged.SignUserId(ident.UserId.Id, entity.PrimaryKey, other.PrivateKey, nil); err != nil {
+		t.Fatal("Expected no error while certifying user ID, got:", err)
+	}
+
+	subKey := entity.Subkeys[0]
+	certified := armorTestPackets(
+		t, entity.PrimaryKey, ident.UserId, ident.SelfSignature, certification, forged, revocation,
+		subKey.PublicKey, subKey.Sig,
+	)
+	expected, err := pgp.CleanKey(armorTestPackets(
+		t, entity.PrimaryKey, ident.UserId, ident.SelfSignature, revocation, subKey.PublicKey, subKey.Sig,
+	))
+	if err != nil {
+		t.Fatal("Expected no error while cleaning key, got:", err)
+	}
+
+	stripped, err := pgp.StripForeignCertifications(certified)
+	if err != nil {
+		t.Fatal("Expected no error while stripping key, got:", err)
+	}
+	assert.Exactly(t, expected, stripped)
+
+	_, err = pgp.StripForeignCertifications(readTestFile("keyring_privateKey", false))
+	assert.EqualError(t, err, "gopenpgp: cannot strip private key")
+}
+
+func TestMergeKeys(t *testing.T) {
+	entity := generateTestEntity(t, name, name+"@"+domain)
+	other := generateTestEntity(t, "Other", "other@example.com")
+
+	ident := entity.Identities[name+" <"+name+"@"+domain+">"]
+	certification := &packet.Signature{
+		SigType:      packet.SigTypeGenericCert,
+		PubKeyAlgo:   other.PrimaryKey.PubKeyAlgo,
+		Hash:         crypto.SHA256,
+		CreationTime: time.Now(),
+		IssuerKeyId:  &other.PrimaryKey.KeyId,
+	}
+	if err = certification.SignUserId(ident.UserId.Id, entity.PrimaryKey, other.PrivateKey, nil); err != nil {
+		t.Fatal("Expected no error while certifying user ID, got:", err)
+	}
+
+	secondUserID := packet.NewUserId("Second", "", "second@example.com")
+	secondSelfSig := *ident.SelfSignature
+	if err = secondSelfSig.SignUserId(secondUserID.Id, entity.PrimaryKey, entity.PrivateKey, nil); err != nil {
+		t.Fatal("Expected no error while signing user ID, got:", err)
+	}
+
+	subKey := entity.Subkeys[0]
+	a := armorTestPackets(t, entity.PrimaryKey, ident.UserId, ident.SelfSignature, certification, subKey.PublicKey, subKey.Sig)
+	b := armorTestPackets(
+		t, entity.PrimaryKey, ident.UserId, ident.SelfSignature, secondUserID, &secondSelfSig,
+		subKey.PublicKey, subKey.Sig,
+	)
+
+	merged, err := pgp.MergeKeys(a, b)
+	if err != nil {
+		t.Fatal("Expected no error while merging keys, got:", err)
+	}
+	reversed, err := pgp.MergeKeys(b, a)
+	if err != nil {
+		t.Fatal("Expected no error while merging keys, got:", err)
+	}
+	assert.Exactly(t, merged, reversed)
+
+	mergedKeyRing, err := pgp.BuildKeyRingArmored(merged)
+	if err != nil {
+		t.Fatal("Expected no error while reading merged key, got:", err)
+	}
+	mergedEntity := mergedKeyRing.GetEntities()[0]
+	assert.Len(t, mergedEntity.Identities, 2)
+	assert.Len(t, mergedEntity.Identities[ident.UserId.Id].Signatures, 2)
+	assert.Len(t, mergedEntity.Subkeys, 1)
+
+	otherKey := armorTestPackets(t, other.PrimaryKey, other.Identities["Other <other@example.com>"].UserId,
+		other.Identities["Other <other@example.com>"].SelfSignature)
+	_, err = pgp.MergeKeys(a, otherKey)
+	assert.EqualError(t, err, fmt.Sprintf(
+		"gopenpgp: cannot merge different keys %x and %x", entity.PrimaryKey.Fingerprint, other.PrimaryKey.Fingerprint,
+	))
+}
+
+func TestVerifyUserIDBinding(t *testing.T) {
+	entity := generateTestEntity(t, name, name+"@"+domain)
+	email := name + "@" + domain
+	ident := entity.Identities[name+" <"+email+">"]
+	created := ident.SelfSignature.CreationTime.Unix()
+
+	armored := armorTestPackets(t, entity.PrimaryKey, ident.UserId, ident.SelfSignature)
+	assert.NoError(t, pgp.VerifyUserIDBinding(armored, strings.ToUpper(email), created+60))
+
+	err = pgp.VerifyUserIDBinding(armored, email, created-60)
+	assert.Exactly(t, constants.ErrorCodeBadSignature, GetErrorCode(err))
+
+	err = pgp.VerifyUserIDBinding(armored, "other@"+domain, created+60)
+	assert.EqualError(t, err, "gopenpgp: key has no user ID with email other@"+domain)
+
+	expiringSig := *ident.SelfSignature
+	lifetime := uint32(3600)
+	expiringSig.KeyLifetimeSecs = &lifetime
+	if err = expiringSig.SignUserId(ident.UserId.Id, entity.PrimaryKey, entity.PrivateKey, nil); err != nil {
+		t.Fatal("Expected no error while signing user ID, got:", err)
+	}
+	expiring := armorTestPackets(t, entity.PrimaryKey, ident.UserId, &expiringSig)
+	assert.NoError(t, pgp.VerifyUserIDBinding(expiring, email, created+60))
+	err = pgp.VerifyUserIDBinding(expiring, email, created+7200)
+	assert.Exactly(t, constants.ErrorCodeKeyExpired, GetErrorCode(err))
+
+	revocation := &packet.Signature{
+		SigType:      sigTypeCertificationRevocation,
+		PubKeyAlgo:   entity.PrimaryKey.PubKeyAlgo,
+		Hash:         crypto.SHA256,
+		CreationTime: time.Unix(created+600, 0),
+		IssuerKeyId:  &entity.PrimaryKey.KeyId,
+	}
+	if err = revocation.SignUserId(ident.UserId.Id, entity.PrimaryKey, entity.PrivateKey, nil); err != nil {
+		t.Fatal("Expected no error while revoking user ID, got:", err)
+	}
+	revoked := armorTestPackets(t, entity.PrimaryKey, ident.UserId, ident.SelfSignature, revocation)
+	assert.NoError(t, pgp.VerifyUserIDBinding(revoked, email, created+60))
+	err = pgp.VerifyUserIDBinding(revoked, email, created+1200)
+	assert.EqualError(t, err, "gopenpgp: user ID \""+ident.Name+"\" is revoked")
+	assert.Exactly(t, constants.ErrorCodeKeyRevoked, GetErrorCode(err))
+}
+
+func TestGenerateRevocationCertificate(t *testing.T) {
+	keyRing, err := ReadArmoredKeyRing(strings.NewReader(readTestFile("keyring_privateKey", false)))
+	if err != nil {
+		t.Fatal("Expected no error while reading key, got:", err)
+	}
+
+	_, err = pgp.GenerateRevocationCertificate(keyRing, []byte("wrong"), constants.RevocationReasonKeyCompromised, "")
+	assert.Regexp(t, "^gopenpgp: cannot unlock key 3eb6259edf21df24: ", err.Error())
+
+	_, err = pgp.GenerateRevocationCertificate(keyRing, []byte(testMailboxPassword), 42, "")
+	assert.EqualError(t, err, "gopenpgp: invalid revocation reason 42")
+
+	certificate, err := pgp.GenerateRevocationCertificate(
+		keyRing, []byte(testMailboxPassword), constants.RevocationReasonKeySuperseded, "replaced by a new key",
+	)
+	if err != nil {
+		t.Fatal("Expected no error while generating revocation certificate, got:", err)
+	}
+
+	rTest := regexp.MustCompile("(?s)^-----BEGIN PGP PUBLIC KEY BLOCK-----.*-----END PGP PUBLIC KEY BLOCK-----$")
+	assert.Regexp(t, rTest, certificate)
+
+	locked, _ := keyRing.IsLocked()
+	assert.True(t, locked)
+
+	rawCertificate, err := armor.Unarmor(certificate)
+	if err != nil {
+		t.Fatal("Expected no error while unarmoring certificate, got:", err)
+	}
+	p, err := packet.Read(bytes.NewReader(rawCertificate))
+	if err != nil {
+		t.Fatal("Expected no error while reading certificate, got:", err)
+	}
+	sig, ok := p.(*packet.Signature)
+	if !ok {
+		t.Fatal("Expected a signature packet")
+	}
+
+	assert.Exactly(t, packet.SignatureType(packet.SigTypeKeyRevocation), sig.SigType)
+	assert.Exactly(t, uint8(constants.RevocationReasonKeySuperseded), *sig.RevocationReason)
+	assert.Exactly(t, "replaced by a new key", sig.RevocationReasonText)
+	assert.NoError(t, keyRing.GetEntities()[0].PrimaryKey.VerifyRevocationSignature(sig))
+}
+
+func TestVerifyKeyStructure(t *testing.T) {
+	assert.NoError(t, pgp.VerifyKeyStructure(readTestFile("keyring_publicKey", false)))
+	assert.NoError(t, pgp.VerifyKeyStructure(readTestFile("keyring_privateKey", false)))
+
+	entity := generateTestEntity(t, name, name+"@"+domain)
+	signingKey, err := xrsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal("Expected no error while generating subkey, got:", err)
+	}
+	now := time.Now()
+	subKey := packet.NewRSAPublicKey(now, &signingKey.PublicKey)
+	subKey.IsSubkey = true
+	sig := &packet.Signature{
+		SigType:      packet.SigTypeSubkeyBinding,
+		PubKeyAlgo:   entity.PrimaryKey.PubKeyAlgo,
+		Hash:         crypto.SHA256,
+		CreationTime: now,
+		IssuerKeyId:  &entity.PrimaryKey.KeyId,
+		FlagsValid:   true,
+		FlagSign:     true,
+	}
+	if err = sig.SignKey(subKey, entity.PrivateKey, nil); err != nil {
+		t.Fatal("Expected no error while signing subkey, got:", err)
+	}
+	entity.Subkeys = append(entity.Subkeys, openpgp.Subkey{PublicKey: subKey, Sig: sig})
+
+	var serialized bytes.Buffer
+	if err = entity.Serialize(&serialized); err != nil {
+		t.Fatal("Expected no error while serializing key, got:", err)
+	}
+	armored, err := armor.ArmorWithType(serialized.Bytes(), constants.PublicKeyHeader)
+	if err != nil {
+		t.Fatal("Expected no error while armoring key, got:", err)
+	}
+	err = pgp.VerifyKeyStructure(armored)
+	assert.EqualError(t, err, fmt.Sprintf("gopenpgp: signing subkey %x has no primary key binding signature", subKey.KeyId))
+
+	// Bind the subkey with a signature over another key
+	sig.FlagSign = false
+	if err = sig.SignKey(entity.Subkeys[0].PublicKey, entity.PrivateKey, nil); err != nil {
+		t.Fatal("Expected no error while signing subkey, got:", err)
+	}
+	serialized.Reset()
+	if err = entity.Serialize(&serialized); err != nil {
+		t.Fatal("Expected no error while serializing key, got:", err)
+	}
+	armored, err = armor.ArmorWithType(serialized.Bytes(), constants.PublicKeyHeader)
+	if err != nil {
+		t.Fatal("Expected no error while armoring key, got:", err)
+	}
+	err = pgp.VerifyKeyStructure(armored)
+	assert.Regexp(t, fmt.Sprintf("^gopenpgp: invalid binding signature of subkey %x: ", subKey.KeyId), err.Error())
+}
@@ -7,12 +7,16 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"regexp"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
+	"golang.org/x/crypto/ed25519"
 	"golang.org/x/crypto/openpgp"
 	"golang.org/x/crypto/openpgp/armor"
 	pgperrors "golang.org/x/crypto/openpgp/errors"
@@ -42,8 +46,25 @@ func (ko *pgpKeyObject) PrivateKeyReader() io.Reader {
 
 // Identity contains the name and the email of a key holder.
 type Identity struct {
-	Name  string
-	Email string
+	Name    string
+	Email   string
+	Comment string
+	// SelfSignatureValid is set by GetIdentities if the identity has a self
+	// signature by the primary key that verifies, hasn't expired and hasn't
+	// been revoked.
+	SelfSignatureValid bool
+}
+
+// SubkeyInfo contains the public details of a primary key or subkey.
+type SubkeyInfo struct {
+	KeyID       uint64
+	Fingerprint string
+	// Creation and expiration time as unix timestamps, ExpirationTime is 0 if
+	// the key doesn't expire.
+	CreationTime   int64
+	ExpirationTime int64
+	CanSign        bool
+	CanEncrypt     bool
 }
 
 // Signature is be used to check a signature. Because the signature is checked
@@ -52,12 +73,26 @@ type Identity struct {
 // sender's identity cannot be trusted.
 type Signature struct {
 	md *openpgp.MessageDetails
+	kr *KeyRing // Key ring that read the message
 }
 
 // SignedString wraps string with a Signature
 type SignedString struct {
 	String string
 	Signed *Signature
+	// KeyID is the ID of the key that decrypted the message
+	KeyID uint64
+}
+
+var pubKeyAlgos = map[packet.PublicKeyAlgorithm]string{
+	packet.PubKeyAlgoRSA:            "rsa",
+	packet.PubKeyAlgoRSAEncryptOnly: "rsa",
+	packet.PubKeyAlgoRSASignOnly:    "rsa",
+	packet.PubKeyAlgoElGamal:        "elgamal",
+	packet.PubKeyAlgoDSA:            "dsa",
+	packet.PubKeyAlgoECDH:           "ecdh",
+	packet.PubKeyAlgoECDSA:          "ecdsa",
+	packet.PubKeyAlgoEdDSA:          "eddsa",
 }
 
 var errKeyringNotUnlocked = errors.New("gopenpgp: cannot sign message, key ring is not unlocked")
@@ -75,7 +110,8 @@ func (s *Signature) KeyRing() *KeyRing {
 	}
 
 	return &KeyRing{
-		entities: openpgp.EntityList{s.md.SignedBy.Entity},
+		entities:   openpgp.EntityList{s.md.SignedBy.Entity},
+		lockedKeys: s.kr.getLockedKeys(),
 	}
 }
 
@@ -106,6 +142,20 @@ type KeyRing struct {
 
 	// FirstKeyID as obtained from API to match salt
 	FirstKeyID string
+
+	// Locked copies of the private keys unlocked with a passphrase, used by
+	// Lock to restore them. Allocated under lockedKeysMutex, and shared with
+	// the key rings returned by Signature.KeyRing.
+	lockedKeys      *lockedKeys
+	lockedKeysMutex sync.Mutex
+}
+
+// lockedKeys are the locked copies of the private keys of a key ring. They are
+// updated when keys are unlocked while decrypting or signing with a shared
+// KeyRing, so they are guarded by their mutex.
+type lockedKeys struct {
+	sync.Mutex
+	keys map[*packet.PrivateKey]packet.PrivateKey
 }
 
 // GetEntities returns openpgp entities contained in this KeyRing.
@@ -120,10 +170,8 @@ func (kr *KeyRing) GetSigningEntity(passphrase string) (*openpgp.Entity, error)
 	for _, e := range kr.entities {
 		// Entity.PrivateKey must be a signing key
 		if e.PrivateKey != nil {
-			if e.PrivateKey.Encrypted {
-				if err := e.PrivateKey.Decrypt([]byte(passphrase)); err != nil {
-					continue
-				}
+			if err := kr.unlockKey(e.PrivateKey, []byte(passphrase)); err != nil {
+				continue
 			}
 			signEntity = e
 			break
@@ -137,6 +185,56 @@ func (kr *KeyRing) GetSigningEntity(passphrase string) (*openpgp.Entity, error)
 	return signEntity, nil
 }
 
+// getUnlockedSigningEntity returns the first entity from the keyring whose
+// private key is unlocked.
+func (kr *KeyRing) getUnlockedSigningEntity() (*openpgp.Entity, error) {
+	// To sign a message, the private key must be decrypted
+	for _, e := range kr.entities {
+		// Entity.PrivateKey must be a signing key
+		if e.PrivateKey != nil && !e.PrivateKey.Encrypted {
+			return e, nil
+		}
+	}
+	return nil, errKeyringNotUnlocked
+}
+
+// getSigningKey returns the first unlocked signing key from the keyring,
+// preferring signing subkeys over the primary key. If only locked signing keys
+// are available, errKeyringNotUnlocked is returned.
+func (kr *KeyRing) getSigningKey(now time.Time) (*packet.PrivateKey, error) {
+	var locked bool
+	for _, e := range kr.entities {
+		for _, subKey := range e.Subkeys {
+			if subKey.PrivateKey == nil || !subKey.Sig.FlagsValid || !subKey.Sig.FlagSign ||
+				!subKey.PublicKey.PubKeyAlgo.CanSign() || subKey.PublicKey.KeyExpired(subKey.Sig, now) {
+				continue
+			}
+			if subKey.PrivateKey.Encrypted {
+				locked = true
+				continue
+			}
+			return subKey.PrivateKey, nil
+		}
+
+		if e.PrivateKey == nil || !e.PrimaryKey.PubKeyAlgo.CanSign() {
+			continue
+		}
+		if id := getPrimaryIdentity(e); id != nil && id.SelfSignature.FlagsValid && !id.SelfSignature.FlagSign {
+			continue
+		}
+		if e.PrivateKey.Encrypted {
+			locked = true
+			continue
+		}
+		return e.PrivateKey, nil
+	}
+
+	if locked {
+		return nil, errKeyringNotUnlocked
+	}
+	return nil, errors.New("gopenpgp: cannot sign message, no signing key found")
+}
+
 // Encrypt encrypts data to this keyring's owner. If sign is not nil, it also
 // signs data with it. The keyring sign must be unlocked to be able to sign data,
 // if not an error will be returned.
@@ -151,17 +249,9 @@ func (kr *KeyRing) Encrypt(w io.Writer, sign *KeyRing, filename string, canonica
 
 	var signEntity *openpgp.Entity
 	if sign != nil {
-		// To sign a message, the private key must be decrypted
-		for _, e := range sign.entities {
-			// Entity.PrivateKey must be a signing key
-			if e.PrivateKey != nil && !e.PrivateKey.Encrypted {
-				signEntity = e
-				break
-			}
-		}
-
-		if signEntity == nil {
-			return nil, errKeyringNotUnlocked
+		var err error
+		if signEntity, err = sign.getUnlockedSigningEntity(); err != nil {
+			return nil, err
 		}
 	}
 
@@ -174,22 +264,183 @@ func (kr *KeyRing) Encrypt(w io.Writer, sign *KeyRing, filename string, canonica
 		func() time.Time { return GetGopenPGP().GetTime() })
 }
 
-// EncryptCore is lower-level encryption method used by KeyRing.Encrypt.
+// EncryptCore is lower-level encryption method used by KeyRing.Encrypt. The
+// cipher is negotiated with the settings of the global GopenPGP.
 func EncryptCore(w io.Writer, encryptEntities []*openpgp.Entity, signEntity *openpgp.Entity, filename string,
 	canonicalizeText bool, timeGenerator func() time.Time) (io.WriteCloser, error) {
+	config := pgp.getEncryptConfig(encryptEntities)
+	config.Time = timeGenerator
+	return encryptCore(w, encryptEntities, signEntity, filename, canonicalizeText, config)
+}
 
-	config := &packet.Config{DefaultCipher: packet.CipherAES256, Time: timeGenerator}
-
+// encryptCore is like EncryptCore, but with the cipher, hash and time of
+// config.
+func encryptCore(w io.Writer, encryptEntities []*openpgp.Entity, signEntity *openpgp.Entity, filename string,
+	canonicalizeText bool, config *packet.Config) (io.WriteCloser, error) {
 	hints := &openpgp.FileHints{
 		IsBinary: !canonicalizeText,
 		FileName: filename,
 	}
+	return encryptWithConfig(w, encryptEntities, signEntity, hints, config, canonicalizeText)
+}
+
+// openpgpCiphers are the ciphers openpgp.Encrypt chooses from.
+var openpgpCiphers = []packet.CipherFunction{packet.CipherAES128, packet.CipherAES256, packet.CipherCAST5}
+
+// openpgpAcceptsCipher returns whether openpgp.Encrypt encrypts to recipients
+// with c. It only uses one of openpgpCiphers that the identities of all
+// recipients prefer, and assumes that identities without cipher preferences
+// only accept CAST5.
+func openpgpAcceptsCipher(recipients []*openpgp.Entity, c packet.CipherFunction) bool {
+	if !containsCipher(openpgpCiphers, c) {
+		return false
+	}
+	for _, e := range recipients {
+		if len(e.Identities) == 0 {
+			return false
+		}
+		for _, i := range e.Identities {
+			if i.SelfSignature == nil || !containsPreference(i.SelfSignature.PreferredSymmetric, c) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// encryptWithConfig encrypts to encryptEntities with the cipher, hash and
+// compression of config, canonicalizing the line endings of text as
+// openpgp.EncryptText does if canonicalizeText is set. Recipients whose
+// encryption key is expired or revoked are rejected. If openpgp.Encrypt
+// wouldn't use the cipher, see openpgpAcceptsCipher, the message is written by
+// encryptWithCipher.
+func encryptWithConfig(w io.Writer, encryptEntities []*openpgp.Entity, signEntity *openpgp.Entity,
+	hints *openpgp.FileHints, config *packet.Config, canonicalizeText bool) (io.WriteCloser, error) {
+	if len(encryptEntities) == 0 {
+		return nil, errors.New("gopenpgp: cannot encrypt message, no recipient provided")
+	}
+	for _, e := range encryptEntities {
+		if _, err := getRecipientEncryptionKey(e, config.Now()); err != nil {
+			return nil, err
+		}
+	}
+
+	if !openpgpAcceptsCipher(encryptEntities, config.Cipher()) {
+		ew, err := encryptWithCipher(w, encryptEntities, signEntity, hints, config)
+		if err != nil || !canonicalizeText {
+			return ew, err
+		}
+		return &canonicalTextWriter{w: ew}, nil
+	}
 	if canonicalizeText {
 		return openpgp.EncryptText(w, encryptEntities, signEntity, hints, config)
 	}
 	return openpgp.Encrypt(w, encryptEntities, signEntity, hints, config)
 }
 
+// encryptWithCipher is like openpgp.Encrypt, but always uses the cipher of
+// config instead of negotiating it with the preferences of the recipients.
+func encryptWithCipher(w io.Writer, encryptEntities []*openpgp.Entity, signEntity *openpgp.Entity,
+	hints *openpgp.FileHints, config *packet.Config) (io.WriteCloser, error) {
+	cipher := config.Cipher()
+	symKey := make([]byte, cipher.KeySize())
+	if _, err := io.ReadFull(config.Random(), symKey); err != nil {
+		return nil, err
+	}
+
+	for _, e := range encryptEntities {
+		pub, err := getRecipientEncryptionKey(e, config.Now())
+		if err != nil {
+			return nil, err
+		}
+		if err = serializeEncryptedKey(w, pub, cipher, symKey, config); err != nil {
+			return nil, err
+		}
+	}
+
+	ew, err := packet.SerializeSymmetricallyEncrypted(w, cipher, symKey, config)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Compression() == packet.CompressionNone {
+		return writeLiteral(ew, signEntity, hints, config)
+	}
+	cw, err := packet.SerializeCompressed(ew, config.Compression(), config.CompressionConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return writeLiteral(cw, signEntity, hints, config)
+}
+
+// writeLiteral writes the literal data to the compressed or encrypted data w,
+// signed by signEntity if not nil.
+func writeLiteral(w io.WriteCloser, signEntity *openpgp.Entity,
+	hints *openpgp.FileHints, config *packet.Config) (io.WriteCloser, error) {
+	if signEntity == nil {
+		// Closing the literal data also closes the compressed and encrypted data
+		var epochSeconds uint32
+		if !hints.ModTime.IsZero() {
+			epochSeconds = uint32(hints.ModTime.Unix())
+		}
+		return packet.SerializeLiteral(w, hints.IsBinary, hints.FileName, epochSeconds)
+	}
+
+	sw, err := openpgp.Sign(w, signEntity, hints, config)
+	if err != nil {
+		return nil, err
+	}
+	return &signCompressWriter{sw: sw, cw: w}, nil
+}
+
+// An io.WriteCloser that converts the line endings of the text written to it
+// to CRLF, as required for text mode literal data.
+type canonicalTextWriter struct {
+	w      io.WriteCloser
+	lastCR bool
+}
+
+// Write canonicalized text
+func (w *canonicalTextWriter) Write(b []byte) (n int, err error) {
+	canonical := make([]byte, 0, len(b))
+	for _, c := range b {
+		if c == '\n' && !w.lastCR {
+			canonical = append(canonical, '\r')
+		}
+		canonical = append(canonical, c)
+		w.lastCR = c == '\r'
+	}
+	if _, err = w.w.Write(canonical); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Close the underlying io.WriteCloser
+func (w *canonicalTextWriter) Close() error {
+	return w.w.Close()
+}
+
+// An io.WriteCloser that signs data and then closes the compressed data.
+type signCompressWriter struct {
+	sw io.WriteCloser // Signed writer
+	cw io.WriteCloser // Compressed writer
+}
+
+// Write signed data
+func (w *signCompressWriter) Write(b []byte) (n int, err error) {
+	return w.sw.Write(b)
+}
+
+// Close signature and compression io.WriteClose
+func (w *signCompressWriter) Close() (err error) {
+	if err = w.sw.Close(); err != nil {
+		return
+	}
+	return w.cw.Close()
+}
+
 // An io.WriteCloser that both encrypts and armors data.
 type armorEncryptWriter struct {
 	aw io.WriteCloser // Armored writer
@@ -275,19 +526,28 @@ func (kr *KeyRing) EncryptSymmetric(textToEncrypt string, canonicalizeText bool)
 // DecryptMessage decrypts an armored string sent to the keypair's owner.
 // If error is errors.ErrSignatureExpired (from golang.org/x/crypto/openpgp/errors),
 // contents are still provided if library clients wish to process this message further.
-func (kr *KeyRing) DecryptMessage(encrypted string) (SignedString, error) {
-	r, signed, err := kr.DecryptArmored(strings.NewReader(encrypted))
+func (kr *KeyRing) DecryptMessage(encrypted string) (decrypted SignedString, err error) {
+	defer recoverMalformedInput(&err)
+
+	md, err := kr.readArmoredMessage(strings.NewReader(encrypted))
 	if err != nil && err != pgperrors.ErrSignatureExpired {
 		return SignedString{String: encrypted, Signed: nil}, err
 	}
 
-	b, err := ioutil.ReadAll(r)
+	b, err := ioutil.ReadAll(md.UnverifiedBody)
 	if err != nil && err != pgperrors.ErrSignatureExpired {
 		return SignedString{String: encrypted, Signed: nil}, err
 	}
 
 	s := string(b)
-	return SignedString{String: s, Signed: signed}, nil
+	signed := SignedString{String: s}
+	if md.IsSigned {
+		signed.Signed = &Signature{md: md, kr: kr}
+	}
+	if md.DecryptedWith.PublicKey != nil {
+		signed.KeyID = md.DecryptedWith.PublicKey.KeyId
+	}
+	return signed, nil
 }
 
 // DecryptMessageIfNeeded data if has armored PGP message format, if not return original data.
@@ -320,10 +580,10 @@ func (kr *KeyRing) Unlock(passphrase []byte) error {
 			keys = append(keys, e.PrivateKey)
 		}
 
-		// Entity.Subkeys can be used for encryption
+		// Entity.Subkeys can be used for encryption and signing
 		for _, subKey := range e.Subkeys {
 			if subKey.PrivateKey != nil && (!subKey.Sig.FlagsValid || subKey.Sig.FlagEncryptStorage ||
-				subKey.Sig.FlagEncryptCommunications) {
+				subKey.Sig.FlagEncryptCommunications || subKey.Sig.FlagSign) {
 
 				keys = append(keys, subKey.PrivateKey)
 			}
@@ -334,37 +594,143 @@ func (kr *KeyRing) Unlock(passphrase []byte) error {
 		return errors.New("gopenpgp: cannot unlock key ring, no private key available")
 	}
 
-	var err error
+	var firstErr error
 	var n int
 	for _, key := range keys {
 		if !key.Encrypted {
 			continue // Key already decrypted
 		}
 
-		if err = key.Decrypt(passphrase); err == nil {
-			n++
+		if err := kr.unlockKey(key, passphrase); err != nil {
+			if firstErr == nil {
+				firstErr = &CryptoError{
+					Code:    constants.ErrorCodeWrongPassphrase,
+					Message: fmt.Sprintf("gopenpgp: cannot unlock key %x: %v", key.KeyId, err),
+					cause:   err,
+				}
+			}
+			continue
 		}
+		n++
 	}
 
 	if n == 0 {
+		return firstErr
+	}
+	return nil
+}
+
+// Lock re-locks the keys that were unlocked with a passphrase, discarding
+// their decrypted key material. An error is returned if the keyring contains
+// unlocked keys that are not passphrase protected, as they can't be locked.
+func (kr *KeyRing) Lock() error {
+	copies := kr.getLockedKeys()
+	copies.Lock()
+	for key, locked := range copies.keys {
+		*key = locked
+		delete(copies.keys, key)
+	}
+	copies.Unlock()
+
+	for _, e := range kr.entities {
+		if e.PrivateKey != nil && !e.PrivateKey.Encrypted {
+			return fmt.Errorf("gopenpgp: cannot lock key %x, it is not passphrase protected", e.PrivateKey.KeyId)
+		}
+		for _, subKey := range e.Subkeys {
+			if subKey.PrivateKey != nil && !subKey.PrivateKey.Encrypted {
+				return fmt.Errorf("gopenpgp: cannot lock key %x, it is not passphrase protected", subKey.PrivateKey.KeyId)
+			}
+		}
+	}
+	return nil
+}
+
+// unlockKey decrypts key, a private key of kr, with passphrase if it is
+// encrypted, and remembers its locked copy for Lock. Every key of kr that is
+// decrypted in place must be unlocked with it.
+func (kr *KeyRing) unlockKey(key *packet.PrivateKey, passphrase []byte) error {
+	if !key.Encrypted {
+		return nil
+	}
+
+	locked := *key
+	if err := key.Decrypt(passphrase); err != nil {
 		return err
 	}
+
+	copies := kr.getLockedKeys()
+	copies.Lock()
+	defer copies.Unlock()
+	copies.keys[key] = locked
 	return nil
 }
 
+// getLockedKey returns the locked copy of key if it was unlocked with unlockKey.
+func (kr *KeyRing) getLockedKey(key *packet.PrivateKey) (locked packet.PrivateKey, ok bool) {
+	copies := kr.getLockedKeys()
+	copies.Lock()
+	defer copies.Unlock()
+	locked, ok = copies.keys[key]
+	return locked, ok
+}
+
+// getLockedKeys returns the locked copies of the keys of kr, allocating them
+// so that they can be shared with other key rings.
+func (kr *KeyRing) getLockedKeys() *lockedKeys {
+	if kr == nil {
+		return nil
+	}
+	kr.lockedKeysMutex.Lock()
+	defer kr.lockedKeysMutex.Unlock()
+	if kr.lockedKeys == nil {
+		kr.lockedKeys = &lockedKeys{keys: make(map[*packet.PrivateKey]packet.PrivateKey)}
+	}
+	return kr.lockedKeys
+}
+
+// IsLocked returns true if none of the private keys in the keyring are
+// unlocked.
+func (kr *KeyRing) IsLocked() (bool, error) {
+	var hasPrivateKey bool
+	for _, e := range kr.entities {
+		if e.PrivateKey != nil {
+			hasPrivateKey = true
+			if !e.PrivateKey.Encrypted {
+				return false, nil
+			}
+		}
+		for _, subKey := range e.Subkeys {
+			if subKey.PrivateKey != nil {
+				hasPrivateKey = true
+				if !subKey.PrivateKey.Encrypted {
+					return false, nil
+				}
+			}
+		}
+	}
+
+	if !hasPrivateKey {
+		return false, errors.New("gopenpgp: key ring has no private key")
+	}
+	return true, nil
+}
+
 // Decrypt decrypts a message sent to the keypair's owner. If the message is not
 // signed, signed will be nil.
 // If error is errors.ErrSignatureExpired (from golang.org/x/crypto/openpgp/errors),
 // contents are still provided if library clients wish to process this message further.
 func (kr *KeyRing) Decrypt(r io.Reader) (decrypted io.Reader, signed *Signature, err error) {
+	defer recoverMalformedInput(&err)
+
 	md, err := openpgp.ReadMessage(r, kr.entities, nil, nil)
 	if err != nil && err != pgperrors.ErrSignatureExpired {
+		err = convertReadMessageError(err)
 		return
 	}
 
-	decrypted = md.UnverifiedBody
+	decrypted = &recoverReader{r: pgp.limitDecompressedSize(md.UnverifiedBody)}
 	if md.IsSigned {
-		signed = &Signature{md}
+		signed = &Signature{md: md, kr: kr}
 	}
 	return
 }
@@ -373,6 +739,8 @@ func (kr *KeyRing) Decrypt(r io.Reader) (decrypted io.Reader, signed *Signature,
 // If error is errors.ErrSignatureExpired (from golang.org/x/crypto/openpgp/errors),
 // contents are still provided if library clients wish to process this message further.
 func (kr *KeyRing) DecryptArmored(r io.Reader) (decrypted io.Reader, signed *Signature, err error) {
+	defer recoverMalformedInput(&err)
+
 	block, err := armor.Decode(r)
 	if err != nil && err != pgperrors.ErrSignatureExpired {
 		return
@@ -386,6 +754,38 @@ func (kr *KeyRing) DecryptArmored(r io.Reader) (decrypted io.Reader, signed *Sig
 	return kr.Decrypt(block.Body)
 }
 
+// readArmoredMessage unarmors and reads a message sent to the keypair's owner,
+// trying every unlocked private key of the keyring.
+func (kr *KeyRing) readArmoredMessage(r io.Reader) (*openpgp.MessageDetails, error) {
+	block, err := armor.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if block.Type != constants.PGPMessageHeader {
+		return nil, errors.New("gopenpgp: not an armored PGP message")
+	}
+
+	md, err := openpgp.ReadMessage(block.Body, kr.entities, nil, nil)
+	if err != nil {
+		return nil, convertReadMessageError(err)
+	}
+	md.UnverifiedBody = pgp.limitDecompressedSize(md.UnverifiedBody)
+	return md, nil
+}
+
+// DecryptionKeyIds returns the IDs of the unlocked private keys in the keyring
+// that can be used to decrypt messages.
+func (kr *KeyRing) DecryptionKeyIds() []uint64 {
+	var res []uint64
+	for _, k := range kr.entities.DecryptionKeys() {
+		if k.PrivateKey != nil && !k.PrivateKey.Encrypted {
+			res = append(res, k.PrivateKey.KeyId)
+		}
+	}
+	return res
+}
+
 // WriteArmoredPublicKey outputs armored public keys from the keyring to w.
 func (kr *KeyRing) WriteArmoredPublicKey(w io.Writer) (err error) {
 	aw, err := armor.Encode(w, openpgp.PublicKeyType, nil)
@@ -446,6 +846,39 @@ func (kr *KeyRing) GetFingerprint() (string, error) {
 	return "", errors.New("can't find public key")
 }
 
+// GetAlgorithm returns the public key algorithm of the primary key from the
+// keyring, e.g. "rsa" or "eddsa".
+func (kr *KeyRing) GetAlgorithm() (string, error) {
+	for _, entity := range kr.entities {
+		algo, ok := pubKeyAlgos[entity.PrimaryKey.PubKeyAlgo]
+		if !ok {
+			return "", fmt.Errorf("gopenpgp: unknown public key algorithm: %v", entity.PrimaryKey.PubKeyAlgo)
+		}
+		return algo, nil
+	}
+	return "", errors.New("can't find public key")
+}
+
+// GetBitLength returns the bit length of the primary key from the keyring. For
+// elliptic curve keys, this is the size of the curve.
+func (kr *KeyRing) GetBitLength() (int, error) {
+	for _, entity := range kr.entities {
+		switch pub := entity.PrimaryKey.PublicKey.(type) {
+		case *ecdsa.PublicKey:
+			return pub.Curve.Params().BitSize, nil
+		case ed25519.PublicKey:
+			return 255, nil
+		}
+
+		bitLength, err := entity.PrimaryKey.BitLength()
+		if err != nil {
+			return 0, err
+		}
+		return int(bitLength), nil
+	}
+	return 0, errors.New("can't find public key")
+}
+
 // CheckPassphrase checks if private key passphrase is correct for every sub key.
 func (kr *KeyRing) CheckPassphrase(passphrase string) bool {
 	var keys []*packet.PrivateKey
@@ -459,7 +892,7 @@ func (kr *KeyRing) CheckPassphrase(passphrase string) bool {
 		if !key.Encrypted {
 			continue // Key already decrypted
 		}
-		if decryptError = key.Decrypt([]byte(passphrase)); decryptError == nil {
+		if decryptError = kr.unlockKey(key, []byte(passphrase)); decryptError == nil {
 			n++
 		}
 	}
@@ -521,6 +954,8 @@ func (kr *KeyRing) readFrom(r io.Reader, armored bool) error {
 
 // BuildKeyRing reads keyring from binary data
 func (pgp *GopenPGP) BuildKeyRing(binKeys []byte) (kr *KeyRing, err error) {
+	defer recoverMalformedInput(&err)
+
 	kr = &KeyRing{}
 	entriesReader := bytes.NewReader(binKeys)
 	err = kr.readFrom(entriesReader, false)
@@ -536,6 +971,8 @@ func (pgp *GopenPGP) BuildKeyRingNoError(binKeys []byte) (kr *KeyRing) {
 
 // BuildKeyRingArmored reads armored string and returns keyring
 func (pgp *GopenPGP) BuildKeyRingArmored(key string) (kr *KeyRing, err error) {
+	defer recoverMalformedInput(&err)
+
 	keyRaw, err := armorUtils.Unarmor(key)
 	if err != nil {
 		return nil, err
@@ -585,6 +1022,221 @@ func (kr *KeyRing) Identities() []*Identity {
 	return identities
 }
 
+// GetIdentities returns the user IDs of every entity in this KeyRing, with the
+// validity of their self-signature. The identities of each entity are sorted
+// by user ID.
+func (kr *KeyRing) GetIdentities() []Identity {
+	now := pgp.getNow()
+	var identities []Identity
+	for _, e := range kr.entities {
+		var ids []string
+		for id := range e.Identities {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+
+		for _, id := range ids {
+			ident := e.Identities[id]
+			identities = append(identities, Identity{
+				Name:               ident.UserId.Name,
+				Email:              ident.UserId.Email,
+				Comment:            ident.UserId.Comment,
+				SelfSignatureValid: isSelfSignatureValid(e, ident, now),
+			})
+		}
+	}
+	return identities
+}
+
+// isSelfSignatureValid reports whether ident has a valid, unexpired and
+// unrevoked self-signature by the primary key of e.
+func isSelfSignatureValid(e *openpgp.Entity, ident *openpgp.Identity, now time.Time) bool {
+	sig := ident.SelfSignature
+	if sig == nil || sig.SigExpired(now) {
+		return false
+	}
+	if e.PrimaryKey.VerifyUserIdSignature(ident.Name, e.PrimaryKey, sig) != nil {
+		return false
+	}
+
+	for _, other := range ident.Signatures {
+		if other.SigType == sigTypeCertificationRevocation && other.IssuerKeyId != nil &&
+			*other.IssuerKeyId == e.PrimaryKey.KeyId &&
+			e.PrimaryKey.VerifyUserIdSignature(ident.Name, e.PrimaryKey, other) == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// GetSubkeyInfo returns the details of every key in this KeyRing. The primary
+// key of each entity comes first, followed by its subkeys.
+func (kr *KeyRing) GetSubkeyInfo() []SubkeyInfo {
+	var res []SubkeyInfo
+	for _, e := range kr.entities {
+		var primarySig *packet.Signature
+		if i := getPrimaryIdentity(e); i != nil {
+			primarySig = i.SelfSignature
+		}
+		res = append(res, newSubkeyInfo(e.PrimaryKey, primarySig))
+
+		for _, subKey := range e.Subkeys {
+			res = append(res, newSubkeyInfo(subKey.PublicKey, subKey.Sig))
+		}
+	}
+	return res
+}
+
+func newSubkeyInfo(pub *packet.PublicKey, sig *packet.Signature) SubkeyInfo {
+	info := SubkeyInfo{
+		KeyID:        pub.KeyId,
+		Fingerprint:  hex.EncodeToString(pub.Fingerprint[:]),
+		CreationTime: pub.CreationTime.Unix(),
+		CanSign:      pub.PubKeyAlgo.CanSign(),
+		CanEncrypt:   pub.PubKeyAlgo.CanEncrypt(),
+	}
+	if sig == nil {
+		return info
+	}
+
+	if sig.FlagsValid {
+		info.CanSign = info.CanSign && sig.FlagSign
+		info.CanEncrypt = info.CanEncrypt && (sig.FlagEncryptCommunications || sig.FlagEncryptStorage)
+	}
+	if sig.KeyLifetimeSecs != nil && *sig.KeyLifetimeSecs != 0 {
+		info.ExpirationTime = info.CreationTime + int64(*sig.KeyLifetimeSecs)
+	}
+	return info
+}
+
+// ExpiresIn returns the number of seconds from at, given as a Unix timestamp,
+// until the keyring expires, negative if it already has. neverExpires is true
+// if it doesn't expire. A key can't be encrypted to anymore once its primary
+// key or all of its encryption subkeys have expired, whichever comes first, and
+// the soonest such expiry of the keys in the keyring is used.
+func (kr *KeyRing) ExpiresIn(at int64) (seconds int64, neverExpires bool) {
+	var expirationTime int64
+	for _, e := range kr.entities {
+		t := getEntityExpirationTime(e)
+		if t != 0 && (expirationTime == 0 || t < expirationTime) {
+			expirationTime = t
+		}
+	}
+	if expirationTime == 0 {
+		return 0, true
+	}
+	return expirationTime - at, false
+}
+
+// getEntityExpirationTime returns the Unix time at which e expires, see
+// ExpiresIn, or 0 if it doesn't expire.
+func getEntityExpirationTime(e *openpgp.Entity) int64 {
+	var primarySig *packet.Signature
+	if i := getPrimaryIdentity(e); i != nil {
+		primarySig = i.SelfSignature
+	}
+	expirationTime := newSubkeyInfo(e.PrimaryKey, primarySig).ExpirationTime
+
+	// The encryption subkeys expire with the last of them
+	var subkeysExpirationTime int64
+	for _, subKey := range e.Subkeys {
+		info := newSubkeyInfo(subKey.PublicKey, subKey.Sig)
+		if !info.CanEncrypt {
+			continue
+		}
+		if info.ExpirationTime == 0 {
+			return expirationTime
+		}
+		if info.ExpirationTime > subkeysExpirationTime {
+			subkeysExpirationTime = info.ExpirationTime
+		}
+	}
+
+	if expirationTime == 0 || (subkeysExpirationTime != 0 && subkeysExpirationTime < expirationTime) {
+		return subkeysExpirationTime
+	}
+	return expirationTime
+}
+
+// CanEncrypt reports whether a key of the keyring can be encrypted to at the
+// Unix time at: it is neither expired nor revoked, and has a key whose key
+// flags allow encryption, as required by KeyPacketWithPublicKeyAt.
+func (kr *KeyRing) CanEncrypt(at int64) bool {
+	_, err := getEntitiesEncryptionKeyAt(kr.entities, time.Unix(at, 0))
+	return err == nil
+}
+
+// CanVerify reports whether a key of the keyring can verify signatures made at
+// the Unix time at: it is neither expired nor revoked, and has a key whose key
+// flags allow signing.
+func (kr *KeyRing) CanVerify(at int64) bool {
+	now := time.Unix(at, 0)
+	for _, e := range kr.entities {
+		if canEntityVerify(e, now) {
+			return true
+		}
+	}
+	return false
+}
+
+func canEntityVerify(e *openpgp.Entity, now time.Time) bool {
+	if isEntityRevoked(e) {
+		return false
+	}
+	i := getPrimaryIdentity(e)
+	if i == nil || e.PrimaryKey.KeyExpired(i.SelfSignature, now) || i.SelfSignature.SigExpired(now) {
+		return false
+	}
+
+	for _, subKey := range e.Subkeys {
+		if subKey.Sig.FlagsValid && subKey.Sig.FlagSign && subKey.Sig.SigType != packet.SigTypeSubkeyRevocation &&
+			subKey.PublicKey.PubKeyAlgo.CanSign() &&
+			!subKey.PublicKey.KeyExpired(subKey.Sig, now) && !subKey.Sig.SigExpired(now) {
+			return true
+		}
+	}
+	return (!i.SelfSignature.FlagsValid || i.SelfSignature.FlagSign) && e.PrimaryKey.PubKeyAlgo.CanSign()
+}
+
+// isEntityRevoked reports whether e has a key revocation signature made by its
+// primary key. Revocations that don't verify, such as unsigned packets that
+// anyone can append to a public key, are ignored.
+func isEntityRevoked(e *openpgp.Entity) bool {
+	for _, sig := range e.Revocations {
+		if e.PrimaryKey.VerifyRevocationSignature(sig) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// getPrimaryIdentity returns the identity marked as primary. If none or
+// several are marked, the one with the latest self-signature is returned, and
+// then the one with the lowest user ID, so that the result doesn't depend on
+// the order of e.Identities.
+func getPrimaryIdentity(e *openpgp.Entity) *openpgp.Identity {
+	var primary *openpgp.Identity
+	for _, ident := range e.Identities {
+		if primary == nil || isPreferredIdentity(ident, primary) {
+			primary = ident
+		}
+	}
+	return primary
+}
+
+// isPreferredIdentity returns whether a is preferred to b as primary identity.
+func isPreferredIdentity(a, b *openpgp.Identity) bool {
+	aPrimary := a.SelfSignature.IsPrimaryId != nil && *a.SelfSignature.IsPrimaryId
+	bPrimary := b.SelfSignature.IsPrimaryId != nil && *b.SelfSignature.IsPrimaryId
+	if aPrimary != bPrimary {
+		return aPrimary
+	}
+	if !a.SelfSignature.CreationTime.Equal(b.SelfSignature.CreationTime) {
+		return a.SelfSignature.CreationTime.After(b.SelfSignature.CreationTime)
+	}
+	return a.Name < b.Name
+}
+
 // KeyIds returns array of IDs of keys in this KeyRing.
 func (kr *KeyRing) KeyIds() []uint64 {
 	var res []uint64
@@ -596,6 +1248,8 @@ func (kr *KeyRing) KeyIds() []uint64 {
 
 // ReadArmoredKeyRing reads an armored data into keyring.
 func ReadArmoredKeyRing(r io.Reader) (kr *KeyRing, err error) {
+	defer recoverMalformedInput(&err)
+
 	kr = &KeyRing{}
 	err = kr.readFrom(r, true)
 	return
@@ -603,6 +1257,8 @@ func ReadArmoredKeyRing(r io.Reader) (kr *KeyRing, err error) {
 
 // ReadKeyRing reads an binary data into keyring.
 func ReadKeyRing(r io.Reader) (kr *KeyRing, err error) {
+	defer recoverMalformedInput(&err)
+
 	kr = &KeyRing{}
 	err = kr.readFrom(r, false)
 	return
@@ -612,7 +1268,7 @@ func ReadKeyRing(r io.Reader) (kr *KeyRing, err error) {
 // KeyRings which contain at least, one unexpired Key. It returns only unexpired
 // parts of these KeyRings.
 func FilterExpiredKeys(contactKeys []*KeyRing) (filteredKeys []*KeyRing, err error) {
-	now := time.Now()
+	now := pgp.getNow()
 	hasExpiredEntity := false
 	filteredKeys = make([]*KeyRing, 0)
 
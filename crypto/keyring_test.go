@@ -1,12 +1,18 @@
 package crypto
 
 import (
+	"bytes"
 	"encoding/base64"
+	"io"
 	"io/ioutil"
+	"math/big"
 	"strings"
 	"testing"
+	"time"
 
+	"golang.org/x/crypto/openpgp"
 	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
 
 	"github.com/ProtonMail/gopenpgp/constants"
 	"github.com/stretchr/testify/assert"
@@ -134,6 +140,29 @@ func TestIdentities(t *testing.T) {
 	assert.Exactly(t, identities[0], testIdentity)
 }
 
+func TestGetIdentities(t *testing.T) {
+	identities := testPrivateKeyRing.GetIdentities()
+	assert.Exactly(t, []Identity{{Name: "UserID", SelfSignatureValid: true}}, identities)
+
+	entity, err := openpgp.NewEntity(
+		"Max Mustermann", "work", "max@example.com", &packet.Config{RSABits: 1024, Time: pgp.getTimeGenerator()},
+	)
+	if err != nil {
+		t.Fatal("Expected no error while generating key, got:", err)
+	}
+	uid := packet.NewUserId("Max", "", "max@example.org")
+	entity.Identities[uid.Id] = &openpgp.Identity{Name: uid.Id, UserId: uid}
+
+	identities = (&KeyRing{entities: openpgp.EntityList{entity}}).GetIdentities()
+	assert.Exactly(t, []Identity{
+		{Name: "Max", Email: "max@example.org"},
+		{Name: "Max Mustermann", Email: "max@example.com", Comment: "work", SelfSignatureValid: true},
+	}, identities)
+
+	entity.Identities = map[string]*openpgp.Identity{}
+	assert.Empty(t, (&KeyRing{entities: openpgp.EntityList{entity}}).GetIdentities())
+}
+
 
 func TestFilterExpiredKeys(t *testing.T) {
 	expiredKey, _ := ReadArmoredKeyRing(strings.NewReader(readTestFile("key_expiredKey", false)))
@@ -147,3 +176,403 @@ func TestFilterExpiredKeys(t *testing.T) {
 	assert.Len(t, unexpired, 1)
 	assert.Exactly(t, unexpired[0], testPrivateKeyRing)
 }
+
+func TestKeyRingAlgorithm(t *testing.T) {
+	algo, err := testPublicKeyRing.GetAlgorithm()
+	if err != nil {
+		t.Fatal("Expected no error while getting algorithm, got:", err)
+	}
+	assert.Exactly(t, "rsa", algo)
+
+	bits, err := testPublicKeyRing.GetBitLength()
+	if err != nil {
+		t.Fatal("Expected no error while getting bit length, got:", err)
+	}
+	assert.Exactly(t, 2048, bits)
+
+	algo, _ = ecPublicKeyRing.GetAlgorithm()
+	assert.Exactly(t, "eddsa", algo)
+
+	bits, _ = ecPublicKeyRing.GetBitLength()
+	assert.Exactly(t, 255, bits)
+
+	_, err = (&KeyRing{}).GetAlgorithm()
+	assert.EqualError(t, err, "can't find public key")
+
+	_, err = (&KeyRing{}).GetBitLength()
+	assert.EqualError(t, err, "can't find public key")
+}
+
+func TestGetSubkeyInfo(t *testing.T) {
+	info := testPublicKeyRing.GetSubkeyInfo()
+	assert.Len(t, info, 2)
+
+	assert.Exactly(t, "6e8ba229b0cccaf6962f97953eb6259edf21df24", info[0].Fingerprint)
+	assert.Exactly(t, testPublicKeyRing.GetEntities()[0].PrimaryKey.KeyId, info[0].KeyID)
+	assert.True(t, info[0].CanSign)
+
+	assert.Exactly(t, "37e4bcf09b36e34012d10c0247dc67b5cb8267f6", info[1].Fingerprint)
+	assert.True(t, info[1].CanEncrypt)
+	assert.False(t, info[1].CanSign)
+	assert.Exactly(t, int64(0), info[1].ExpirationTime)
+
+	assert.Len(t, (&KeyRing{}).GetSubkeyInfo(), 0)
+}
+
+func TestExpiresIn(t *testing.T) {
+	_, neverExpires := testPublicKeyRing.ExpiresIn(testTime)
+	assert.True(t, neverExpires)
+
+	entity := generateTestEntity(t, name, name+"@"+domain)
+	primaryLifetime, subkeyLifetime := uint32(7200), uint32(3600)
+	for _, ident := range entity.Identities {
+		ident.SelfSignature.KeyLifetimeSecs = &primaryLifetime
+	}
+	entity.Subkeys[0].Sig.KeyLifetimeSecs = &subkeyLifetime
+	kr := &KeyRing{entities: openpgp.EntityList{entity}}
+	created := entity.PrimaryKey.CreationTime.Unix()
+
+	seconds, neverExpires := kr.ExpiresIn(created)
+	assert.False(t, neverExpires)
+	assert.Exactly(t, int64(3600), seconds)
+
+	seconds, _ = kr.ExpiresIn(created + 5000)
+	assert.Exactly(t, int64(-1400), seconds)
+
+	// The encryption subkey doesn't expire anymore
+	entity.Subkeys[0].Sig.KeyLifetimeSecs = nil
+	seconds, _ = kr.ExpiresIn(created)
+	assert.Exactly(t, int64(7200), seconds)
+}
+
+func TestCanEncryptVerify(t *testing.T) {
+	assert.True(t, testPublicKeyRing.CanEncrypt(testTime))
+	assert.True(t, testPublicKeyRing.CanVerify(testTime))
+
+	entity := generateTestEntity(t, name, name+"@"+domain)
+	primaryLifetime, subkeyLifetime := uint32(7200), uint32(3600)
+	for _, ident := range entity.Identities {
+		ident.SelfSignature.KeyLifetimeSecs = &primaryLifetime
+	}
+	entity.Subkeys[0].Sig.KeyLifetimeSecs = &subkeyLifetime
+	kr := &KeyRing{entities: openpgp.EntityList{entity}}
+	// Round up, the creation time has a fractional second until serialized
+	created := entity.PrimaryKey.CreationTime.Unix() + 1
+
+	assert.True(t, kr.CanEncrypt(created))
+	assert.True(t, kr.CanVerify(created))
+	assert.False(t, kr.CanEncrypt(created+5000))
+	assert.True(t, kr.CanVerify(created+5000))
+	assert.False(t, kr.CanVerify(created+8000))
+	assert.False(t, kr.CanVerify(created-3600))
+
+	// Signing only
+	entity.Subkeys[0].Sig.FlagEncryptStorage = false
+	entity.Subkeys[0].Sig.FlagEncryptCommunications = false
+	assert.False(t, kr.CanEncrypt(created))
+	assert.True(t, kr.CanVerify(created))
+
+	// Anyone can append an unsigned revocation to a public key
+	entity.Revocations = append(entity.Revocations, &packet.Signature{SigType: packet.SigTypeKeyRevocation})
+	assert.True(t, kr.CanVerify(created))
+
+	entity.Revocations = append(entity.Revocations, revokeTestEntity(t, entity))
+	assert.False(t, kr.CanVerify(created))
+}
+
+func TestGetPreferences(t *testing.T) {
+	kr, err := ReadArmoredKeyRing(strings.NewReader(readTestFile("keyring_preferences", false)))
+	if err != nil {
+		t.Fatal("Expected no error while reading key, got:", err)
+	}
+
+	// Twofish is left out
+	assert.Exactly(t, KeyPreferences{
+		SymmetricCiphers:   []string{constants.AES128, constants.ThreeDES},
+		Hashes:             []string{constants.SHA512, constants.SHA256},
+		Compressions:       []string{constants.CompressionZLIB, constants.CompressionNone},
+		PreferredKeyServer: "hkps://keys.example.com",
+		PolicyURL:          "https://example.com/policy",
+		Features:           0x01,
+	}, kr.GetPreferences())
+
+	assert.Exactly(t, KeyPreferences{}, (&KeyRing{}).GetPreferences())
+}
+
+func TestKeyRing_DecryptWithMultipleKeys(t *testing.T) {
+	lockedKeyRing, err := ReadArmoredKeyRing(strings.NewReader(rsaKey))
+	if err != nil {
+		t.Fatal("Expected no error while reading key, got:", err)
+	}
+
+	mergedKeyRing := &KeyRing{}
+	mergedKeyRing.entities = append(mergedKeyRing.entities, lockedKeyRing.entities...)
+	mergedKeyRing.entities = append(mergedKeyRing.entities, testPrivateKeyRing.entities...)
+
+	assert.Exactly(t, []uint64{0x47dc67b5cb8267f6}, mergedKeyRing.DecryptionKeyIds())
+
+	encrypted, err := testPublicKeyRing.EncryptMessage(testToken, nil)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting, got:", err)
+	}
+
+	ss, err := mergedKeyRing.DecryptMessage(encrypted)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting with merged key ring, got:", err)
+	}
+
+	assert.Exactly(t, testToken, ss.String)
+	assert.Exactly(t, uint64(0x47dc67b5cb8267f6), ss.KeyID)
+	assert.Nil(t, ss.Signed)
+}
+
+func TestKeyRing_LockUnlock(t *testing.T) {
+	keyRing, err := ReadArmoredKeyRing(strings.NewReader(readTestFile("keyring_privateKey", false)))
+	if err != nil {
+		t.Fatal("Expected no error while reading key, got:", err)
+	}
+
+	locked, err := keyRing.IsLocked()
+	if err != nil {
+		t.Fatal("Expected no error while checking lock state, got:", err)
+	}
+	assert.True(t, locked)
+
+	err = keyRing.Unlock([]byte("wrong password"))
+	assert.Regexp(t, "^gopenpgp: cannot unlock key 3eb6259edf21df24: ", err.Error())
+
+	if err = keyRing.Unlock([]byte(testMailboxPassword)); err != nil {
+		t.Fatal("Expected no error while unlocking, got:", err)
+	}
+	locked, _ = keyRing.IsLocked()
+	assert.False(t, locked)
+
+	encrypted, err := testPublicKeyRing.EncryptMessage(testToken, nil)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting, got:", err)
+	}
+	if _, err = keyRing.DecryptMessage(encrypted); err != nil {
+		t.Fatal("Expected no error while decrypting with unlocked key, got:", err)
+	}
+
+	if err = keyRing.Lock(); err != nil {
+		t.Fatal("Expected no error while locking, got:", err)
+	}
+	locked, _ = keyRing.IsLocked()
+	assert.True(t, locked)
+
+	_, err = keyRing.DecryptMessage(encrypted)
+	assert.Error(t, err)
+
+	if err = keyRing.Unlock([]byte(testMailboxPassword)); err != nil {
+		t.Fatal("Expected no error while unlocking again, got:", err)
+	}
+	ss, err := keyRing.DecryptMessage(encrypted)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting with unlocked key, got:", err)
+	}
+	assert.Exactly(t, testToken, ss.String)
+
+	_, err = testPublicKeyRing.IsLocked()
+	assert.EqualError(t, err, "gopenpgp: key ring has no private key")
+}
+
+func TestKeyRing_LockAfterDecryptingKeyPacket(t *testing.T) {
+	keyRing, err := ReadArmoredKeyRing(strings.NewReader(readTestFile("keyring_privateKey", false)))
+	if err != nil {
+		t.Fatal("Expected no error while reading key, got:", err)
+	}
+
+	sessionKey := &SymmetricKey{Key: bytes.Repeat([]byte{1}, 32), Algo: constants.AES256}
+	keyPacket, err := pgp.KeyPacketWithPublicKey(sessionKey, readTestFile("keyring_publicKey", false))
+	if err != nil {
+		t.Fatal("Expected no error while generating key packet, got:", err)
+	}
+	if _, err = pgp.GetSessionFromKeyPacket(keyPacket, keyRing, testMailboxPassword); err != nil {
+		t.Fatal("Expected no error while decrypting key packet, got:", err)
+	}
+	if _, err = keyRing.GetSigningEntity(testMailboxPassword); err != nil {
+		t.Fatal("Expected no error while unlocking signing key, got:", err)
+	}
+	locked, _ := keyRing.IsLocked()
+	assert.False(t, locked)
+
+	if err = keyRing.Lock(); err != nil {
+		t.Fatal("Expected no error while locking, got:", err)
+	}
+	locked, _ = keyRing.IsLocked()
+	assert.True(t, locked)
+}
+
+func TestAddRevokeUserID(t *testing.T) {
+	keyRing, err := ReadArmoredKeyRing(strings.NewReader(readTestFile("keyring_privateKey", false)))
+	if err != nil {
+		t.Fatal("Expected no error while reading keyring, got:", err)
+	}
+
+	err = keyRing.AddUserID("New", "", "new@example.com", []byte("wrong"))
+	assert.Error(t, err)
+
+	err = keyRing.AddUserID("New", "", "new@example.com", []byte(testMailboxPassword))
+	if err != nil {
+		t.Fatal("Expected no error while adding user ID, got:", err)
+	}
+	err = keyRing.AddUserID("New", "", "new@example.com", []byte(testMailboxPassword))
+	assert.EqualError(t, err, "gopenpgp: cannot add user ID, New <new@example.com> already exists")
+
+	locked, err := keyRing.IsLocked()
+	if err != nil {
+		t.Fatal("Expected no error while checking lock state, got:", err)
+	}
+	assert.True(t, locked)
+
+	readIdentities := func() []Identity {
+		armored, err := keyRing.GetArmoredPublicKey()
+		if err != nil {
+			t.Fatal("Expected no error while serializing public key, got:", err)
+		}
+		publicKeyRing, err := ReadArmoredKeyRing(strings.NewReader(armored))
+		if err != nil {
+			t.Fatal("Expected no error while reading public key, got:", err)
+		}
+		return publicKeyRing.GetIdentities()
+	}
+
+	assert.Exactly(t, []Identity{
+		{Name: "New", Email: "new@example.com", SelfSignatureValid: true},
+		{Name: "UserID", SelfSignatureValid: true},
+	}, readIdentities())
+
+	err = keyRing.RevokeUserID("new@example.com", []byte(testMailboxPassword))
+	if err != nil {
+		t.Fatal("Expected no error while revoking user ID, got:", err)
+	}
+	assert.Exactly(t, []Identity{
+		{Name: "New", Email: "new@example.com"},
+		{Name: "UserID", SelfSignatureValid: true},
+	}, readIdentities())
+
+	err = keyRing.RevokeUserID("old@example.com", []byte(testMailboxPassword))
+	assert.EqualError(t, err, "gopenpgp: cannot revoke user ID, no user ID with email old@example.com")
+}
+
+func TestGetPrimaryIdentity(t *testing.T) {
+	created := time.Unix(1500000000, 0)
+	older := &openpgp.Identity{Name: "Older", SelfSignature: &packet.Signature{CreationTime: created}}
+	newer := &openpgp.Identity{Name: "Newer", SelfSignature: &packet.Signature{CreationTime: created.Add(time.Hour)}}
+	same := &openpgp.Identity{Name: "Alice", SelfSignature: &packet.Signature{CreationTime: created.Add(time.Hour)}}
+
+	// The result mustn't depend on the iteration order of the map
+	for i := 0; i < 20; i++ {
+		e := &openpgp.Entity{Identities: map[string]*openpgp.Identity{older.Name: older, newer.Name: newer}}
+		assert.Exactly(t, newer, getPrimaryIdentity(e))
+
+		e.Identities[same.Name] = same
+		assert.Exactly(t, same, getPrimaryIdentity(e))
+	}
+
+	isPrimary := true
+	older.SelfSignature.IsPrimaryId = &isPrimary
+	e := &openpgp.Entity{Identities: map[string]*openpgp.Identity{
+		older.Name: older, newer.Name: newer, same.Name: same,
+	}}
+	assert.Exactly(t, older, getPrimaryIdentity(e))
+
+	assert.Nil(t, getPrimaryIdentity(&openpgp.Entity{}))
+}
+
+func TestAddEncryptionSubkey(t *testing.T) {
+	keyRing, err := ReadArmoredKeyRing(strings.NewReader(readTestFile("keyring_privateKey", false)))
+	if err != nil {
+		t.Fatal("Expected no error while reading keyring, got:", err)
+	}
+
+	err = keyRing.AddEncryptionSubkey("dsa", 1024, 0, []byte(testMailboxPassword))
+	assert.EqualError(t, err, "gopenpgp: unsupported key type: dsa")
+
+	for _, keyType := range []string{"rsa", "x25519"} {
+		err = keyRing.AddEncryptionSubkey(keyType, 1024, 3600, []byte(testMailboxPassword))
+		if err != nil {
+			t.Fatal("Expected no error while adding subkey, got:", err)
+		}
+
+		armored, err := keyRing.GetArmoredPublicKey()
+		if err != nil {
+			t.Fatal("Expected no error while serializing public key, got:", err)
+		}
+		publicKeyRing, err := ReadArmoredKeyRing(strings.NewReader(armored))
+		if err != nil {
+			t.Fatal("Expected no error while reading public key, got:", err)
+		}
+
+		subkeys := publicKeyRing.GetSubkeyInfo()
+		subkey := subkeys[len(subkeys)-1]
+		assert.True(t, subkey.CanEncrypt)
+		assert.False(t, subkey.CanSign)
+		assert.Exactly(t, subkey.CreationTime+3600, subkey.ExpirationTime)
+
+		// The new subkey is protected with the passphrase of the primary key
+		var keyPacket bytes.Buffer
+		newSubkeys := publicKeyRing.entities[0].Subkeys
+		pub := newSubkeys[len(newSubkeys)-1].PublicKey
+		if err = packet.SerializeEncryptedKey(&keyPacket, pub, packet.CipherAES256, testSymmetricKey.Key, nil); err != nil {
+			t.Fatal("Expected no error while encrypting session key, got:", err)
+		}
+		sessionKey, err := pgp.GetSessionFromKeyPacket(keyPacket.Bytes(), keyRing, testMailboxPassword)
+		if err != nil {
+			t.Fatal("Expected no error while decrypting session key, got:", err)
+		}
+		assert.Exactly(t, testSymmetricKey, sessionKey)
+	}
+}
+
+func TestAddEncryptionSubkeyMPIBitLength(t *testing.T) {
+	keyRing, err := ReadArmoredKeyRing(strings.NewReader(readTestFile("keyring_privateKey", false)))
+	if err != nil {
+		t.Fatal("Expected no error while reading keyring, got:", err)
+	}
+	if err = keyRing.AddEncryptionSubkey("x25519", 0, 0, []byte(testMailboxPassword)); err != nil {
+		t.Fatal("Expected no error while adding subkey, got:", err)
+	}
+	serialized, err := keyRing.GetPublicKey()
+	if err != nil {
+		t.Fatal("Expected no error while serializing public key, got:", err)
+	}
+
+	var body []byte
+	packets := packet.NewOpaqueReader(bytes.NewReader(serialized))
+	for {
+		p, err := packets.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal("Expected no error while reading packets, got:", err)
+		}
+		if p.Tag == publicSubkeyTag {
+			body = p.Contents
+		}
+	}
+
+	// Strict implementations require the bit length of the point MPI to be
+	// the one of its value, 263 bits for a point with the 0x40 prefix
+	assert.Exactly(t, byte(packet.PubKeyAlgoECDH), body[5])
+	offset := 7 + int(body[6])
+	bitLength := int(body[offset])<<8 | int(body[offset+1])
+	point := body[offset+2 : offset+2+(bitLength+7)/8]
+	assert.Exactly(t, 263, bitLength)
+	assert.Exactly(t, new(big.Int).SetBytes(point).BitLen(), bitLength)
+
+	publicKeyRing, err := ReadKeyRing(bytes.NewReader(serialized))
+	if err != nil {
+		t.Fatal("Expected no error while reading public key, got:", err)
+	}
+	e := publicKeyRing.entities[0]
+	subkey := e.Subkeys[len(e.Subkeys)-1]
+	assert.NoError(t, e.PrimaryKey.VerifyKeySignature(subkey.PublicKey, subkey.Sig))
+	reserialized, err := serializePublicKeyBody(subkey.PublicKey)
+	if err != nil {
+		t.Fatal("Expected no error while serializing subkey, got:", err)
+	}
+	assert.Exactly(t, body, reserialized)
+}
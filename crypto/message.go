@@ -2,11 +2,13 @@ package crypto
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"math"
+	"strings"
 	"time"
 
 	"golang.org/x/crypto/openpgp"
@@ -20,6 +22,16 @@ import (
 	"github.com/ProtonMail/gopenpgp/models"
 )
 
+const (
+	encryptedKeyTag                   = 1
+	symmetricallyEncryptedTag         = 9
+	symmetricallyEncryptedMDCTag      = 18
+	aeadEncryptedTag                  = 20
+	symmetricallyEncryptedAEADVersion = 2
+)
+
+var errAEADDataUnsupported = errors.New("gopenpgp: AEAD encrypted data packets are not supported by the crypto library")
+
 // DecryptMessageStringKey decrypts encrypted message use private key (string)
 // encryptedText : string armored encrypted
 // privateKey : armored private use to decrypt message
@@ -44,8 +56,12 @@ func (pgp *GopenPGP) DecryptMessageStringKey(
 // encryptedText : string armored encrypted
 // privateKey : keyring with private key to decrypt message, could be multiple keys
 // passphrase : match with private key to decrypt message
-func (pgp *GopenPGP) DecryptMessage(encryptedText string, privateKey *KeyRing, passphrase string) (string, error) {
-	md, err := decryptCore(encryptedText, nil, privateKey, passphrase, pgp.getTimeGenerator())
+func (pgp *GopenPGP) DecryptMessage(
+	encryptedText string, privateKey *KeyRing, passphrase string,
+) (plainText string, err error) {
+	defer recoverMalformedInput(&err)
+
+	md, err := pgp.decryptCore(encryptedText, nil, privateKey, passphrase, pgp.getTimeGenerator())
 	if err != nil {
 		return "", err
 	}
@@ -59,15 +75,232 @@ func (pgp *GopenPGP) DecryptMessage(encryptedText string, privateKey *KeyRing, p
 	return string(b), nil
 }
 
-func decryptCore(
+// DecryptMessageBinary is like DecryptMessage, but takes the binary message
+// and returns the plaintext as bytes.
+func (pgp *GopenPGP) DecryptMessageBinary(
+	encrypted []byte, privateKey *KeyRing, passphrase string,
+) (plainData []byte, err error) {
+	defer recoverMalformedInput(&err)
+
+	md, err := pgp.decryptCoreBinary(encrypted, privateKey, passphrase, pgp.getTimeGenerator())
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.ReadAll(md.UnverifiedBody)
+}
+
+// DecryptMessageWithLimits is like DecryptMessage, but decrypting fails with a
+// CryptoError with code constants.ErrorCodeLimitExceeded if the message exceeds
+// limits, so that untrusted messages can't be used as decompression bombs.
+func (pgp *GopenPGP) DecryptMessageWithLimits(
+	encryptedText string, privateKey *KeyRing, passphrase string, limits *DecryptLimits,
+) (plainText string, err error) {
+	defer recoverMalformedInput(&err)
+
+	keyPacket, dataPacket, err := SplitMessage(encryptedText)
+	if err != nil {
+		return "", err
+	}
+	sk, err := pgp.GetSessionFromKeyPacket(keyPacket, privateKey, passphrase)
+	if err != nil {
+		return "", err
+	}
+	plainData, err := pgp.decryptDataPacket(dataPacket, sk, limits, true)
+	if err != nil {
+		return "", err
+	}
+
+	return string(plainData), nil
+}
+
+// DecryptMessageWithOptions is like DecryptMessage, but decrypts according to
+// options. If options is nil, NewDecryptOptions is used. Unlike DecryptMessage,
+// it can decrypt legacy messages without integrity protection if
+// options.RequireIntegrityProtection is false.
+func (pgp *GopenPGP) DecryptMessageWithOptions(
+	encryptedText string, privateKey *KeyRing, passphrase string, options *DecryptOptions,
+) (plainText string, err error) {
+	defer recoverMalformedInput(&err)
+
+	if options == nil {
+		options = NewDecryptOptions()
+	}
+
+	keyPacket, dataPacket, err := SplitMessage(encryptedText)
+	if err != nil {
+		return "", err
+	}
+	sk, err := pgp.GetSessionFromKeyPacket(keyPacket, privateKey, passphrase)
+	if err != nil {
+		return "", err
+	}
+	plainData, err := pgp.decryptDataPacket(dataPacket, sk, options.Limits, options.RequireIntegrityProtection)
+	if err != nil {
+		return "", err
+	}
+
+	return string(plainData), nil
+}
+
+// errTrailingData is returned by the strict functions when the input continues
+// after the end of the message.
+var errTrailingData = errors.New("gopenpgp: unexpected data after the end of the message")
+
+// DecryptMessageStrict is like DecryptMessage, but fails if encryptedText
+// contains anything after the message: text after the armor end line, or
+// packets and bytes after the encrypted data packet. DecryptMessage stops
+// at the end of the first message and ignores such trailing data, like GnuPG.
+func (pgp *GopenPGP) DecryptMessageStrict(encryptedText string, privateKey *KeyRing, passphrase string) (string, error) {
+	end := "-----END " + constants.PGPMessageHeader + "-----"
+	if i := strings.Index(encryptedText, end); i >= 0 && strings.TrimSpace(encryptedText[i+len(end):]) != "" {
+		return "", errTrailingData
+	}
+
+	encrypted, err := armorUtils.Unarmor(encryptedText)
+	if err != nil {
+		return "", err
+	}
+	if _, _, err = splitPackets(encrypted); err != nil {
+		return "", err
+	}
+	return pgp.DecryptMessage(encryptedText, privateKey, passphrase)
+}
+
+// DecryptMessageWithMetadata is like DecryptMessage, but also returns the
+// filename, format and modification time stored in the literal data packet.
+func (pgp *GopenPGP) DecryptMessageWithMetadata(
+	encryptedText string, privateKey *KeyRing, passphrase string,
+) (decrypted *models.DecryptedWithMetadata, err error) {
+	defer recoverMalformedInput(&err)
+
+	md, err := pgp.decryptCore(encryptedText, nil, privateKey, passphrase, pgp.getTimeGenerator())
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := ioutil.ReadAll(md.UnverifiedBody)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.DecryptedWithMetadata{
+		Plaintext: string(b),
+		Metadata: &models.LiteralMetadata{
+			Filename: md.LiteralData.FileName,
+			IsBinary: md.LiteralData.IsBinary,
+			ModTime:  int64(md.LiteralData.Time),
+		},
+	}, nil
+}
+
+// DecryptMessageWithSignerInfo is like DecryptMessage, but also reports
+// whether the message was signed and by which key ID. The signature itself is
+// not verified, see DecryptMessageVerify.
+func (pgp *GopenPGP) DecryptMessageWithSignerInfo(
+	encryptedText string, privateKey *KeyRing, passphrase string,
+) (decrypted *models.DecryptedSignerInfo, err error) {
+	defer recoverMalformedInput(&err)
+
+	md, err := pgp.decryptCore(encryptedText, nil, privateKey, passphrase, pgp.getTimeGenerator())
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := ioutil.ReadAll(md.UnverifiedBody)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &models.DecryptedSignerInfo{Plaintext: string(b), WasSigned: md.IsSigned}
+	if md.IsSigned {
+		out.SignerKeyID = md.SignedByKeyId
+	}
+	return out, nil
+}
+
+// GetEncryptionKeyIDs returns the key IDs the armored message is encrypted to,
+// read from its public-key encrypted session key packets without decrypting
+// anything, e.g. to pick the right key before asking for its passphrase. ok is
+// false if the message can't be read, has no such packet, or if a packet uses
+// the wildcard key ID of anonymous recipients, in which case any key may
+// decrypt it. Wildcard key IDs are not included in keyIDs.
+func GetEncryptionKeyIDs(encryptedText string) (keyIDs []uint64, ok bool) {
+	encrypted, err := armorUtils.Unarmor(encryptedText)
+	if err != nil {
+		return nil, false
+	}
+
+	ok = true
+	packets := packet.NewOpaqueReader(bytes.NewReader(encrypted))
+	for {
+		op, err := packets.Next()
+		if err != nil || op.Tag == symmetricallyEncryptedTag || op.Tag == symmetricallyEncryptedMDCTag ||
+			op.Tag == aeadEncryptedTag {
+			break
+		}
+		if op.Tag != encryptedKeyTag {
+			continue
+		}
+
+		p, err := op.Parse()
+		if err != nil {
+			continue
+		}
+		ek, isKey := p.(*packet.EncryptedKey)
+		if !isKey {
+			continue
+		}
+		if ek.KeyId == 0 {
+			ok = false
+			continue
+		}
+		keyIDs = append(keyIDs, ek.KeyId)
+	}
+	return keyIDs, ok && len(keyIDs) > 0
+}
+
+// ErrMessageNotProtected is returned when decrypting a message that uses a
+// legacy data packet without integrity protection (MDC), which an attacker can
+// modify without being detected. Such messages are refused unless decrypted
+// with DecryptMessageWithOptions and RequireIntegrityProtection disabled.
+var ErrMessageNotProtected error = newCryptoError(
+	constants.ErrorCodeNotProtected, "gopenpgp: message is not integrity protected",
+)
+
+// isArmoredUnprotected reports whether the armored message contains a data
+// packet without integrity protection, see isUnprotected.
+func isArmoredUnprotected(encryptedText string) bool {
+	encrypted, err := armorUtils.Unarmor(encryptedText)
+	if err != nil {
+		return false
+	}
+	return isUnprotected(bytes.NewReader(encrypted))
+}
+
+// isUnprotected reports whether the binary message read from r contains a
+// symmetrically encrypted data packet without integrity protection.
+func isUnprotected(r io.Reader) bool {
+	packets := packet.NewOpaqueReader(r)
+	for {
+		op, err := packets.Next()
+		if err != nil {
+			return false
+		}
+		if op.Tag == symmetricallyEncryptedTag {
+			return true
+		}
+	}
+}
+
+func (pgp *GopenPGP) decryptCore(
 	encryptedText string, additionalEntries openpgp.EntityList,
 	privKey *KeyRing, passphrase string,
 	timeFunc func() time.Time,
 ) (*openpgp.MessageDetails, error) {
 	rawPwd := []byte(passphrase)
 	if err := privKey.Unlock(rawPwd); err != nil {
-		err = fmt.Errorf("gopenpgp: cannot decrypt passphrase: %v", err)
-		return nil, err
+		return nil, wrapCryptoError(err, "gopenpgp: cannot decrypt passphrase")
 	}
 
 	privKeyEntries := privKey.entities
@@ -84,7 +317,73 @@ func decryptCore(
 	config := &packet.Config{Time: timeFunc}
 
 	md, err := openpgp.ReadMessage(encryptedio.Body, privKeyEntries, nil, config)
-	return md, err
+	if err != nil {
+		if isArmoredAEADEncrypted(encryptedText) {
+			return nil, errAEADDataUnsupported
+		}
+		if isArmoredUnprotected(encryptedText) {
+			return nil, ErrMessageNotProtected
+		}
+		return nil, convertReadMessageError(err)
+	}
+	md.UnverifiedBody = pgp.limitDecompressedSize(md.UnverifiedBody)
+	return md, nil
+}
+
+// decryptCoreBinary is like decryptCore, but reads the binary message encrypted.
+func (pgp *GopenPGP) decryptCoreBinary(
+	encrypted []byte, privKey *KeyRing, passphrase string,
+	timeFunc func() time.Time,
+) (*openpgp.MessageDetails, error) {
+	if err := privKey.Unlock([]byte(passphrase)); err != nil {
+		return nil, wrapCryptoError(err, "gopenpgp: cannot decrypt passphrase")
+	}
+
+	config := &packet.Config{Time: timeFunc}
+
+	md, err := openpgp.ReadMessage(bytes.NewReader(encrypted), privKey.entities, nil, config)
+	if err != nil {
+		if isAEADEncrypted(bytes.NewReader(encrypted)) {
+			return nil, errAEADDataUnsupported
+		}
+		if isUnprotected(bytes.NewReader(encrypted)) {
+			return nil, ErrMessageNotProtected
+		}
+		return nil, convertReadMessageError(err)
+	}
+	md.UnverifiedBody = pgp.limitDecompressedSize(md.UnverifiedBody)
+	return md, nil
+}
+
+// isArmoredAEADEncrypted reports whether the armored message contains AEAD
+// encrypted data, see isAEADEncrypted.
+func isArmoredAEADEncrypted(encryptedText string) bool {
+	encrypted, err := armorUtils.Unarmor(encryptedText)
+	if err != nil {
+		return false
+	}
+	return isAEADEncrypted(bytes.NewReader(encrypted))
+}
+
+// isAEADEncrypted reports whether the binary message read from r contains an
+// AEAD encrypted data packet or a version 2 symmetrically encrypted integrity
+// protected data packet, which the crypto library can't decrypt.
+func isAEADEncrypted(r io.Reader) bool {
+	packets := packet.NewOpaqueReader(r)
+	for {
+		op, err := packets.Next()
+		if err != nil {
+			return false
+		}
+
+		if op.Tag == aeadEncryptedTag {
+			return true
+		}
+		if op.Tag == symmetricallyEncryptedMDCTag && len(op.Contents) > 0 &&
+			op.Contents[0] == symmetricallyEncryptedAEADVersion {
+			return true
+		}
+	}
 }
 
 // DecryptMessageVerify decrypts message and verify the signature
@@ -95,7 +394,9 @@ func decryptCore(
 func (pgp *GopenPGP) DecryptMessageVerify(
 	encryptedText string, verifierKey, privateKeyRing *KeyRing,
 	passphrase string, verifyTime int64,
-) (*models.DecryptSignedVerify, error) {
+) (verified *models.DecryptSignedVerify, err error) {
+	defer recoverMalformedInput(&err)
+
 	out := &models.DecryptSignedVerify{}
 	out.Verify = failed
 
@@ -104,7 +405,7 @@ func (pgp *GopenPGP) DecryptMessageVerify(
 		out.Verify = noVerifier
 	}
 
-	md, err := decryptCore(
+	md, err := pgp.decryptCore(
 		encryptedText,
 		verifierEntries,
 		privateKeyRing,
@@ -124,6 +425,14 @@ func (pgp *GopenPGP) DecryptMessageVerify(
 	processSignatureExpiration(md, verifyTime)
 
 	out.Plaintext = string(b)
+	setVerifyResult(out, md, verifierKey)
+	return out, nil
+}
+
+// setVerifyResult sets the verification status of out from the signature of
+// the fully read message md. If the message is signed by a key that isn't in
+// verifierKey, the status is left unchanged.
+func setVerifyResult(out *models.DecryptSignedVerify, md *openpgp.MessageDetails, verifierKey *KeyRing) {
 	if md.IsSigned {
 		if md.SignedBy != nil {
 			if len(verifierKey.entities) > 0 {
@@ -145,7 +454,172 @@ func (pgp *GopenPGP) DecryptMessageVerify(
 	} else {
 		out.Verify = notSigned
 	}
-	return out, nil
+}
+
+// ErrMessageNotSigned is returned by DecryptMessageVerifyRequired and by the
+// verify function of DecryptStream if the message carries no signature at all.
+var ErrMessageNotSigned error = newCryptoError(constants.ErrorCodeNotSigned, "gopenpgp: message is not signed")
+
+// errNotSignedByVerifier is returned when a message is signed, but not by the
+// expected verifier key.
+var errNotSignedByVerifier = newCryptoError(
+	constants.ErrorCodeBadSignature, "gopenpgp: message is not signed by the verifier key",
+)
+
+// DecryptMessageVerifyRequired decrypts the armored encryptedText with
+// privateKeyRing and returns the plaintext only if it is validly signed by
+// verifierKey at verifyTime. If the message isn't signed, ErrMessageNotSigned
+// is returned; any other error means the signature is present but invalid or
+// by another key.
+func (pgp *GopenPGP) DecryptMessageVerifyRequired(
+	encryptedText string, verifierKey, privateKeyRing *KeyRing,
+	passphrase string, verifyTime int64,
+) (plainText string, err error) {
+	defer recoverMalformedInput(&err)
+
+	md, err := pgp.decryptCore(
+		encryptedText,
+		verifierKey.entities,
+		privateKeyRing,
+		passphrase,
+		func() time.Time { return time.Unix(0, 0) })
+	if err != nil {
+		return "", err
+	}
+
+	b, err := ioutil.ReadAll(md.UnverifiedBody)
+	if err != nil {
+		return "", err
+	}
+
+	if !md.IsSigned {
+		return "", ErrMessageNotSigned
+	}
+	if md.SignedBy == nil || len(verifierKey.entities.KeysById(md.SignedByKeyId)) == 0 {
+		return "", errNotSignedByVerifier
+	}
+
+	processSignatureExpiration(md, verifyTime)
+	if md.SignatureError != nil {
+		return "", newBadSignatureError(md.SignatureError)
+	}
+	return string(b), nil
+}
+
+// DecryptStream decrypts the binary message read from encryptedReader with the
+// unlocked privateKey, without buffering the plaintext. The returned function
+// must be called once the returned reader has been read to EOF, and returns a
+// non-nil error if the message isn't validly signed by verifyKey at verifyTime.
+// If verifyKey is nil, the returned function always fails.
+func (pgp *GopenPGP) DecryptStream(
+	encryptedReader io.Reader, privateKey, verifyKey *KeyRing, verifyTime int64,
+) (plainReader io.Reader, verify func() error, err error) {
+	defer recoverMalformedInput(&err)
+
+	if verifyKey == nil {
+		verifyKey = &KeyRing{}
+	}
+	var entries openpgp.EntityList
+	entries = append(entries, privateKey.entities...)
+	entries = append(entries, verifyKey.entities...)
+
+	config := &packet.Config{Time: func() time.Time { return time.Unix(0, 0) }}
+
+	md, err := openpgp.ReadMessage(encryptedReader, entries, nil, config)
+	if err != nil {
+		return nil, nil, convertReadMessageError(err)
+	}
+
+	body := &eofReader{r: &recoverReader{r: pgp.limitDecompressedSize(md.UnverifiedBody)}}
+	verify = func() error {
+		if !body.eof {
+			return errors.New("gopenpgp: cannot verify signature, message was not read to the end")
+		}
+		if !md.IsSigned {
+			return ErrMessageNotSigned
+		}
+		if md.SignedBy == nil || len(verifyKey.entities.KeysById(md.SignedByKeyId)) == 0 {
+			return errNotSignedByVerifier
+		}
+
+		processSignatureExpiration(md, verifyTime)
+		if md.SignatureError != nil {
+			return newBadSignatureError(md.SignatureError)
+		}
+		return nil
+	}
+
+	return body, verify, nil
+}
+
+// An io.Reader that records whether EOF has been reached.
+type eofReader struct {
+	r   io.Reader
+	eof bool
+}
+
+func (r *eofReader) Read(b []byte) (n int, err error) {
+	n, err = r.r.Read(b)
+	if err == io.EOF {
+		r.eof = true
+	}
+	return
+}
+
+// DecryptStreamContext is like DecryptStream, but aborts with the error of ctx
+// once ctx is done. Reading the returned reader then fails with that error, and
+// the returned function reports the message as not read to the end.
+func (pgp *GopenPGP) DecryptStreamContext(
+	ctx context.Context, encryptedReader io.Reader, privateKey, verifyKey *KeyRing, verifyTime int64,
+) (io.Reader, func() error, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	body, verify, err := pgp.DecryptStream(&contextReader{ctx: ctx, r: encryptedReader}, privateKey, verifyKey, verifyTime)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, nil, ctxErr
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return &contextReader{ctx: ctx, r: body}, verify, nil
+}
+
+// An io.Reader that fails with the error of ctx once ctx is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(b []byte) (n int, err error) {
+	if err = r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(b)
+}
+
+// progressInterval is the number of bytes between two progress callbacks.
+const progressInterval = 1 << 20
+
+// An io.Reader that reports the number of bytes read every progressInterval
+// bytes and at EOF.
+type progressReader struct {
+	r        io.Reader
+	read     int64
+	reported int64
+	total    int64
+	progress func(bytesProcessed, totalBytes int64)
+}
+
+func (r *progressReader) Read(b []byte) (n int, err error) {
+	n, err = r.r.Read(b)
+	r.read += int64(n)
+	if r.read-r.reported >= progressInterval || (err == io.EOF && r.read != r.reported) {
+		r.reported = r.read
+		r.progress(r.read, r.total)
+	}
+	return
 }
 
 // processSignatureExpiration handles signature time verification manually, so we can add a margin to the
@@ -172,13 +646,32 @@ func processSignatureExpiration(md *openpgp.MessageDetails, verifyTime int64) {
 // plainText string: clear text
 // output string: armored pgp message
 func (pgp *GopenPGP) EncryptMessageWithPassword(plainText string, password string) (string, error) {
+	config := &packet.Config{Time: pgp.getTimeGenerator()}
+	return encryptMessageWithPassword(plainText, password, config)
+}
+
+// EncryptMessageWithPasswordAndCompression is like EncryptMessageWithPassword,
+// but compresses the message with the named compression algorithm (see
+// constants.CompressionZIP) at the given level, between 1
+// (constants.BestSpeed) and 9 (constants.BestCompression), or
+// constants.DefaultCompressionLevel.
+func (pgp *GopenPGP) EncryptMessageWithPasswordAndCompression(
+	plainText string, password string, compression string, level int,
+) (string, error) {
+	config, err := pgp.getCompressionConfig(compression, level)
+	if err != nil {
+		return "", err
+	}
+	return encryptMessageWithPassword(plainText, password, config)
+}
+
+func encryptMessageWithPassword(plainText string, password string, config *packet.Config) (string, error) {
 	var outBuf bytes.Buffer
 	w, err := armor.Encode(&outBuf, constants.PGPMessageHeader, internal.ArmorHeaders)
 	if err != nil {
 		return "", err
 	}
 
-	config := &packet.Config{Time: pgp.getTimeGenerator()}
 	plaintext, err := openpgp.SymmetricallyEncrypt(w, []byte(password), nil, config)
 	if err != nil {
 		return "", err
@@ -197,6 +690,57 @@ func (pgp *GopenPGP) EncryptMessageWithPassword(plainText string, password strin
 	return outBuf.String(), nil
 }
 
+// EncryptSignMessageWithPassword encrypts plainText with a password like
+// EncryptMessageWithPassword, and signs it with privateKey, unlocked with
+// passphrase. The signature is inside the encrypted data, see
+// DecryptMessageWithPasswordVerify.
+func (pgp *GopenPGP) EncryptSignMessageWithPassword(
+	plainText string, password string, privateKey *KeyRing, passphrase string,
+) (string, error) {
+	if len(password) == 0 {
+		return "", errors.New("gopenpgp: password can't be empty")
+	}
+	signEntity, err := privateKey.GetSigningEntity(passphrase)
+	if err != nil {
+		return "", err
+	}
+
+	var outBuf bytes.Buffer
+	w, err := armor.Encode(&outBuf, constants.PGPMessageHeader, internal.ArmorHeaders)
+	if err != nil {
+		return "", err
+	}
+
+	config := &packet.Config{
+		DefaultCipher: pgp.getDefaultCipher(), DefaultHash: pgp.getSignatureHash(), Time: pgp.getTimeGenerator(),
+	}
+	key, err := packet.SerializeSymmetricKeyEncrypted(w, []byte(password), config)
+	if err != nil {
+		return "", err
+	}
+	ew, err := packet.SerializeSymmetricallyEncrypted(w, config.Cipher(), key, config)
+	if err != nil {
+		return "", err
+	}
+	sw, err := openpgp.Sign(ew, signEntity, &openpgp.FileHints{IsBinary: true}, config)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err = sw.Write([]byte(plainText)); err != nil {
+		return "", err
+	}
+	if err = sw.Close(); err != nil {
+		return "", err
+	}
+	if err = ew.Close(); err != nil {
+		return "", err
+	}
+	w.Close()
+
+	return outBuf.String(), nil
+}
+
 // EncryptMessage encrypts message with unarmored public key, if pass private key and passphrase will also sign
 // the message
 // publicKey : bytes unarmored public key
@@ -208,56 +752,320 @@ func (pgp *GopenPGP) EncryptMessage(
 	plainText string, publicKey, privateKey *KeyRing,
 	passphrase string, trim bool,
 ) (string, error) {
-	if trim {
-		plainText = internal.TrimNewlines(plainText)
+	return pgp.encryptMessage(plainText, nil, publicKey, privateKey, passphrase, trim, nil)
+}
+
+// EncryptMessageToSelf encrypts plainText to recipients and to selfKey, so
+// that the sender can decrypt their own copy. Keys of selfKey that are already
+// among recipients are only encrypted to once. The message is not signed.
+func (pgp *GopenPGP) EncryptMessageToSelf(plainText string, recipients, selfKey *KeyRing) (string, error) {
+	merged := &KeyRing{}
+	merged.entities = append(merged.entities, recipients.entities...)
+	for _, self := range selfKey.entities {
+		isRecipient := false
+		for _, e := range recipients.entities {
+			if e.PrimaryKey.Fingerprint == self.PrimaryKey.Fingerprint {
+				isRecipient = true
+				break
+			}
+		}
+		if !isRecipient {
+			merged.entities = append(merged.entities, self)
+		}
+	}
+
+	return pgp.encryptMessage(plainText, nil, merged, nil, "", false, nil)
+}
+
+// EncryptMessageWithSessionKey encrypts plainText with the given session key
+// instead of a random one, for each key of recipients, and returns the armored
+// message. The randomness of the packets comes from the config set with
+// SetConfig, so with a deterministic random reader and a fixed clock (see
+// SetTimeFunc) the same plainText and session key give the same packets, e.g.
+// for test vectors. RSA encryption draws its own randomness, use ECC
+// recipients for reproducible key packets.
+func (pgp *GopenPGP) EncryptMessageWithSessionKey(
+	plainText string, sk *SymmetricKey, recipients *KeyRing,
+) (string, error) {
+	if len(recipients.entities) == 0 {
+		return "", errors.New("gopenpgp: cannot encrypt message, no recipients")
+	}
+
+	keyPackets, err := pgp.keyPacketsForRecipients(sk, recipients)
+	if err != nil {
+		return "", err
+	}
+	dataPacket, err := pgp.EncryptWithSessionKey([]byte(plainText), sk)
+	if err != nil {
+		return "", err
+	}
+	return armorUtils.ArmorWithType(append(keyPackets, dataPacket...), constants.PGPMessageHeader)
+}
+
+// keyPacketsForRecipients encrypts the session key sk to each key of
+// recipients and returns the concatenated session key packets. Expired and
+// revoked keys are rejected.
+func (pgp *GopenPGP) keyPacketsForRecipients(sk *SymmetricKey, recipients *KeyRing) ([]byte, error) {
+	var keyPackets bytes.Buffer
+	for _, e := range recipients.entities {
+		pub, err := getRecipientEncryptionKey(e, pgp.getNow())
+		if err != nil {
+			return nil, err
+		}
+		if err = serializeEncryptedKey(&keyPackets, pub, sk.GetCipherFunc(), sk.Key, pgp.getConfig()); err != nil {
+			return nil, err
+		}
+	}
+	return keyPackets.Bytes(), nil
+}
+
+// EncryptMessageWithMetadata is like EncryptMessage, but stores the filename,
+// format and modification time of metadata in the literal data packet. If
+// metadata.IsBinary is false, the line endings of plainText are converted to
+// CRLF and the message is signed in text mode.
+func (pgp *GopenPGP) EncryptMessageWithMetadata(
+	plainText string, metadata *models.LiteralMetadata, publicKey, privateKey *KeyRing,
+	passphrase string, trim bool,
+) (string, error) {
+	return pgp.encryptMessage(plainText, metadata, publicKey, privateKey, passphrase, trim, nil)
+}
+
+// EncryptMessageWithCompression is like EncryptMessage, but compresses the
+// message with the named compression algorithm (see constants.CompressionZIP)
+// at the given level, between 1 (constants.BestSpeed) and 9
+// (constants.BestCompression), or constants.DefaultCompressionLevel.
+func (pgp *GopenPGP) EncryptMessageWithCompression(
+	plainText string, publicKey, privateKey *KeyRing,
+	passphrase string, trim bool, compression string, level int,
+) (string, error) {
+	config, err := pgp.getCompressionConfig(compression, level)
+	if err != nil {
+		return "", err
 	}
+	return pgp.encryptMessage(plainText, nil, publicKey, privateKey, passphrase, trim, config)
+}
+
+// encryptMessage encrypts and optionally signs plainText, see
+// writeEncryptedMessage, and returns the armored message.
+func (pgp *GopenPGP) encryptMessage(
+	plainText string, metadata *models.LiteralMetadata, publicKey, privateKey *KeyRing,
+	passphrase string, trim bool, config *packet.Config,
+) (string, error) {
 	var outBuf bytes.Buffer
 	w, err := armor.Encode(&outBuf, constants.PGPMessageHeader, internal.ArmorHeaders)
 	if err != nil {
 		return "", err
 	}
 
+	err = pgp.writeEncryptedMessage(w, plainText, metadata, publicKey, privateKey, passphrase, trim, config)
+	w.Close()
+	return outBuf.String(), err
+}
+
+// EncryptMessageBinary is like EncryptMessage, but returns the binary message.
+// plainData is encrypted as is, without trimming newlines.
+func (pgp *GopenPGP) EncryptMessageBinary(
+	plainData []byte, publicKey, privateKey *KeyRing, passphrase string,
+) ([]byte, error) {
+	var outBuf bytes.Buffer
+	err := pgp.writeEncryptedMessage(&outBuf, string(plainData), nil, publicKey, privateKey, passphrase, false, nil)
+	if err != nil {
+		return nil, err
+	}
+	return outBuf.Bytes(), nil
+}
+
+// writeEncryptedMessage encrypts and optionally signs plainText, writing the
+// binary message to w. If metadata is nil, the literal data is binary and has
+// no filename. If config is nil or disables compression, the message is not
+// compressed.
+func (pgp *GopenPGP) writeEncryptedMessage(
+	w io.Writer, plainText string, metadata *models.LiteralMetadata, publicKey, privateKey *KeyRing,
+	passphrase string, trim bool, config *packet.Config,
+) error {
+	if trim {
+		plainText = internal.TrimNewlines(plainText)
+	}
+	hints := &openpgp.FileHints{IsBinary: true}
+	if metadata != nil {
+		hints = &openpgp.FileHints{
+			IsBinary: metadata.IsBinary,
+			FileName: metadata.Filename,
+			ModTime:  time.Unix(metadata.ModTime, 0),
+		}
+		if !metadata.IsBinary {
+			plainText = internal.CanonicalizeLineEndings(plainText)
+		}
+	}
+
 	var signEntity *openpgp.Entity
 
 	if len(passphrase) > 0 && len(privateKey.entities) > 0 {
 		var err error
 		signEntity, err = privateKey.GetSigningEntity(passphrase)
 		if err != nil {
-			return "", err
+			return err
 		}
 	}
 
-	ew, err := EncryptCore(w, publicKey.entities, signEntity, "", false, pgp.getTimeGenerator())
+	if config == nil {
+		config = &packet.Config{DefaultHash: pgp.getSignatureHash(), Time: pgp.getTimeGenerator()}
+	}
+	config.DefaultCipher = pgp.getRecipientsCipher(publicKey.entities)
+	ew, err := encryptWithConfig(w, publicKey.entities, signEntity, hints, config, !hints.IsBinary)
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	_, err = ew.Write([]byte(plainText))
-	ew.Close()
-	w.Close()
-	return outBuf.String(), err
+	if _, err = ew.Write([]byte(plainText)); err != nil {
+		return err
+	}
+	return ew.Close()
 }
 
-// DecryptMessageWithPassword decrypts a pgp message with a password
-// encrypted string : armored pgp message
-// output string : clear text
-func (pgp *GopenPGP) DecryptMessageWithPassword(encrypted string, password string) (string, error) {
-	encryptedio, err := internal.Unarmor(encrypted)
+// EncryptSignStream encrypts the data read from plainReader to recipients and
+// signs it with signer in a single pass, writing the binary message to w. The
+// keyring signer must be unlocked. If reading or writing fails, the message
+// is left unterminated and the error is returned.
+func (pgp *GopenPGP) EncryptSignStream(w io.Writer, plainReader io.Reader, recipients, signer *KeyRing) error {
+	return pgp.EncryptSignStreamWithProgress(w, plainReader, -1, recipients, signer, nil)
+}
+
+// EncryptSignStreamContext is like EncryptSignStream, but stops reading
+// plainReader and returns the error of ctx once ctx is done. The message
+// written to w so far is then left unterminated and must be discarded.
+func (pgp *GopenPGP) EncryptSignStreamContext(
+	ctx context.Context, w io.Writer, plainReader io.Reader, recipients, signer *KeyRing,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	err := pgp.EncryptSignStream(w, &contextReader{ctx: ctx, r: plainReader}, recipients, signer)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
+
+// EncryptSignStreamWithProgress is like EncryptSignStream, but calls progress
+// with the number of bytes read from plainReader so far each time another
+// megabyte has been consumed, and once more when the input is exhausted.
+// totalBytes is passed through to progress and may be -1 if the input size is
+// unknown.
+func (pgp *GopenPGP) EncryptSignStreamWithProgress(
+	w io.Writer, plainReader io.Reader, totalBytes int64,
+	recipients, signer *KeyRing, progress func(bytesProcessed, totalBytes int64),
+) error {
+	if progress != nil {
+		plainReader = &progressReader{r: plainReader, total: totalBytes, progress: progress}
+	}
+
+	signEntity, err := signer.getUnlockedSigningEntity()
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	firstTimeCalled := true
-	var prompt = func(keys []openpgp.Key, symmetric bool) ([]byte, error) {
-		if firstTimeCalled {
-			firstTimeCalled = false
-			return []byte(password), nil
-		}
-		return nil, errors.New("password incorrect")
+	ew, err := encryptCore(w, recipients.entities, signEntity, "", false, pgp.getEncryptConfig(recipients.entities))
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(ew, plainReader); err != nil {
+		return fmt.Errorf("gopenpgp: cannot encrypt stream: %v", err)
+	}
+
+	if err = ew.Close(); err != nil {
+		return fmt.Errorf("gopenpgp: cannot finish encrypted stream: %v", err)
+	}
+	return nil
+}
+
+// EncryptSplitStream encrypts the data read from plainReader to recipients
+// with a fresh session key, and returns the session key packets and a reader
+// of the encrypted data packet, to be stored apart and joined again with
+// JoinMessage. The data packet is produced as dataReader is read, which must
+// be read to EOF or closed; if reading plainReader fails, reading dataReader
+// fails with that error.
+func (pgp *GopenPGP) EncryptSplitStream(
+	plainReader io.Reader, recipients *KeyRing,
+) (keyPacket []byte, dataReader io.ReadCloser, err error) {
+	if len(recipients.entities) == 0 {
+		return nil, nil, errors.New("gopenpgp: cannot encrypt message, no recipients")
+	}
+
+	cf := pgp.getRecipientsCipher(recipients.entities)
+	algo, err := getAlgo(cf)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := pgp.RandomTokenWith(cf.KeySize())
+	if err != nil {
+		return nil, nil, err
+	}
+	sk := &SymmetricKey{Key: key, Algo: algo}
+
+	keyPacket, err = pgp.keyPacketsForRecipients(sk, recipients)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reader, writer := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		writer.CloseWithError(pgp.writeDataPacket(writer, plainReader, sk))
+	}()
+	return keyPacket, &splitStreamReader{reader, done}, nil
+}
+
+// splitStreamReader reads the data packet written by EncryptSplitStream.
+type splitStreamReader struct {
+	*io.PipeReader
+	done chan struct{}
+}
+
+// Close abandons the data packet: the pending write of the encryption fails,
+// and Close waits for the encryption to return.
+func (r *splitStreamReader) Close() error {
+	err := r.PipeReader.CloseWithError(io.ErrClosedPipe)
+	<-r.done
+	return err
+}
+
+var compressionAlgos = map[string]packet.CompressionAlgo{
+	constants.CompressionNone: packet.CompressionNone,
+	constants.CompressionZIP:  packet.CompressionZIP,
+	constants.CompressionZLIB: packet.CompressionZLIB,
+}
+
+// getCompressionConfig returns a config that compresses with the named
+// algorithm at the given level.
+func (pgp *GopenPGP) getCompressionConfig(compression string, level int) (*packet.Config, error) {
+	algo, ok := compressionAlgos[compression]
+	if !ok {
+		return nil, errors.New("gopenpgp: unsupported compression algorithm: " + compression)
+	}
+	if level != constants.DefaultCompressionLevel && (level < constants.BestSpeed || level > constants.BestCompression) {
+		return nil, fmt.Errorf("gopenpgp: invalid compression level %d", level)
 	}
 
+	return &packet.Config{
+		Time:                   pgp.getTimeGenerator(),
+		DefaultHash:            pgp.getSignatureHash(),
+		DefaultCompressionAlgo: algo,
+		CompressionConfig:      &packet.CompressionConfig{Level: level},
+	}, nil
+}
+
+// DecryptMessageWithPassword decrypts a pgp message with a password
+// encrypted string : armored pgp message
+// output string : clear text
+func (pgp *GopenPGP) DecryptMessageWithPassword(encrypted string, password string) (plainText string, err error) {
+	defer recoverMalformedInput(&err)
+
 	config := &packet.Config{Time: pgp.getTimeGenerator()}
-	md, err := openpgp.ReadMessage(encryptedio.Body, nil, prompt, config)
+	md, err := pgp.readMessageWithPassword(encrypted, password, nil, config)
 	if err != nil {
 		return "", err
 	}
@@ -270,3 +1078,72 @@ func (pgp *GopenPGP) DecryptMessageWithPassword(encrypted string, password strin
 
 	return messageBuf.String(), nil
 }
+
+// DecryptMessageWithPasswordVerify decrypts a pgp message with a password and,
+// if verifierKey isn't nil, verifies its signature at verifyTime, as made by
+// EncryptSignMessageWithPassword. The verification status is set like in
+// DecryptMessageVerify.
+func (pgp *GopenPGP) DecryptMessageWithPasswordVerify(
+	encrypted string, password string, verifierKey *KeyRing, verifyTime int64,
+) (verified *models.DecryptSignedVerify, err error) {
+	defer recoverMalformedInput(&err)
+
+	if verifierKey == nil {
+		verifierKey = &KeyRing{}
+	}
+	out := &models.DecryptSignedVerify{}
+	out.Verify = failed
+	if len(verifierKey.entities) == 0 {
+		out.Verify = noVerifier
+	}
+
+	config := &packet.Config{Time: func() time.Time { return time.Unix(0, 0) }}
+	md, err := pgp.readMessageWithPassword(encrypted, password, verifierKey.entities, config)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := ioutil.ReadAll(md.UnverifiedBody)
+	if err != nil {
+		return nil, err
+	}
+
+	processSignatureExpiration(md, verifyTime)
+
+	out.Plaintext = string(b)
+	setVerifyResult(out, md, verifierKey)
+	return out, nil
+}
+
+// readMessageWithPassword starts decrypting the armored message encrypted with
+// password, looking up signers in verifierEntries.
+func (pgp *GopenPGP) readMessageWithPassword(
+	encrypted string, password string, verifierEntries openpgp.EntityList, config *packet.Config,
+) (*openpgp.MessageDetails, error) {
+	encryptedio, err := internal.Unarmor(encrypted)
+	if err != nil {
+		return nil, err
+	}
+
+	firstTimeCalled := true
+	var prompt = func(keys []openpgp.Key, symmetric bool) ([]byte, error) {
+		if firstTimeCalled {
+			firstTimeCalled = false
+			return []byte(password), nil
+		}
+		return nil, newCryptoError(constants.ErrorCodeWrongPassphrase, "password incorrect")
+	}
+
+	md, err := openpgp.ReadMessage(encryptedio.Body, verifierEntries, prompt, config)
+	if err != nil {
+		if isArmoredAEADEncrypted(encrypted) {
+			return nil, errAEADDataUnsupported
+		}
+		if isArmoredUnprotected(encrypted) {
+			return nil, ErrMessageNotProtected
+		}
+		return nil, err
+	}
+	md.UnverifiedBody = pgp.limitDecompressedSize(md.UnverifiedBody)
+	return md, nil
+}
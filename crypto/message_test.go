@@ -1,9 +1,25 @@
 package crypto
 
 import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/rand"
+	"errors"
 	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	mathrand "math/rand"
 	"strings"
 	"testing"
+	"time"
+
+	armorUtils "github.com/ProtonMail/gopenpgp/armor"
+	"github.com/ProtonMail/gopenpgp/constants"
+	"github.com/ProtonMail/gopenpgp/models"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
 )
 
 func TestMessageEncryptionWithPassword(t *testing.T) {
@@ -47,3 +63,1097 @@ func TestMessageEncryption(t *testing.T) {
 	}
 	assert.Exactly(t, message, plainText)
 }
+
+func TestMessageEncryptionBinary(t *testing.T) {
+	plainData := []byte{0x00, 0x01, 0xfe, 0xff}
+
+	encrypted, err := pgp.EncryptMessageBinary(plainData, testPublicKeyRing, testPrivateKeyRing, testMailboxPassword)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	decrypted, err := pgp.DecryptMessageBinary(encrypted, testPrivateKeyRing, testMailboxPassword)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+	assert.Exactly(t, plainData, decrypted)
+
+	armored, err := armorUtils.ArmorWithType(encrypted, constants.PGPMessageHeader)
+	if err != nil {
+		t.Fatal("Expected no error when armoring, got:", err)
+	}
+	plainText, err := pgp.DecryptMessage(armored, testPrivateKeyRing, testMailboxPassword)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+	assert.Exactly(t, string(plainData), plainText)
+}
+
+func TestDecryptTrailingData(t *testing.T) {
+	armored, err := pgp.EncryptMessage("plain text", testPublicKeyRing, nil, "", false)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	raw, err := armorUtils.Unarmor(armored)
+	if err != nil {
+		t.Fatal("Expected no error when unarmoring, got:", err)
+	}
+	withGarbage, err := armorUtils.ArmorWithType(append(raw, 0x00, 0x01, 0x02), constants.PGPMessageHeader)
+	if err != nil {
+		t.Fatal("Expected no error when armoring, got:", err)
+	}
+
+	for _, trailing := range []string{armored + "\n-- \nSent from my phone\n", armored + "\n" + armored, withGarbage} {
+		plainText, err := pgp.DecryptMessage(trailing, testPrivateKeyRing, testMailboxPassword)
+		if err != nil {
+			t.Fatal("Expected no error when decrypting, got:", err)
+		}
+		assert.Exactly(t, "plain text", plainText)
+
+		_, err = pgp.DecryptMessageStrict(trailing, testPrivateKeyRing, testMailboxPassword)
+		assert.Error(t, err)
+	}
+
+	plainText, err := pgp.DecryptMessageStrict(armored+"\n", testPrivateKeyRing, testMailboxPassword)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+	assert.Exactly(t, "plain text", plainText)
+}
+
+func TestMessageDecryptionWithMetadata(t *testing.T) {
+	var pgp = GopenPGP{}
+
+	decrypted, err := pgp.DecryptMessageWithMetadata(
+		readTestFile("message_literalMetadata", false), testPrivateKeyRing, testMailboxPassword,
+	)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+
+	assert.Exactly(t, "attachment contents\n", decrypted.Plaintext)
+	assert.Exactly(t, "report.txt", decrypted.Metadata.Filename)
+	assert.True(t, decrypted.Metadata.IsBinary)
+	assert.Exactly(t, int64(1792002072), decrypted.Metadata.ModTime)
+}
+
+func TestMessageEncryptionToSelf(t *testing.T) {
+	var pgp = GopenPGP{}
+	var message = "plain text to myself"
+
+	entity := generateTestEntity(t, name, name+"@"+domain)
+	recipient := &KeyRing{entities: openpgp.EntityList{entity}}
+
+	armored, err := pgp.EncryptMessageToSelf(message, recipient, testPublicKeyRing)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+
+	plainText, err := pgp.DecryptMessage(armored, testPrivateKeyRing, testMailboxPassword)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting own copy, got:", err)
+	}
+	assert.Exactly(t, message, plainText)
+
+	plainText, err = pgp.DecryptMessage(armored, recipient, "")
+	if err != nil {
+		t.Fatal("Expected no error when decrypting recipient copy, got:", err)
+	}
+	assert.Exactly(t, message, plainText)
+
+	// The sender is also a recipient
+	armored, err = pgp.EncryptMessageToSelf(message, testPublicKeyRing, testPrivateKeyRing)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	keyPackets, _, err := SplitMessage(armored)
+	if err != nil {
+		t.Fatal("Expected no error while splitting message, got:", err)
+	}
+	packets := packet.NewReader(bytes.NewReader(keyPackets))
+	if _, err = packets.Next(); err != nil {
+		t.Fatal("Expected no error while reading key packet, got:", err)
+	}
+	_, err = packets.Next()
+	assert.Exactly(t, io.EOF, err)
+}
+
+func TestGetEncryptionKeyIDs(t *testing.T) {
+	armored, err := pgp.EncryptMessage("plain text", testPublicKeyRing, nil, "", false)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	keyIDs, ok := GetEncryptionKeyIDs(armored)
+	assert.True(t, ok)
+	assert.Len(t, keyIDs, 1)
+	assert.Contains(t, testPrivateKeyRing.DecryptionKeyIds(), keyIDs[0])
+
+	token, err := pgp.RandomToken()
+	if err != nil {
+		t.Fatal("Expected no error while generating random token, got:", err)
+	}
+	symmetricKey := &SymmetricKey{Key: token, Algo: constants.AES256}
+	publicKey, _ := testPrivateKeyRing.GetArmoredPublicKey()
+	keyPacket, err := pgp.KeyPacketWithPublicKeysAnonymous(symmetricKey, []string{publicKey})
+	if err != nil {
+		t.Fatal("Expected no error while generating key packet, got:", err)
+	}
+	dataPacket, err := pgp.EncryptWithSessionKey([]byte("plain text"), symmetricKey)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting data packet, got:", err)
+	}
+	anonymous, err := JoinMessage(keyPacket, dataPacket)
+	if err != nil {
+		t.Fatal("Expected no error while joining message, got:", err)
+	}
+	keyIDs, ok = GetEncryptionKeyIDs(anonymous)
+	assert.False(t, ok)
+	assert.Empty(t, keyIDs)
+
+	withPassword, err := pgp.EncryptMessageWithPassword("plain text", "password")
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	_, ok = GetEncryptionKeyIDs(withPassword)
+	assert.False(t, ok)
+
+	_, ok = GetEncryptionKeyIDs("not a message")
+	assert.False(t, ok)
+}
+
+func TestEncryptMessageWithSessionKey(t *testing.T) {
+	privateKey, err := pgp.GenerateKey(name, domain, passphrase, "x25519", 0)
+	if err != nil {
+		t.Fatal("Expected no error while generating key, got:", err)
+	}
+	recipient, err := pgp.BuildKeyRingArmored(privateKey)
+	if err != nil {
+		t.Fatal("Expected no error while reading key, got:", err)
+	}
+
+	var custom = GopenPGP{}
+	custom.SetTimeFunc(func() time.Time { return time.Unix(testTime, 0) })
+	symmetricKey := &SymmetricKey{Key: bytes.Repeat([]byte{0x01}, 32), Algo: constants.AES256}
+
+	var messages [2][]byte
+	for i := range messages {
+		custom.SetConfig(&packet.Config{Rand: mathrand.New(mathrand.NewSource(42))})
+		armored, err := custom.EncryptMessageWithSessionKey("plain text", symmetricKey, recipient)
+		if err != nil {
+			t.Fatal("Expected no error when encrypting, got:", err)
+		}
+		if messages[i], err = armorUtils.Unarmor(armored); err != nil {
+			t.Fatal("Expected no error when unarmoring, got:", err)
+		}
+
+		plainText, err := pgp.DecryptMessage(armored, recipient, passphrase)
+		if err != nil {
+			t.Fatal("Expected no error when decrypting, got:", err)
+		}
+		assert.Exactly(t, "plain text", plainText)
+	}
+	assert.Exactly(t, messages[0], messages[1])
+
+	keyPacket, _, err := splitPackets(messages[0])
+	if err != nil {
+		t.Fatal("Expected no error while splitting message, got:", err)
+	}
+	sessionKey, err := pgp.GetSessionFromKeyPacket(keyPacket, recipient, passphrase)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting key packet, got:", err)
+	}
+	assert.Exactly(t, symmetricKey, sessionKey)
+
+	_, err = pgp.EncryptMessageWithSessionKey("plain text", symmetricKey, &KeyRing{})
+	assert.Error(t, err)
+
+	custom.SetTimeFunc(func() time.Time { return time.Now().Add(time.Hour) })
+	expiringKey, err := pgp.GenerateKeyWithExpiration(name, domain, passphrase, "x25519", 0, 60)
+	if err != nil {
+		t.Fatal("Expected no error while generating key, got:", err)
+	}
+	expiredRecipient, err := pgp.BuildKeyRingArmored(expiringKey)
+	if err != nil {
+		t.Fatal("Expected no error while reading key, got:", err)
+	}
+	_, err = custom.EncryptMessageWithSessionKey("plain text", symmetricKey, expiredRecipient)
+	assert.Exactly(t, constants.ErrorCodeKeyExpired, GetErrorCode(err))
+}
+
+func TestMessageEncryptionWithMetadata(t *testing.T) {
+	var pgp = GopenPGP{}
+
+	metadata := &models.LiteralMetadata{Filename: "notes.txt", IsBinary: false, ModTime: testTime}
+	armored, err := pgp.EncryptMessageWithMetadata(
+		"first line\nsecond line\r\n", metadata, testPublicKeyRing, testPrivateKeyRing, testMailboxPassword, false,
+	)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+
+	decrypted, err := pgp.DecryptMessageWithMetadata(armored, testPrivateKeyRing, testMailboxPassword)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+	assert.Exactly(t, "first line\r\nsecond line\r\n", decrypted.Plaintext)
+	assert.Exactly(t, metadata, decrypted.Metadata)
+
+	verified, err := pgp.DecryptMessageVerify(armored, testPublicKeyRing, testPrivateKeyRing, testMailboxPassword, 0)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+	assert.Exactly(t, ok, verified.Verify)
+
+	metadata = &models.LiteralMetadata{Filename: "image.png", IsBinary: true, ModTime: testTime}
+	armored, err = pgp.EncryptMessageWithMetadata("\x89PNG\r\n\x1a\n", metadata, testPublicKeyRing, nil, "", false)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+
+	decrypted, err = pgp.DecryptMessageWithMetadata(armored, testPrivateKeyRing, testMailboxPassword)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+	assert.Exactly(t, "\x89PNG\r\n\x1a\n", decrypted.Plaintext)
+	assert.Exactly(t, metadata, decrypted.Metadata)
+}
+
+func TestMessageDecryptionVerifyRequired(t *testing.T) {
+	var pgp = GopenPGP{}
+	var message = "signed plain text"
+
+	signed, err := pgp.EncryptMessage(message, testPublicKeyRing, testPrivateKeyRing, testMailboxPassword, false)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+
+	plainText, err := pgp.DecryptMessageVerifyRequired(
+		signed, testPublicKeyRing, testPrivateKeyRing, testMailboxPassword, pgp.GetTimeUnix(),
+	)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+	assert.Exactly(t, message, plainText)
+
+	entity := generateTestEntity(t, name, name+"@"+domain)
+	otherKeyRing := &KeyRing{entities: openpgp.EntityList{entity}}
+	_, err = pgp.DecryptMessageVerifyRequired(signed, otherKeyRing, testPrivateKeyRing, testMailboxPassword, 0)
+	assert.EqualError(t, err, "gopenpgp: message is not signed by the verifier key")
+
+	unsigned, err := pgp.EncryptMessage(message, testPublicKeyRing, nil, "", false)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	_, err = pgp.DecryptMessageVerifyRequired(unsigned, testPublicKeyRing, testPrivateKeyRing, testMailboxPassword, 0)
+	assert.Exactly(t, ErrMessageNotSigned, err)
+}
+
+func TestMessageDecryptionWithSignerInfo(t *testing.T) {
+	var pgp = GopenPGP{}
+	var message = "plain text from a stranger"
+
+	entity := generateTestEntity(t, name, name+"@"+domain)
+	strangerKeyRing := &KeyRing{entities: openpgp.EntityList{entity}}
+
+	var encrypted bytes.Buffer
+	err = pgp.EncryptSignStream(&encrypted, strings.NewReader(message), testPublicKeyRing, strangerKeyRing)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	signed, err := armorUtils.ArmorWithType(encrypted.Bytes(), constants.PGPMessageHeader)
+	if err != nil {
+		t.Fatal("Expected no error when armoring, got:", err)
+	}
+
+	decrypted, err := pgp.DecryptMessageWithSignerInfo(signed, testPrivateKeyRing, testMailboxPassword)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+	assert.Exactly(t, &models.DecryptedSignerInfo{
+		Plaintext:   message,
+		WasSigned:   true,
+		SignerKeyID: entity.PrimaryKey.KeyId,
+	}, decrypted)
+
+	unsigned, err := pgp.EncryptMessage(message, testPublicKeyRing, nil, "", false)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	decrypted, err = pgp.DecryptMessageWithSignerInfo(unsigned, testPrivateKeyRing, testMailboxPassword)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+	assert.Exactly(t, &models.DecryptedSignerInfo{Plaintext: message}, decrypted)
+}
+
+func TestMessageDecryptionAEAD(t *testing.T) {
+	var pgp = GopenPGP{}
+
+	const password = "my secret password"
+
+	sessionKey := &SymmetricKey{Key: make([]byte, 32), Algo: constants.AES256}
+	keyPacket, err := pgp.SymmetricKeyPacketWithPassword(sessionKey, password)
+	if err != nil {
+		t.Fatal("Expected no error while generating key packet, got:", err)
+	}
+
+	// Version 1, AES256, EAX, 4 KiB chunks, followed by an IV and ciphertext
+	aeadContents := append([]byte{1, 9, 1, 6}, make([]byte, 32)...)
+	aeadPacket := append([]byte{0xc0 | aeadEncryptedTag, byte(len(aeadContents))}, aeadContents...)
+
+	// Version 2, AES256, OCB, 4 KiB chunks, followed by a salt and ciphertext
+	seipdContents := append([]byte{2, 9, 2, 6}, make([]byte, 48)...)
+	seipdPacket := append([]byte{0xc0 | symmetricallyEncryptedMDCTag, byte(len(seipdContents))}, seipdContents...)
+
+	for _, dataPacket := range [][]byte{aeadPacket, seipdPacket} {
+		armored, err := armorUtils.ArmorWithType(append(keyPacket, dataPacket...), constants.PGPMessageHeader)
+		if err != nil {
+			t.Fatal("Expected no error while armoring message, got:", err)
+		}
+
+		_, err = pgp.DecryptMessageWithPassword(armored, password)
+		assert.Exactly(t, errAEADDataUnsupported, err)
+	}
+}
+
+func TestMessageEncryptionWithAllowedCiphers(t *testing.T) {
+	var pgp = GopenPGP{}
+	var message = "plain text"
+
+	// The test key prefers AES-192 and 3DES, which openpgp.Encrypt never picks
+	for _, cf := range []packet.CipherFunction{packet.CipherAES192, packet.Cipher3DES} {
+		if err := pgp.SetAllowedCiphers([]packet.CipherFunction{cf}); err != nil {
+			t.Fatal("Expected no error while setting allowed ciphers, got:", err)
+		}
+
+		for _, privateKey := range []*KeyRing{nil, testPrivateKeyRing} {
+			armored, err := pgp.EncryptMessage(message, testPublicKeyRing, privateKey, testMailboxPassword, false)
+			if err != nil {
+				t.Fatal("Expected no error when encrypting, got:", err)
+			}
+
+			keyPacket, _, err := SplitMessage(armored)
+			if err != nil {
+				t.Fatal("Expected no error while splitting message, got:", err)
+			}
+			sessionKey, err := pgp.GetSessionFromKeyPacket(keyPacket, testPrivateKeyRing, testMailboxPassword)
+			if err != nil {
+				t.Fatal("Expected no error while decrypting key packet, got:", err)
+			}
+			assert.Exactly(t, cf, sessionKey.GetCipherFunc())
+
+			decrypted, err := pgp.DecryptMessageVerify(armored, testPublicKeyRing, testPrivateKeyRing, testMailboxPassword, 0)
+			if err != nil {
+				t.Fatal("Expected no error when decrypting, got:", err)
+			}
+			assert.Exactly(t, message, decrypted.Plaintext)
+			if privateKey != nil {
+				assert.Exactly(t, ok, decrypted.Verify)
+			}
+		}
+	}
+}
+
+func TestMessageEncryptionWithoutPreferredCiphers(t *testing.T) {
+	var pgp = GopenPGP{}
+
+	// openpgp.Encrypt would fall back to CAST5 for this key
+	entity := generateTestEntity(t, name, name+"@"+domain)
+	for _, ident := range entity.Identities {
+		ident.SelfSignature.PreferredSymmetric = nil
+	}
+	keyRing := &KeyRing{entities: openpgp.EntityList{entity}}
+
+	armored, err := pgp.EncryptMessage("plain text", keyRing, nil, "", false)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	keyPacket, _, err := SplitMessage(armored)
+	if err != nil {
+		t.Fatal("Expected no error while splitting message, got:", err)
+	}
+	sessionKey, err := pgp.GetSessionFromKeyPacket(keyPacket, keyRing, "")
+	if err != nil {
+		t.Fatal("Expected no error while decrypting key packet, got:", err)
+	}
+	assert.Exactly(t, constants.AES256, sessionKey.Algo)
+
+	ap, err := pgp.EncryptAttachmentLowMemory(len("attachment"), "file.txt", keyRing)
+	if err != nil {
+		t.Fatal("Expected no error while creating attachment processor, got:", err)
+	}
+	ap.Process([]byte("attachment"))
+	split, err := ap.Finish()
+	if err != nil {
+		t.Fatal("Expected no error while encrypting attachment, got:", err)
+	}
+	assert.Exactly(t, constants.AES256, split.Algo)
+	sessionKey, err = pgp.GetSessionFromKeyPacket(split.KeyPacket, keyRing, "")
+	if err != nil {
+		t.Fatal("Expected no error while decrypting attachment key packet, got:", err)
+	}
+	assert.Exactly(t, constants.AES256, sessionKey.Algo)
+}
+
+func TestKeyRingEncryptTextWithAllowedCiphers(t *testing.T) {
+	defer func() { _ = pgp.SetAllowedCiphers(nil) }()
+	if err := pgp.SetAllowedCiphers([]packet.CipherFunction{packet.Cipher3DES}); err != nil {
+		t.Fatal("Expected no error while setting allowed ciphers, got:", err)
+	}
+
+	var b bytes.Buffer
+	w, err := testPublicKeyRing.Encrypt(&b, nil, "", true)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	if _, err = w.Write([]byte("first line\nsecond ")); err != nil {
+		t.Fatal("Expected no error when writing, got:", err)
+	}
+	if _, err = w.Write([]byte("line\r\n")); err != nil {
+		t.Fatal("Expected no error when writing, got:", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal("Expected no error when closing, got:", err)
+	}
+
+	armored, err := armorUtils.ArmorWithType(b.Bytes(), constants.PGPMessageHeader)
+	if err != nil {
+		t.Fatal("Expected no error when armoring, got:", err)
+	}
+	decrypted, err := pgp.DecryptMessage(armored, testPrivateKeyRing, testMailboxPassword)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+	assert.Exactly(t, "first line\r\nsecond line\r\n", decrypted)
+}
+
+func TestMessageEncryptionWithCompression(t *testing.T) {
+	var pgp = GopenPGP{}
+	var message = strings.Repeat("compressible plain text\n", 256)
+
+	uncompressed, err := pgp.EncryptMessage(message, testPublicKeyRing, nil, "", false)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+
+	for _, compression := range []string{constants.CompressionZIP, constants.CompressionZLIB} {
+		armored, err := pgp.EncryptMessageWithCompression(
+			message, testPublicKeyRing, testPrivateKeyRing, testMailboxPassword, false,
+			compression, constants.BestCompression,
+		)
+		if err != nil {
+			t.Fatal("Expected no error when encrypting with compression, got:", err)
+		}
+		assert.True(t, len(armored) < len(uncompressed))
+
+		decrypted, err := pgp.DecryptMessageVerify(armored, testPublicKeyRing, testPrivateKeyRing, testMailboxPassword, 0)
+		if err != nil {
+			t.Fatal("Expected no error when decrypting, got:", err)
+		}
+		assert.Exactly(t, message, decrypted.Plaintext)
+		assert.Exactly(t, ok, decrypted.Verify)
+	}
+
+	// AES-192 can't be negotiated by openpgp.Encrypt, but is still compressed
+	allowedPGP := GopenPGP{}
+	if err = allowedPGP.SetAllowedCiphers([]packet.CipherFunction{packet.CipherAES192}); err != nil {
+		t.Fatal("Expected no error while setting allowed ciphers, got:", err)
+	}
+	armored, err := allowedPGP.EncryptMessageWithCompression(
+		message, testPublicKeyRing, nil, "", false, constants.CompressionZLIB, constants.BestCompression,
+	)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting with compression, got:", err)
+	}
+	assert.True(t, len(armored) < len(uncompressed))
+	plainText, err := pgp.DecryptMessage(armored, testPrivateKeyRing, testMailboxPassword)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+	assert.Exactly(t, message, plainText)
+
+	armored, err = pgp.EncryptMessageWithCompression(
+		message, testPublicKeyRing, nil, "", false, constants.CompressionNone, constants.DefaultCompressionLevel,
+	)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting without compression, got:", err)
+	}
+	plainText, err = pgp.DecryptMessage(armored, testPrivateKeyRing, testMailboxPassword)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+	assert.Exactly(t, message, plainText)
+
+	_, err = pgp.EncryptMessageWithCompression(message, testPublicKeyRing, nil, "", false, "bzip2", 1)
+	assert.EqualError(t, err, "gopenpgp: unsupported compression algorithm: bzip2")
+
+	_, err = pgp.EncryptMessageWithCompression(message, testPublicKeyRing, nil, "", false, constants.CompressionZIP, 10)
+	assert.EqualError(t, err, "gopenpgp: invalid compression level 10")
+
+	// A key whose only encryption subkey expired
+	entity := generateTestEntity(t, name, name+"@"+domain)
+	subKey := entity.Subkeys[0]
+	lifetime := uint32(3600)
+	subKey.Sig.KeyLifetimeSecs = &lifetime
+	if err = subKey.Sig.SignKey(subKey.PublicKey, entity.PrivateKey, nil); err != nil {
+		t.Fatal("Expected no error while signing subkey, got:", err)
+	}
+	expiredKeyRing, err := pgp.BuildKeyRingArmored(serializeTestPublicKey(t, entity))
+	if err != nil {
+		t.Fatal("Expected no error while building key ring, got:", err)
+	}
+	pgp.SetTimeFunc(func() time.Time { return subKey.PublicKey.CreationTime.Add(2 * time.Hour) })
+
+	_, err = pgp.EncryptMessageWithCompression(
+		message, expiredKeyRing, nil, "", false, constants.CompressionZIP, constants.DefaultCompressionLevel,
+	)
+	assert.Exactly(t, constants.ErrorCodeKeyExpired, GetErrorCode(err))
+}
+
+func TestMessageEncryptionWithPasswordAndCompression(t *testing.T) {
+	var pgp = GopenPGP{}
+
+	const password = "my secret password"
+	var message = strings.Repeat("compressible plain text\n", 256)
+
+	armored, err := pgp.EncryptMessageWithPasswordAndCompression(message, password, constants.CompressionZLIB, constants.BestSpeed)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	assert.True(t, len(armored) < len(message))
+
+	text, err := pgp.DecryptMessageWithPassword(armored, password)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+	assert.Exactly(t, message, text)
+}
+
+func TestMessageEncryptionWithPasswordSigned(t *testing.T) {
+	var pgp = GopenPGP{}
+
+	const password = "my secret password"
+	var message = "plain text"
+
+	armored, err := pgp.EncryptSignMessageWithPassword(message, password, testPrivateKeyRing, testMailboxPassword)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting and signing, got:", err)
+	}
+
+	decrypted, err := pgp.DecryptMessageWithPasswordVerify(armored, password, testPublicKeyRing, pgp.GetTimeUnix())
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+	assert.Exactly(t, message, decrypted.Plaintext)
+	assert.Exactly(t, ok, decrypted.Verify)
+
+	decrypted, err = pgp.DecryptMessageWithPasswordVerify(armored, password, nil, 0)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+	assert.Exactly(t, message, decrypted.Plaintext)
+	assert.Exactly(t, noVerifier, decrypted.Verify)
+
+	text, err := pgp.DecryptMessageWithPassword(armored, password)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+	assert.Exactly(t, message, text)
+
+	_, err = pgp.DecryptMessageWithPasswordVerify(armored, "wrong password", testPublicKeyRing, 0)
+	assert.Error(t, err)
+
+	unsigned, err := pgp.EncryptMessageWithPassword(message, password)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	decrypted, err = pgp.DecryptMessageWithPasswordVerify(unsigned, password, testPublicKeyRing, 0)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+	assert.Exactly(t, notSigned, decrypted.Verify)
+}
+
+func TestDecryptUnprotectedMessage(t *testing.T) {
+	var pgp = GopenPGP{}
+	var message = "plain text"
+
+	sessionKey := &SymmetricKey{Algo: constants.AES256, Key: make([]byte, 32)}
+	if _, err := rand.Read(sessionKey.Key); err != nil {
+		t.Fatal("Expected no error while generating session key, got:", err)
+	}
+	keyPacket, err := pgp.KeyPacketWithPublicKey(sessionKey, readTestFile("keyring_publicKey", false))
+	if err != nil {
+		t.Fatal("Expected no error while generating key packet, got:", err)
+	}
+
+	// Legacy symmetrically encrypted data packet, without MDC
+	literal := append([]byte{0xcb, byte(6 + len(message)), 'b', 0, 0, 0, 0, 0}, message...)
+	block, err := aes.NewCipher(sessionKey.Key)
+	if err != nil {
+		t.Fatal("Expected no error while creating cipher, got:", err)
+	}
+	iv := make([]byte, aes.BlockSize)
+	if _, err = rand.Read(iv); err != nil {
+		t.Fatal("Expected no error while generating IV, got:", err)
+	}
+	stream, prefix := packet.NewOCFBEncrypter(block, iv, packet.OCFBResync)
+	encrypted := make([]byte, len(literal))
+	stream.XORKeyStream(encrypted, literal)
+	dataPacket := append([]byte{0xc9, byte(len(prefix) + len(encrypted))}, prefix...)
+	dataPacket = append(dataPacket, encrypted...)
+
+	armored, err := JoinMessage(keyPacket, dataPacket)
+	if err != nil {
+		t.Fatal("Expected no error while joining message, got:", err)
+	}
+
+	_, err = pgp.DecryptMessage(armored, testPrivateKeyRing, testMailboxPassword)
+	assert.Exactly(t, ErrMessageNotProtected, err)
+	assert.Exactly(t, constants.ErrorCodeNotProtected, GetErrorCode(err))
+
+	_, err = pgp.DecryptAttachment(keyPacket, dataPacket, testPrivateKeyRing, []byte(testMailboxPassword))
+	assert.Exactly(t, ErrMessageNotProtected, err)
+
+	_, err = pgp.DecryptWithSessionKey(dataPacket, sessionKey)
+	assert.Exactly(t, ErrMessageNotProtected, err)
+
+	_, err = pgp.DecryptMessageWithOptions(armored, testPrivateKeyRing, testMailboxPassword, nil)
+	assert.Exactly(t, ErrMessageNotProtected, err)
+
+	options := NewDecryptOptions()
+	options.RequireIntegrityProtection = false
+	decrypted, err := pgp.DecryptMessageWithOptions(armored, testPrivateKeyRing, testMailboxPassword, options)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting unprotected message, got:", err)
+	}
+	assert.Exactly(t, message, decrypted)
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestEncryptSignStream(t *testing.T) {
+	var pgp = GopenPGP{}
+	var message = strings.Repeat("streamed plain text\n", 1024)
+
+	var encrypted bytes.Buffer
+	err := pgp.EncryptSignStream(&encrypted, strings.NewReader(message), testPublicKeyRing, testPrivateKeyRing)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting stream, got:", err)
+	}
+
+	decrypted, signed, err := testPrivateKeyRing.Decrypt(&encrypted)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+	plainText, err := ioutil.ReadAll(decrypted)
+	if err != nil {
+		t.Fatal("Expected no error when reading decrypted data, got:", err)
+	}
+	assert.Exactly(t, message, string(plainText))
+	assert.NoError(t, signed.Err())
+	assert.True(t, signed.IsBy(testPublicKeyRing))
+
+	err = pgp.EncryptSignStream(failingWriter{}, strings.NewReader(message), testPublicKeyRing, testPrivateKeyRing)
+	assert.Error(t, err)
+
+	lockedKeyRing, _ := ReadArmoredKeyRing(strings.NewReader(readTestFile("keyring_privateKey", false)))
+	err = pgp.EncryptSignStream(&encrypted, strings.NewReader(message), testPublicKeyRing, lockedKeyRing)
+	assert.Exactly(t, errKeyringNotUnlocked, err)
+}
+
+func TestEncryptSignStreamWithDefaultCipher(t *testing.T) {
+	var pgp = GopenPGP{}
+	if err := pgp.SetDefaultCipher(packet.CipherAES128); err != nil {
+		t.Fatal("Expected no error while setting default cipher, got:", err)
+	}
+
+	var encrypted bytes.Buffer
+	err := pgp.EncryptSignStream(&encrypted, strings.NewReader("streamed plain text"), testPublicKeyRing, testPrivateKeyRing)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting stream, got:", err)
+	}
+	armored, err := armorUtils.ArmorWithType(encrypted.Bytes(), constants.PGPMessageHeader)
+	if err != nil {
+		t.Fatal("Expected no error when armoring, got:", err)
+	}
+	keyPacket, _, err := SplitMessage(armored)
+	if err != nil {
+		t.Fatal("Expected no error while splitting message, got:", err)
+	}
+	sessionKey, err := pgp.GetSessionFromKeyPacket(keyPacket, testPrivateKeyRing, testMailboxPassword)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting key packet, got:", err)
+	}
+	assert.Exactly(t, constants.AES128, sessionKey.Algo)
+}
+
+func TestEncryptSignStreamWithSignatureHash(t *testing.T) {
+	var pgp = GopenPGP{}
+	if err := pgp.SetSignatureHash(constants.SHA512); err != nil {
+		t.Fatal("Expected no error while setting signature hash, got:", err)
+	}
+
+	var encrypted bytes.Buffer
+	err := pgp.EncryptSignStream(&encrypted, strings.NewReader("streamed plain text"), testPublicKeyRing, testPrivateKeyRing)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting stream, got:", err)
+	}
+	decrypted, signed, err := testPrivateKeyRing.Decrypt(&encrypted)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+	if _, err = ioutil.ReadAll(decrypted); err != nil {
+		t.Fatal("Expected no error when reading decrypted data, got:", err)
+	}
+	assert.NoError(t, signed.Err())
+	assert.Exactly(t, crypto.SHA512, signed.md.Signature.Hash)
+}
+
+func TestEncryptSignStreamWithProgress(t *testing.T) {
+	var pgp = GopenPGP{}
+	var message = strings.Repeat("0123456789abcdef", 5<<16) // 5 MiB
+
+	var processed []int64
+	progress := func(bytesProcessed, totalBytes int64) {
+		assert.Exactly(t, int64(len(message)), totalBytes)
+		processed = append(processed, bytesProcessed)
+	}
+
+	var encrypted bytes.Buffer
+	err := pgp.EncryptSignStreamWithProgress(
+		&encrypted, strings.NewReader(message), int64(len(message)), testPublicKeyRing, testPrivateKeyRing, progress,
+	)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting stream, got:", err)
+	}
+	assert.Exactly(t, []int64{1 << 20, 2 << 20, 3 << 20, 4 << 20, 5 << 20}, processed)
+
+	decrypted, _, err := testPrivateKeyRing.Decrypt(&encrypted)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+	plainText, err := ioutil.ReadAll(decrypted)
+	if err != nil {
+		t.Fatal("Expected no error when reading decrypted data, got:", err)
+	}
+	assert.Exactly(t, message, string(plainText))
+}
+
+func TestDecryptStream(t *testing.T) {
+	var pgp = GopenPGP{}
+	var message = strings.Repeat("streamed plain text\n", 1024)
+
+	var encrypted bytes.Buffer
+	err := pgp.EncryptSignStream(&encrypted, strings.NewReader(message), testPublicKeyRing, testPrivateKeyRing)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting stream, got:", err)
+	}
+
+	decrypted, verify, err := pgp.DecryptStream(&encrypted, testPrivateKeyRing, testPublicKeyRing, 0)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting stream, got:", err)
+	}
+	assert.EqualError(t, verify(), "gopenpgp: cannot verify signature, message was not read to the end")
+
+	plainText, err := ioutil.ReadAll(decrypted)
+	if err != nil {
+		t.Fatal("Expected no error when reading decrypted stream, got:", err)
+	}
+	assert.Exactly(t, message, string(plainText))
+	assert.NoError(t, verify())
+
+	unsigned, err := pgp.EncryptMessage(message, testPublicKeyRing, nil, "", false)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	unsignedRaw, err := armorUtils.Unarmor(unsigned)
+	if err != nil {
+		t.Fatal("Expected no error when unarmoring, got:", err)
+	}
+
+	decrypted, verify, err = pgp.DecryptStream(bytes.NewReader(unsignedRaw), testPrivateKeyRing, testPublicKeyRing, 0)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting stream, got:", err)
+	}
+	_, _ = ioutil.ReadAll(decrypted)
+	assert.EqualError(t, verify(), "gopenpgp: message is not signed")
+
+	encrypted.Reset()
+	err = pgp.EncryptSignStream(&encrypted, strings.NewReader(message), testPublicKeyRing, testPrivateKeyRing)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting stream, got:", err)
+	}
+	decrypted, verify, err = pgp.DecryptStream(&encrypted, testPrivateKeyRing, nil, 0)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting stream without verifier, got:", err)
+	}
+	plainText, err = ioutil.ReadAll(decrypted)
+	if err != nil {
+		t.Fatal("Expected no error when reading decrypted stream, got:", err)
+	}
+	assert.Exactly(t, message, string(plainText))
+	assert.EqualError(t, verify(), "gopenpgp: message is not signed by the verifier key")
+}
+
+// cancelingReader cancels its context after the first read.
+type cancelingReader struct {
+	r      io.Reader
+	cancel context.CancelFunc
+}
+
+func (r cancelingReader) Read(b []byte) (int, error) {
+	defer r.cancel()
+	return r.r.Read(b)
+}
+
+func TestStreamContext(t *testing.T) {
+	var pgp = GopenPGP{}
+	var message = strings.Repeat("streamed plain text\n", 1<<16)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var partial bytes.Buffer
+	err := pgp.EncryptSignStreamContext(
+		ctx, &partial, cancelingReader{strings.NewReader(message), cancel}, testPublicKeyRing, testPrivateKeyRing,
+	)
+	assert.Exactly(t, context.Canceled, err)
+
+	var encrypted bytes.Buffer
+	err = pgp.EncryptSignStreamContext(
+		context.Background(), &encrypted, strings.NewReader(message), testPublicKeyRing, testPrivateKeyRing,
+	)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting stream, got:", err)
+	}
+	encryptedRaw := encrypted.Bytes()
+
+	decrypted, verify, err := pgp.DecryptStreamContext(
+		context.Background(), bytes.NewReader(encryptedRaw), testPrivateKeyRing, testPublicKeyRing, 0,
+	)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting stream, got:", err)
+	}
+	plainText, err := ioutil.ReadAll(decrypted)
+	if err != nil {
+		t.Fatal("Expected no error when reading decrypted stream, got:", err)
+	}
+	assert.Exactly(t, message, string(plainText))
+	assert.NoError(t, verify())
+
+	ctx, cancel = context.WithCancel(context.Background())
+	decrypted, verify, err = pgp.DecryptStreamContext(
+		ctx, bytes.NewReader(encryptedRaw), testPrivateKeyRing, testPublicKeyRing, 0,
+	)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting stream, got:", err)
+	}
+	_, err = ioutil.ReadAll(cancelingReader{decrypted, cancel})
+	assert.Exactly(t, context.Canceled, err)
+	assert.EqualError(t, verify(), "gopenpgp: cannot verify signature, message was not read to the end")
+
+	_, _, err = pgp.DecryptStreamContext(ctx, bytes.NewReader(encryptedRaw), testPrivateKeyRing, testPublicKeyRing, 0)
+	assert.Exactly(t, context.Canceled, err)
+}
+
+func TestEstimateEncryptedSize(t *testing.T) {
+	for _, plaintextLen := range []int{0, 100, 50000} {
+		for _, recipientCount := range []int{1, 3} {
+			recipients := &KeyRing{}
+			for i := 0; i < recipientCount; i++ {
+				recipients.entities = append(recipients.entities, testPublicKeyRing.entities...)
+			}
+
+			encrypted, err := pgp.EncryptMessage(strings.Repeat("a", plaintextLen), recipients, nil, "", false)
+			if err != nil {
+				t.Fatal("Expected no error when encrypting, got:", err)
+			}
+			rawEncrypted, err := armorUtils.Unarmor(encrypted)
+			if err != nil {
+				t.Fatal("Expected no error when unarmoring, got:", err)
+			}
+
+			estimated := pgp.EstimateEncryptedSize(plaintextLen, recipientCount, false)
+			assert.True(t, estimated >= len(rawEncrypted) && estimated-len(rawEncrypted) < 32)
+			estimated = pgp.EstimateEncryptedSize(plaintextLen, recipientCount, true)
+			assert.True(t, estimated >= len(encrypted) && estimated-len(encrypted) < 48)
+		}
+	}
+}
+
+func TestMaxDecompressedSize(t *testing.T) {
+	defer pgp.SetMaxDecompressedSize(0)
+
+	plainText := strings.Repeat("0", 1<<20)
+	encrypted, err := pgp.EncryptMessageWithPasswordAndCompression(
+		plainText, "password", constants.CompressionZLIB, constants.BestCompression,
+	)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	assert.True(t, len(encrypted) < 1<<14)
+
+	// The size is not limited by default
+	decrypted, err := pgp.DecryptMessageWithPassword(encrypted, "password")
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+	assert.Exactly(t, plainText, decrypted)
+
+	pgp.SetMaxDecompressedSize(1<<20 - 1)
+	_, err = pgp.DecryptMessageWithPassword(encrypted, "password")
+	assert.Exactly(t, ErrDecompressedSizeExceeded, err)
+	assert.Exactly(t, constants.ErrorCodeLimitExceeded, err.(*CryptoError).Code)
+
+	pgp.SetMaxDecompressedSize(1 << 20)
+	decrypted, err = pgp.DecryptMessageWithPassword(encrypted, "password")
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+	assert.Exactly(t, plainText, decrypted)
+
+	pgp.SetMaxDecompressedSize(-1)
+	decrypted, err = pgp.DecryptMessageWithPassword(encrypted, "password")
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+	assert.Exactly(t, plainText, decrypted)
+
+	pgp.SetMaxDecompressedSize(1 << 10)
+	armored, err := pgp.EncryptMessage(plainText, testPublicKeyRing, nil, "", false)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	_, err = pgp.DecryptMessage(armored, testPrivateKeyRing, testMailboxPassword)
+	assert.Exactly(t, ErrDecompressedSizeExceeded, err)
+	_, err = testPrivateKeyRing.DecryptMessage(armored)
+	assert.Exactly(t, ErrDecompressedSizeExceeded, err)
+}
+
+func TestDecryptMessageWithLimits(t *testing.T) {
+	var pgp = GopenPGP{}
+	plainText := strings.Repeat("0", 1<<20)
+
+	// Literal data compressed three times
+	var dataPacket bytes.Buffer
+	w, err := packet.SerializeSymmetricallyEncrypted(&dataPacket, testSymmetricKey.GetCipherFunc(), testSymmetricKey.Key, nil)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	for i := 0; i < 3; i++ {
+		if w, err = packet.SerializeCompressed(w, packet.CompressionZLIB, nil); err != nil {
+			t.Fatal("Expected no error when compressing, got:", err)
+		}
+	}
+	literal, err := packet.SerializeLiteral(w, true, "", 0)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	if _, err = literal.Write([]byte(plainText)); err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	// Closing the literal data packet closes all the enclosing packets
+	if err = literal.Close(); err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+
+	keyPacket, err := pgp.KeyPacketWithPublicKey(testSymmetricKey, readTestFile("keyring_publicKey", false))
+	if err != nil {
+		t.Fatal("Expected no error when encrypting session key, got:", err)
+	}
+	armored, err := JoinMessage(keyPacket, dataPacket.Bytes())
+	if err != nil {
+		t.Fatal("Expected no error when joining message, got:", err)
+	}
+
+	decrypted, err := pgp.DecryptMessageWithLimits(armored, testPrivateKeyRing, testMailboxPassword, nil)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+	assert.Exactly(t, plainText, decrypted)
+
+	decrypted, err = pgp.DecryptMessageWithLimits(armored, testPrivateKeyRing, testMailboxPassword, &DecryptLimits{
+		MaxSize:             1 << 20,
+		MaxCompressionDepth: 3,
+	})
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+	assert.Exactly(t, plainText, decrypted)
+
+	_, err = pgp.DecryptMessageWithLimits(armored, testPrivateKeyRing, testMailboxPassword, &DecryptLimits{
+		MaxSize: 1<<20 - 1,
+	})
+	assert.Exactly(t, ErrDecompressedSizeExceeded, err)
+
+	_, err = pgp.DecryptMessageWithLimits(armored, testPrivateKeyRing, testMailboxPassword, &DecryptLimits{
+		MaxCompressionDepth: 2,
+	})
+	assert.Exactly(t, ErrCompressionTooDeep, err)
+	assert.Exactly(t, constants.ErrorCodeLimitExceeded, err.(*CryptoError).Code)
+}
+
+func TestEncryptSplitStream(t *testing.T) {
+	plainText := strings.Repeat("plain text ", 1<<16)
+
+	keyPacket, dataReader, err := pgp.EncryptSplitStream(strings.NewReader(plainText), testPublicKeyRing)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	dataPacket, err := ioutil.ReadAll(dataReader)
+	if err != nil {
+		t.Fatal("Expected no error when reading data packet, got:", err)
+	}
+
+	armored, err := JoinMessage(keyPacket, dataPacket)
+	if err != nil {
+		t.Fatal("Expected no error when joining message, got:", err)
+	}
+	decrypted, err := pgp.DecryptMessage(armored, testPrivateKeyRing, testMailboxPassword)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+	assert.Exactly(t, plainText, decrypted)
+
+	readErr := errors.New("read error")
+	plainReader, plainWriter := io.Pipe()
+	plainWriter.CloseWithError(readErr)
+	_, dataReader, err = pgp.EncryptSplitStream(plainReader, testPublicKeyRing)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	_, err = ioutil.ReadAll(dataReader)
+	assert.Exactly(t, readErr, err)
+
+	_, _, err = pgp.EncryptSplitStream(strings.NewReader(plainText), &KeyRing{})
+	assert.EqualError(t, err, "gopenpgp: cannot encrypt message, no recipients")
+}
+
+type endlessReader struct{}
+
+func (endlessReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 'a'
+	}
+	return len(p), nil
+}
+
+func TestEncryptSplitStreamClose(t *testing.T) {
+	_, dataReader, err := pgp.EncryptSplitStream(endlessReader{}, testPublicKeyRing)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	if _, err = io.ReadFull(dataReader, make([]byte, 1024)); err != nil {
+		t.Fatal("Expected no error when reading data packet, got:", err)
+	}
+
+	// Close returns once the encryption stopped, instead of blocking forever
+	// on the endless plain text.
+	if err = dataReader.Close(); err != nil {
+		t.Fatal("Expected no error when closing data packet, got:", err)
+	}
+	_, err = dataReader.Read(make([]byte, 1))
+	assert.Exactly(t, io.ErrClosedPipe, err)
+}
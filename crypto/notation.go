@@ -0,0 +1,200 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ProtonMail/gopenpgp/armor"
+	"github.com/ProtonMail/gopenpgp/constants"
+	"github.com/ProtonMail/gopenpgp/internal"
+
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// notationSubpacket is the notation data subpacket type, RFC 4880 section
+// 5.2.3.16. The crypto library neither writes nor reads it.
+const notationSubpacket = 20
+
+// criticalSubpacketFlag is set on the type of subpackets that verifiers must
+// recognize.
+const criticalSubpacketFlag = 0x80
+
+// notationHumanReadable is the flag of the first notation flag byte telling
+// that the value is text.
+const notationHumanReadable = 0x80
+
+// Notation is a name=value pair embedded in the hashed area of a signature,
+// e.g. issuer@example.com=12345. Names of user-defined notations have the form
+// name@domain.
+type Notation struct {
+	Name string
+	// Value is text if HumanReadable is set, arbitrary data otherwise.
+	Value         []byte
+	HumanReadable bool
+	// Critical notations make the signature invalid for verifiers that don't
+	// recognize them. This library recognizes none, so it rejects signatures
+	// with critical notations.
+	Critical bool
+}
+
+// SignDetachedWithNotations is like SignDetachedArmored, but embeds notations
+// in the signature, see SignatureInfo.Notations. The crypto library can't write
+// notations, so the signature is built here.
+func (kr *KeyRing) SignDetachedWithNotations(plainData []byte, notations []*Notation) (string, error) {
+	now := pgp.getNow()
+	signingKey, err := kr.getSigningKey(now)
+	if err != nil {
+		return "", err
+	}
+
+	var subpackets bytes.Buffer
+	for _, notation := range notations {
+		contents, err := serializeNotation(notation)
+		if err != nil {
+			return "", err
+		}
+		subpacketType := byte(notationSubpacket)
+		if notation.Critical {
+			subpacketType |= criticalSubpacketFlag
+		}
+		writeSubpacket(&subpackets, subpacketType, contents)
+	}
+
+	sig, err := signV4(signingKey, packet.SigTypeBinary, pgp.getSignatureHash(), now, subpackets.Bytes(), plainData)
+	if err != nil {
+		return "", err
+	}
+	return armor.ArmorWithType(sig, constants.PGPSignatureHeader)
+}
+
+// serializeNotation returns the contents of the notation data subpacket of
+// notation.
+func serializeNotation(notation *Notation) ([]byte, error) {
+	if notation.Name == "" {
+		return nil, errors.New("gopenpgp: notation name can't be empty")
+	}
+	if len(notation.Name) > 0xffff || len(notation.Value) > 0xffff {
+		return nil, fmt.Errorf("gopenpgp: notation %s is too large", notation.Name)
+	}
+
+	contents := make([]byte, 8, 8+len(notation.Name)+len(notation.Value))
+	if notation.HumanReadable {
+		contents[0] = notationHumanReadable
+	}
+	binary.BigEndian.PutUint16(contents[4:], uint16(len(notation.Name)))
+	binary.BigEndian.PutUint16(contents[6:], uint16(len(notation.Value)))
+	contents = append(contents, notation.Name...)
+	contents = append(contents, notation.Value...)
+	return contents, nil
+}
+
+// readNotations returns the notations of the hashed area of an armored v4
+// signature. Notations of the unhashed area aren't authenticated and are
+// ignored.
+func readNotations(signature string) ([]*Notation, error) {
+	block, err := internal.Unarmor(signature)
+	if err != nil {
+		return nil, err
+	}
+	op, err := packet.NewOpaqueReader(block.Body).Next()
+	if err != nil {
+		return nil, err
+	}
+	if op.Tag != signatureTag {
+		return nil, nil
+	}
+	subpackets, err := readHashedSubpackets(op.Contents)
+	if err != nil {
+		return nil, err
+	}
+
+	var notations []*Notation
+	for _, subpacket := range subpackets {
+		if subpacket.subpacketType&^criticalSubpacketFlag != notationSubpacket {
+			continue
+		}
+		data := subpacket.contents
+		if len(data) < 8 {
+			return nil, errors.New("gopenpgp: notation subpacket is truncated")
+		}
+		nameLength := int(binary.BigEndian.Uint16(data[4:6]))
+		valueLength := int(binary.BigEndian.Uint16(data[6:8]))
+		if len(data) != 8+nameLength+valueLength {
+			return nil, errors.New("gopenpgp: invalid notation subpacket length")
+		}
+		notations = append(notations, &Notation{
+			Name:          string(data[8 : 8+nameLength]),
+			Value:         data[8+nameLength:],
+			HumanReadable: data[0]&notationHumanReadable != 0,
+			Critical:      subpacket.subpacketType&criticalSubpacketFlag != 0,
+		})
+	}
+	return notations, nil
+}
+
+// rawSubpacket is a signature subpacket. Its type includes the critical bit.
+type rawSubpacket struct {
+	subpacketType byte
+	contents      []byte
+}
+
+// readHashedSubpackets returns the subpackets of the hashed area of the body
+// of a signature packet, or none if it isn't a v4 signature.
+func readHashedSubpackets(body []byte) ([]rawSubpacket, error) {
+	if len(body) < 6 || body[0] != signatureVersion {
+		return nil, nil
+	}
+	hashedLength := int(binary.BigEndian.Uint16(body[4:6]))
+	if len(body) < 6+hashedLength {
+		return nil, errors.New("gopenpgp: signature subpackets are truncated")
+	}
+
+	r := bytes.NewReader(body[6 : 6+hashedLength])
+	var subpackets []rawSubpacket
+	for r.Len() > 0 {
+		subpacketType, contents, err := readSubpacket(r)
+		if err != nil {
+			return nil, err
+		}
+		subpackets = append(subpackets, rawSubpacket{subpacketType, contents})
+	}
+	return subpackets, nil
+}
+
+// readSubpacket reads a signature subpacket, RFC 4880 section 5.2.3.1, and
+// returns its type, including the critical bit, and its contents.
+func readSubpacket(r *bytes.Reader) (subpacketType byte, contents []byte, err error) {
+	var length int
+	first, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	switch {
+	case first < 192:
+		length = int(first)
+	case first < 255:
+		second, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, io.ErrUnexpectedEOF
+		}
+		length = (int(first)-192)<<8 + int(second) + 192
+	default:
+		b := make([]byte, 4)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return 0, nil, io.ErrUnexpectedEOF
+		}
+		length = int(binary.BigEndian.Uint32(b))
+	}
+	if length < 1 || length > r.Len() {
+		return 0, nil, errors.New("gopenpgp: invalid signature subpacket length")
+	}
+
+	contents = make([]byte, length)
+	if _, err := io.ReadFull(r, contents); err != nil {
+		return 0, nil, err
+	}
+	return contents[0], contents[1:], nil
+}
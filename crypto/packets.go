@@ -0,0 +1,111 @@
+package crypto
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/ProtonMail/gopenpgp/models"
+
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// packetNames are the packet type names of RFC 4880, section 4.3.
+var packetNames = map[uint8]string{
+	1:  "Public-Key Encrypted Session Key",
+	2:  "Signature",
+	3:  "Symmetric-Key Encrypted Session Key",
+	4:  "One-Pass Signature",
+	5:  "Secret-Key",
+	6:  "Public-Key",
+	7:  "Secret-Subkey",
+	8:  "Compressed Data",
+	9:  "Symmetrically Encrypted Data",
+	10: "Marker",
+	11: "Literal Data",
+	12: "Trust",
+	13: "User ID",
+	14: "Public-Subkey",
+	17: "User Attribute",
+	18: "Sym. Encrypted Integrity Protected Data",
+	19: "Modification Detection Code",
+	20: "AEAD Encrypted Data",
+}
+
+// DescribePackets lists the packets of the binary OpenPGP data b, with a few
+// fields depending on their type, without decrypting anything. Packets that
+// can't be parsed are still listed with their tag and length.
+func (pgp *GopenPGP) DescribePackets(b []byte) ([]models.PacketDescription, error) {
+	var descriptions []models.PacketDescription
+	packets := packet.NewOpaqueReader(bytes.NewReader(b))
+	for {
+		op, err := packets.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("gopenpgp: cannot read packet %d: %v", len(descriptions), err)
+		}
+		descriptions = append(descriptions, describePacket(op))
+	}
+	return descriptions, nil
+}
+
+func describePacket(op *packet.OpaquePacket) models.PacketDescription {
+	description := models.PacketDescription{
+		Tag:    int(op.Tag),
+		Name:   packetNames[op.Tag],
+		Length: len(op.Contents),
+	}
+	if description.Name == "" {
+		description.Name = fmt.Sprintf("Unknown (tag %d)", op.Tag)
+	}
+
+	// Compressed data can't be parsed without decompressing it
+	if op.Tag == 8 {
+		if len(op.Contents) > 0 {
+			for name, algo := range compressionAlgos {
+				if uint8(algo) == op.Contents[0] {
+					description.Algorithm = name
+				}
+			}
+		}
+		return description
+	}
+
+	p, err := op.Parse()
+	if err != nil {
+		return description
+	}
+
+	switch p := p.(type) {
+	case *packet.EncryptedKey:
+		description.KeyID = p.KeyId
+		description.Algorithm = pubKeyAlgos[p.Algo]
+	case *packet.SymmetricKeyEncrypted:
+		description.Algorithm, _ = getAlgo(p.CipherFunc)
+	case *packet.Signature:
+		if p.IssuerKeyId != nil {
+			description.KeyID = *p.IssuerKeyId
+		}
+		description.Algorithm = pubKeyAlgos[p.PubKeyAlgo]
+		description.Hash = hashAlgos[p.Hash]
+	case *packet.SignatureV3:
+		description.KeyID = p.IssuerKeyId
+		description.Algorithm = pubKeyAlgos[p.PubKeyAlgo]
+		description.Hash = hashAlgos[p.Hash]
+	case *packet.OnePassSignature:
+		description.KeyID = p.KeyId
+		description.Algorithm = pubKeyAlgos[p.PubKeyAlgo]
+		description.Hash = hashAlgos[p.Hash]
+	case *packet.PrivateKey:
+		description.KeyID = p.KeyId
+		description.Algorithm = pubKeyAlgos[p.PubKeyAlgo]
+	case *packet.PublicKey:
+		description.KeyID = p.KeyId
+		description.Algorithm = pubKeyAlgos[p.PubKeyAlgo]
+	case *packet.LiteralData:
+		description.Filename = p.FileName
+	}
+	return description
+}
@@ -0,0 +1,72 @@
+package crypto
+
+import (
+	"testing"
+
+	"github.com/ProtonMail/gopenpgp/armor"
+	"github.com/ProtonMail/gopenpgp/constants"
+	"github.com/ProtonMail/gopenpgp/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDescribePackets(t *testing.T) {
+	encrypted, err := pgp.EncryptMessage("plain text", testPublicKeyRing, nil, "", false)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	rawEncrypted, err := armor.Unarmor(encrypted)
+	if err != nil {
+		t.Fatal("Expected no error when unarmoring, got:", err)
+	}
+
+	descriptions, err := pgp.DescribePackets(rawEncrypted)
+	if err != nil {
+		t.Fatal("Expected no error when describing packets, got:", err)
+	}
+	if len(descriptions) != 2 {
+		t.Fatal("Expected 2 packets, got:", len(descriptions))
+	}
+	assert.Exactly(t, models.PacketDescription{
+		Tag:       1,
+		Name:      "Public-Key Encrypted Session Key",
+		Length:    descriptions[0].Length,
+		KeyID:     testPublicKeyRing.GetEntities()[0].Subkeys[0].PublicKey.KeyId,
+		Algorithm: "rsa",
+	}, descriptions[0])
+	assert.Exactly(t, 18, descriptions[1].Tag)
+	assert.Exactly(t, "Sym. Encrypted Integrity Protected Data", descriptions[1].Name)
+
+	symEncrypted, err := pgp.EncryptMessageWithPasswordAndCompression("plain text", "password", constants.CompressionZLIB, 6)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting with password, got:", err)
+	}
+	rawSymEncrypted, err := armor.Unarmor(symEncrypted)
+	if err != nil {
+		t.Fatal("Expected no error when unarmoring, got:", err)
+	}
+	descriptions, err = pgp.DescribePackets(rawSymEncrypted)
+	if err != nil {
+		t.Fatal("Expected no error when describing packets, got:", err)
+	}
+	assert.Exactly(t, 3, descriptions[0].Tag)
+	assert.Exactly(t, constants.AES128, descriptions[0].Algorithm)
+
+	rawKey, err := armor.Unarmor(readTestFile("keyring_publicKey", false))
+	if err != nil {
+		t.Fatal("Expected no error when unarmoring, got:", err)
+	}
+	descriptions, err = pgp.DescribePackets(rawKey)
+	if err != nil {
+		t.Fatal("Expected no error when describing packets, got:", err)
+	}
+	var tags []int
+	for _, description := range descriptions {
+		tags = append(tags, description.Tag)
+	}
+	assert.Exactly(t, []int{6, 13, 2, 14, 2}, tags)
+	assert.Exactly(t, constants.SHA256, descriptions[2].Hash)
+	assert.Exactly(t, testPublicKeyRing.GetEntities()[0].PrimaryKey.KeyId, descriptions[2].KeyID)
+
+	_, err = pgp.DescribePackets([]byte{0xc1, 0x05, 0x00})
+	assert.Error(t, err)
+}
@@ -0,0 +1,125 @@
+package crypto
+
+import (
+	"bytes"
+
+	"github.com/ProtonMail/gopenpgp/constants"
+
+	"golang.org/x/crypto/openpgp/packet"
+	"golang.org/x/crypto/openpgp/s2k"
+)
+
+// Self-signature subpacket types the crypto library doesn't expose, RFC 4880
+// section 5.2.3.1.
+const (
+	preferredKeyServerSubpacket = 24
+	policyURLSubpacket          = 26
+	featuresSubpacket           = 30
+)
+
+// KeyPreferences are the preferences a key owner states in the self-signature of
+// the primary user ID of their key. Algorithms this library doesn't support are
+// left out of the lists, which are ordered from most to least preferred.
+type KeyPreferences struct {
+	// SymmetricCiphers are cipher names, e.g. constants.AES256.
+	SymmetricCiphers []string
+	// Hashes are hash algorithm names, e.g. constants.SHA256.
+	Hashes []string
+	// Compressions are compression algorithm names, e.g.
+	// constants.CompressionZLIB.
+	Compressions []string
+	// PreferredKeyServer is the URL of the key server to refresh the key from,
+	// or empty.
+	PreferredKeyServer string
+	// PolicyURL is the URL of the policy under which the self-signature was
+	// issued, or empty.
+	PolicyURL string
+	// Features is the first octet of the features subpacket, 0x01 meaning that
+	// the key owner supports integrity protected messages.
+	Features byte
+}
+
+// GetPreferences returns the preferences of the first key of kr, from the
+// self-signature of its primary user ID. The zero value is returned if kr has
+// no key or no user ID.
+func (kr *KeyRing) GetPreferences() KeyPreferences {
+	var prefs KeyPreferences
+	if len(kr.entities) == 0 {
+		return prefs
+	}
+	i := getPrimaryIdentity(kr.entities[0])
+	if i == nil || i.SelfSignature == nil {
+		return prefs
+	}
+	sig := i.SelfSignature
+
+	for _, id := range sig.PreferredSymmetric {
+		if name, ok := getCipherName(packet.CipherFunction(id)); ok {
+			prefs.SymmetricCiphers = append(prefs.SymmetricCiphers, name)
+		}
+	}
+	for _, id := range sig.PreferredHash {
+		if h, ok := s2k.HashIdToHash(id); ok {
+			if name, ok := hashAlgos[h]; ok {
+				prefs.Hashes = append(prefs.Hashes, name)
+			}
+		}
+	}
+	for _, id := range sig.PreferredCompression {
+		for name, algo := range compressionAlgos {
+			if algo == packet.CompressionAlgo(id) {
+				prefs.Compressions = append(prefs.Compressions, name)
+			}
+		}
+	}
+
+	// The crypto library drops these subpackets, but keeps them for
+	// serialization
+	for _, subpacket := range getSelfSignatureSubpackets(sig) {
+		switch subpacket.subpacketType &^ criticalSubpacketFlag {
+		case preferredKeyServerSubpacket:
+			prefs.PreferredKeyServer = string(subpacket.contents)
+		case policyURLSubpacket:
+			prefs.PolicyURL = string(subpacket.contents)
+		case featuresSubpacket:
+			if len(subpacket.contents) > 0 {
+				prefs.Features = subpacket.contents[0]
+			}
+		}
+	}
+	if sig.MDC {
+		prefs.Features |= 0x01
+	}
+	return prefs
+}
+
+// getCipherName returns the name of cf, constants.ThreeDES for 3DES.
+func getCipherName(cf packet.CipherFunction) (string, bool) {
+	if cf == packet.Cipher3DES {
+		return constants.ThreeDES, true
+	}
+	for name, algo := range symKeyAlgos {
+		if algo == cf {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// getSelfSignatureSubpackets returns the hashed subpackets of sig, or none if
+// it can't be serialized.
+func getSelfSignatureSubpackets(sig *packet.Signature) []rawSubpacket {
+	var b bytes.Buffer
+	if err := sig.Serialize(&b); err != nil {
+		return nil
+	}
+	op, err := packet.NewOpaqueReader(&b).Next()
+	if err != nil {
+		return nil
+	}
+	subpackets, err := readHashedSubpackets(op.Contents)
+	if err != nil {
+		return nil
+	}
+	return subpackets
+}
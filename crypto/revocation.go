@@ -0,0 +1,233 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"time"
+
+	"github.com/ProtonMail/gopenpgp/armor"
+	"github.com/ProtonMail/gopenpgp/constants"
+
+	"golang.org/x/crypto/openpgp/packet"
+	"golang.org/x/crypto/openpgp/s2k"
+)
+
+// Signature packet constants from RFC 4880, section 5.2.
+const (
+	signatureTag              = 2
+	signatureVersion          = 4
+	creationTimeSubpacket     = 2
+	issuerSubpacket           = 16
+	revocationReasonSubpacket = 29
+)
+
+// sigTypeCertificationRevocation is the signature type that revokes a user ID,
+// which the crypto library doesn't define.
+const sigTypeCertificationRevocation packet.SignatureType = 0x30
+
+// GenerateRevocationCertificate creates an armored revocation certificate for
+// the primary key of privateKey, unlocking it with passphrase if needed. reason
+// is one of the constants.RevocationReason* codes, and reasonText is an
+// optional human-readable explanation.
+func (pgp *GopenPGP) GenerateRevocationCertificate(
+	privateKey *KeyRing, passphrase []byte, reason int, reasonText string,
+) (string, error) {
+	switch reason {
+	case constants.RevocationReasonNoReason, constants.RevocationReasonKeySuperseded,
+		constants.RevocationReasonKeyCompromised, constants.RevocationReasonKeyRetired:
+	default:
+		return "", fmt.Errorf("gopenpgp: invalid revocation reason %d", reason)
+	}
+
+	if len(privateKey.entities) == 0 || privateKey.entities[0].PrivateKey == nil {
+		return "", errors.New("gopenpgp: cannot revoke key, no private key available")
+	}
+	entity := privateKey.entities[0]
+
+	// Work on a copy so that the keyring keeps its lock state
+	priv, err := getUnlockedPrimaryKey(entity, passphrase)
+	if err != nil {
+		return "", err
+	}
+
+	var reasonSubpacket bytes.Buffer
+	writeSubpacket(&reasonSubpacket, revocationReasonSubpacket, append([]byte{byte(reason)}, reasonText...))
+
+	// RFC 4880, section 5.2.4
+	publicKey, err := serializePublicKeyBody(entity.PrimaryKey)
+	if err != nil {
+		return "", err
+	}
+	prefix := append([]byte{0x99, byte(len(publicKey) >> 8), byte(len(publicKey))}, publicKey...)
+
+	sig, err := signV4(
+		priv, packet.SigTypeKeyRevocation, pgp.getSignatureHash(), pgp.getNow(), reasonSubpacket.Bytes(), prefix,
+	)
+	if err != nil {
+		return "", err
+	}
+	return armor.ArmorKey(sig)
+}
+
+// signV4 returns a v4 signature packet of sigType made by priv at
+// creationTime, RFC 4880 section 5.2.3, over prefix, the data hashed before
+// the signature fields. The hashed area holds the creation time and issuer
+// subpackets followed by subpackets. It is used for the signatures with
+// subpackets that the crypto library can't write.
+func signV4(
+	priv *packet.PrivateKey, sigType packet.SignatureType, hash crypto.Hash,
+	creationTime time.Time, subpackets, prefix []byte,
+) ([]byte, error) {
+	hashID, ok := s2k.HashToHashId(hash)
+	if !ok {
+		return nil, fmt.Errorf("gopenpgp: unsupported signature hash %v", hash)
+	}
+
+	var hashedSubpackets bytes.Buffer
+	creationTimeBytes := make([]byte, 4)
+	binary.BigEndian.PutUint32(creationTimeBytes, uint32(creationTime.Unix()))
+	writeSubpacket(&hashedSubpackets, creationTimeSubpacket, creationTimeBytes)
+	issuer := make([]byte, 8)
+	binary.BigEndian.PutUint64(issuer, priv.KeyId)
+	writeSubpacket(&hashedSubpackets, issuerSubpacket, issuer)
+	hashedSubpackets.Write(subpackets)
+	if hashedSubpackets.Len() > 0xffff {
+		return nil, errors.New("gopenpgp: signature subpackets are too large")
+	}
+
+	hashed := []byte{signatureVersion, byte(sigType), byte(priv.PubKeyAlgo), hashID}
+	hashed = append(hashed, byte(hashedSubpackets.Len()>>8), byte(hashedSubpackets.Len()))
+	hashed = append(hashed, hashedSubpackets.Bytes()...)
+
+	// RFC 4880, section 5.2.4
+	h := hash.New()
+	h.Write(prefix)
+	h.Write(hashed)
+	trailer := make([]byte, 6)
+	trailer[0] = signatureVersion
+	trailer[1] = 0xff
+	binary.BigEndian.PutUint32(trailer[2:], uint32(len(hashed)))
+	h.Write(trailer)
+	digest := h.Sum(nil)
+
+	mpis, err := signDigest(priv, digest, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	var body bytes.Buffer
+	body.Write(hashed)
+	body.Write([]byte{0, 0}) // No unhashed subpackets
+	body.Write(digest[:2])
+	for _, mpi := range mpis {
+		writeMPI(&body, mpi)
+	}
+
+	var sig bytes.Buffer
+	writePacketHeader(&sig, signatureTag, body.Len())
+	body.WriteTo(&sig)
+	return sig.Bytes(), nil
+}
+
+// signDigest signs digest, computed with hash, with priv and returns the
+// signature MPIs.
+func signDigest(priv *packet.PrivateKey, digest []byte, hash crypto.Hash) ([][]byte, error) {
+	switch priv.PubKeyAlgo {
+	case packet.PubKeyAlgoRSA, packet.PubKeyAlgoRSASignOnly:
+		signer, ok := priv.PrivateKey.(crypto.Signer)
+		if !ok {
+			return nil, errors.New("gopenpgp: invalid RSA private key")
+		}
+		s, err := signer.Sign(rand.Reader, digest, hash)
+		if err != nil {
+			return nil, err
+		}
+		return [][]byte{s}, nil
+	case packet.PubKeyAlgoECDSA:
+		ecdsaPriv, ok := priv.PrivateKey.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("gopenpgp: invalid ECDSA private key")
+		}
+		r, s, err := ecdsa.Sign(rand.Reader, ecdsaPriv, digest)
+		if err != nil {
+			return nil, err
+		}
+		return [][]byte{r.Bytes(), s.Bytes()}, nil
+	case packet.PubKeyAlgoEdDSA:
+		signer, ok := priv.PrivateKey.(crypto.Signer)
+		if !ok {
+			return nil, errors.New("gopenpgp: invalid EdDSA private key")
+		}
+		s, err := signer.Sign(rand.Reader, digest, crypto.Hash(0))
+		if err != nil {
+			return nil, err
+		}
+		return [][]byte{s[:32], s[32:]}, nil
+	default:
+		return nil, fmt.Errorf("gopenpgp: unsupported public key algorithm %d", priv.PubKeyAlgo)
+	}
+}
+
+// serializePublicKeyBody returns the public key packet of pub without its
+// packet header.
+func serializePublicKeyBody(pub *packet.PublicKey) ([]byte, error) {
+	var b bytes.Buffer
+	if err := pub.Serialize(&b); err != nil {
+		return nil, err
+	}
+
+	serialized := b.Bytes()
+	if len(serialized) < 2 {
+		return nil, errors.New("gopenpgp: cannot serialize public key")
+	}
+	// Serialize always writes a new format header
+	switch {
+	case serialized[1] < 192:
+		return serialized[2:], nil
+	case serialized[1] < 224:
+		return serialized[3:], nil
+	default:
+		return serialized[6:], nil
+	}
+}
+
+// writePacketHeader writes a new format packet header, RFC 4880 section 4.2.2.
+func writePacketHeader(w io.Writer, tag byte, length int) {
+	w.Write([]byte{0xc0 | tag})
+	writeLength(w, length)
+}
+
+// writeSubpacket writes a signature subpacket, RFC 4880 section 5.2.3.1.
+func writeSubpacket(w io.Writer, subpacketType byte, contents []byte) {
+	writeLength(w, len(contents)+1)
+	w.Write([]byte{subpacketType})
+	w.Write(contents)
+}
+
+// writeLength writes a new format length, shared by packets and subpackets.
+func writeLength(w io.Writer, length int) {
+	switch {
+	case length < 192:
+		w.Write([]byte{byte(length)})
+	case length < 8384:
+		length -= 192
+		w.Write([]byte{byte(length>>8) + 192, byte(length)})
+	default:
+		w.Write([]byte{255, byte(length >> 24), byte(length >> 16), byte(length >> 8), byte(length)})
+	}
+}
+
+// writeMPI writes b as a multiprecision integer, RFC 4880 section 3.2.
+func writeMPI(w io.Writer, b []byte) {
+	n := new(big.Int).SetBytes(b)
+	bitLength := n.BitLen()
+	w.Write([]byte{byte(bitLength >> 8), byte(bitLength)})
+	w.Write(n.Bytes())
+}
@@ -2,75 +2,193 @@ package crypto
 
 import (
 	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"time"
 
 	"github.com/ProtonMail/gopenpgp/armor"
 	"github.com/ProtonMail/gopenpgp/constants"
 
+	"golang.org/x/crypto/cast5"
 	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/ecdh"
+	pgpErrors "golang.org/x/crypto/openpgp/errors"
 	"golang.org/x/crypto/openpgp/packet"
 )
 
+const (
+	symmetricKeyEncryptedTag         = 3
+	symmetricKeyEncryptedAEADVersion = 5
+)
+
+// AEADMode is an AEAD mode of RFC 4880bis. It has the values of packet.AEADMode,
+// which the version of the crypto library used here doesn't define yet.
+type AEADMode uint8
+
+// AEAD modes of RFC 4880bis, section 9.6.
+const (
+	AEADModeEAX AEADMode = 1
+	AEADModeOCB AEADMode = 2
+	AEADModeGCM AEADMode = 3
+)
+
+var errAEADUnsupported = errors.New("gopenpgp: AEAD session key packets are not supported by the crypto library")
+
 // RandomToken generates a random token with the key size of the default cipher.
 func (pgp *GopenPGP) RandomToken() ([]byte, error) {
-	config := &packet.Config{DefaultCipher: packet.CipherAES256}
-	keySize := config.DefaultCipher.KeySize()
-	symKey := make([]byte, keySize)
-	if _, err := io.ReadFull(config.Random(), symKey); err != nil {
-		return nil, err
-	}
-	return symKey, nil
+	return pgp.RandomTokenWith(pgp.getConfig().Cipher().KeySize())
 }
 
-// RandomTokenWith generates a random token with the given key size.
+// RandomTokenWith generates a random token with the given key size, which must
+// be the key size of one of the supported ciphers.
 func (pgp *GopenPGP) RandomTokenWith(size int) ([]byte, error) {
-	config := &packet.Config{DefaultCipher: packet.CipherAES256}
 	symKey := make([]byte, size)
-	if _, err := io.ReadFull(config.Random(), symKey); err != nil {
+	if err := pgp.RandomTokenInto(symKey); err != nil {
 		return nil, err
 	}
 	return symKey, nil
 }
 
+// RandomTokenInto fills dst with a random token without allocating, so that
+// callers can reuse their buffers. The length of dst must be the key size of
+// one of the supported ciphers.
+func (pgp *GopenPGP) RandomTokenInto(dst []byte) error {
+	if !isValidKeySize(len(dst)) {
+		return fmt.Errorf("gopenpgp: invalid session key size %d", len(dst))
+	}
+
+	_, err := io.ReadFull(pgp.getConfig().Random(), dst)
+	return err
+}
+
+func isValidKeySize(size int) bool {
+	for _, cf := range symKeyAlgos {
+		if cf.KeySize() == size {
+			return true
+		}
+	}
+	return false
+}
+
 // GetSessionFromKeyPacket returns the decrypted session key from a binary
 // public-key encrypted session key packet.
 func (pgp *GopenPGP) GetSessionFromKeyPacket(
 	keyPacket []byte, privateKey *KeyRing, passphrase string,
 ) (*SymmetricKey,
 	error) {
-	keyReader := bytes.NewReader(keyPacket)
-	packets := packet.NewReader(keyReader)
+	sessionKey, _, err := pgp.GetSessionFromKeyPacketWithKeyID(keyPacket, privateKey, passphrase)
+	return sessionKey, err
+}
+
+// GetSessionFromKeyPacketStrict is like GetSessionFromKeyPacket, but fails if
+// keyPacket contains anything else than public-key encrypted session key
+// packets. GetSessionFromKeyPacket ignores the data after the packet that
+// decrypts.
+func (pgp *GopenPGP) GetSessionFromKeyPacketStrict(
+	keyPacket []byte, privateKey *KeyRing, passphrase string,
+) (*SymmetricKey, error) {
+	packets := packet.NewOpaqueReader(bytes.NewReader(keyPacket))
+	for {
+		op, err := packets.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("gopenpgp: cannot read key packets: %v", err)
+		}
+		if op.Tag != encryptedKeyTag {
+			return nil, fmt.Errorf("gopenpgp: unexpected packet with tag %d in key packets", op.Tag)
+		}
+	}
+	return pgp.GetSessionFromKeyPacket(keyPacket, privateKey, passphrase)
+}
+
+// GetSessionFromKeyPacketWithKeyID returns the decrypted session key from a
+// binary public-key encrypted session key packet, together with the ID of the
+// private key that decrypted it. If keyPacket contains several packets, each
+// is tried in turn.
+func (pgp *GopenPGP) GetSessionFromKeyPacketWithKeyID(
+	keyPacket []byte, privateKey *KeyRing, passphrase string,
+) (sessionKey *SymmetricKey, keyID uint64, err error) {
+	defer recoverMalformedInput(&err)
+
+	r := bytes.NewReader(keyPacket)
+	sessionKey, keyID, err = getSessionFromKeyPacketReader(r, privateKey, passphrase)
+	for err != nil && r.Len() > 0 {
+		var nextErr error
+		if sessionKey, keyID, nextErr = getSessionFromKeyPacketReader(r, privateKey, passphrase); nextErr == nil {
+			err = nil
+		}
+	}
+	return sessionKey, keyID, err
+}
+
+// GetSessionFromKeyPacketReader reads a binary public-key encrypted session key
+// packet from r and returns the decrypted session key. Only the key packet is
+// consumed, so r can be used to read the following data packets afterwards.
+func (pgp *GopenPGP) GetSessionFromKeyPacketReader(
+	r io.Reader, privateKey *KeyRing, passphrase string,
+) (sessionKey *SymmetricKey, err error) {
+	defer recoverMalformedInput(&err)
+
+	sessionKey, _, err = getSessionFromKeyPacketReader(r, privateKey, passphrase)
+	return sessionKey, err
+}
+
+func getSessionFromKeyPacketReader(
+	r io.Reader, privateKey *KeyRing, passphrase string,
+) (*SymmetricKey, uint64, error) {
+	packets := packet.NewReader(r)
 
 	var p packet.Packet
 	var err error
 	if p, err = packets.Next(); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	ek := p.(*packet.EncryptedKey)
+	ek, ok := p.(*packet.EncryptedKey)
+	if !ok {
+		return nil, 0, errors.New("gopenpgp: not a public-key encrypted session key packet")
+	}
 
 	rawPwd := []byte(passphrase)
-	var decryptErr error
+	var decryptErr error = newCryptoError(constants.ErrorCodeNoDecryptionKey, "gopenpgp: no key decrypts the key packet")
+	var keyID uint64
 	for _, key := range privateKey.entities.DecryptionKeys() {
 		priv := key.PrivateKey
-		if priv.Encrypted {
-			if err := priv.Decrypt(rawPwd); err != nil {
-				continue
-			}
+		// A key ID of 0 hides the recipient, so every key is tried then
+		if ek.KeyId != 0 && ek.KeyId != priv.KeyId {
+			continue
+		}
+		if err := privateKey.unlockKey(priv, rawPwd); err != nil {
+			decryptErr = err
+			continue
 		}
 
-		if decryptErr = ek.Decrypt(priv, nil); decryptErr == nil {
-			break
+		if err := ek.Decrypt(priv, nil); err != nil {
+			decryptErr = err
+			continue
 		}
+		keyID = priv.KeyId
+		decryptErr = nil
+		break
 	}
 
 	if decryptErr != nil {
-		return nil, decryptErr
+		return nil, 0, decryptErr
+	}
+
+	sessionKey, err := getSessionSplit(ek)
+	if err != nil {
+		return nil, 0, err
 	}
 
-	return getSessionSplit(ek)
+	return sessionKey, keyID, nil
 }
 
 // KeyPacketWithPublicKey encrypts the session key with the armored publicKey
@@ -83,70 +201,418 @@ func (pgp *GopenPGP) KeyPacketWithPublicKey(sessionSplit *SymmetricKey, publicKe
 	return pgp.KeyPacketWithPublicKeyBin(sessionSplit, pubkeyRaw)
 }
 
+// ReKeySessionPacket decrypts the session key of the binary public-key
+// encrypted session key packet with privateKey, unlocked with passphrase, and
+// encrypts it again for the armored public key newRecipient. The data packet
+// the session key protects is not needed, so sharing large messages is cheap.
+func (pgp *GopenPGP) ReKeySessionPacket(
+	keyPacket []byte, privateKey *KeyRing, passphrase string, newRecipient string,
+) ([]byte, error) {
+	sessionKey, err := pgp.GetSessionFromKeyPacket(keyPacket, privateKey, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return pgp.KeyPacketWithPublicKey(sessionKey, newRecipient)
+}
+
 // KeyPacketWithPublicKeyBin encrypts the session key with the unarmored
 // publicKey and returns a binary public-key encrypted session key packet.
 func (pgp *GopenPGP) KeyPacketWithPublicKeyBin(sessionSplit *SymmetricKey, publicKey []byte) ([]byte, error) {
-	publicKeyReader := bytes.NewReader(publicKey)
-	pubKeyEntries, err := openpgp.ReadKeyRing(publicKeyReader)
+	return pgp.keyPacketWithPublicKeyBin(sessionSplit, publicKey, false)
+}
+
+// KeyPacketWithPublicKeyBinStrict is like KeyPacketWithPublicKeyBin, but only
+// encrypts to a key whose key flags explicitly allow encryption. Keys without
+// valid key flags, which KeyPacketWithPublicKeyBin accepts for compatibility
+// with legacy keys, are rejected.
+func (pgp *GopenPGP) KeyPacketWithPublicKeyBinStrict(sessionSplit *SymmetricKey, publicKey []byte) ([]byte, error) {
+	return pgp.keyPacketWithPublicKeyBin(sessionSplit, publicKey, true)
+}
+
+func (pgp *GopenPGP) keyPacketWithPublicKeyBin(sessionSplit *SymmetricKey, publicKey []byte, strict bool) ([]byte, error) {
+	pub, err := getEncryptionKey(publicKey, strict)
+	if err != nil {
+		return nil, err
+	}
+
+	outbuf := &bytes.Buffer{}
+
+	cf := sessionSplit.GetCipherFunc()
+
+	if err = serializeEncryptedKey(outbuf, pub, cf, sessionSplit.Key, pgp.getConfig()); err != nil {
+		err = fmt.Errorf("gopenpgp: cannot set key: %v", err)
+		return nil, err
+	}
+	return outbuf.Bytes(), nil
+}
+
+// KeyPacketWithPublicKeyAt is like KeyPacketWithPublicKey, but only encrypts to
+// a key that is neither expired nor revoked at verifyTime, given as a Unix
+// timestamp. An error is returned if no such encryption key is available.
+func (pgp *GopenPGP) KeyPacketWithPublicKeyAt(
+	sessionSplit *SymmetricKey, publicKey string, verifyTime int64,
+) ([]byte, error) {
+	pubkeyRaw, err := armor.Unarmor(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	pub, err := getEncryptionKeyAt(pubkeyRaw, time.Unix(verifyTime, 0))
+	if err != nil {
+		return nil, err
+	}
+
+	outbuf := &bytes.Buffer{}
+	if err = serializeEncryptedKey(outbuf, pub, sessionSplit.GetCipherFunc(), sessionSplit.Key, pgp.getConfig()); err != nil {
+		return nil, fmt.Errorf("gopenpgp: cannot set key: %v", err)
+	}
+	return outbuf.Bytes(), nil
+}
+
+// KeyPacketWithPublicKeyBinAnonymous encrypts the session key with the
+// unarmored publicKey and returns a binary public-key encrypted session key
+// packet that carries a zero (wildcard) key ID instead of the recipient's.
+func (pgp *GopenPGP) KeyPacketWithPublicKeyBinAnonymous(
+	sessionSplit *SymmetricKey, publicKey []byte,
+) ([]byte, error) {
+	keyPacket, err := pgp.KeyPacketWithPublicKeyBin(sessionSplit, publicKey)
 	if err != nil {
 		return nil, err
 	}
+	return anonymizeKeyPacket(keyPacket)
+}
+
+// KeyPacketWithPublicKeys encrypts the session key with each of the armored
+// publicKeys and returns the binary public-key encrypted session key packets,
+// one per recipient in the order given.
+func (pgp *GopenPGP) KeyPacketWithPublicKeys(sessionSplit *SymmetricKey, publicKeys []string) ([]byte, error) {
+	return pgp.keyPacketWithPublicKeys(sessionSplit, publicKeys, false)
+}
+
+// KeyPacketWithPublicKeysAnonymous is like KeyPacketWithPublicKeys, but every
+// packet carries a zero (wildcard) key ID instead of the recipient's, so that
+// recipients are hidden and must try each of their keys to decrypt.
+func (pgp *GopenPGP) KeyPacketWithPublicKeysAnonymous(
+	sessionSplit *SymmetricKey, publicKeys []string,
+) ([]byte, error) {
+	return pgp.keyPacketWithPublicKeys(sessionSplit, publicKeys, true)
+}
+
+func (pgp *GopenPGP) keyPacketWithPublicKeys(sessionSplit *SymmetricKey, publicKeys []string, anonymous bool) ([]byte, error) {
+	if len(publicKeys) == 0 {
+		return nil, errors.New("gopenpgp: cannot set key: no public keys given")
+	}
 
 	outbuf := &bytes.Buffer{}
 
 	cf := sessionSplit.GetCipherFunc()
 
+	for i, publicKey := range publicKeys {
+		pubkeyRaw, err := armor.Unarmor(publicKey)
+		if err != nil {
+			return nil, fmt.Errorf("gopenpgp: cannot read public key %d: %v", i, err)
+		}
+
+		pub, err := getEncryptionKey(pubkeyRaw, false)
+		if err != nil {
+			return nil, fmt.Errorf("gopenpgp: public key %d: %v", i, err)
+		}
+
+		keyPacket := &bytes.Buffer{}
+		if err = serializeEncryptedKey(keyPacket, pub, cf, sessionSplit.Key, pgp.getConfig()); err != nil {
+			return nil, fmt.Errorf("gopenpgp: cannot set key %d: %v", i, err)
+		}
+
+		if !anonymous {
+			keyPacket.WriteTo(outbuf)
+			continue
+		}
+		anonymousPacket, err := anonymizeKeyPacket(keyPacket.Bytes())
+		if err != nil {
+			return nil, fmt.Errorf("gopenpgp: cannot set key %d: %v", i, err)
+		}
+		outbuf.Write(anonymousPacket)
+	}
+	return outbuf.Bytes(), nil
+}
+
+// anonymizeKeyPacket replaces the key ID in a binary public-key encrypted
+// session key packet with the wildcard key ID.
+func anonymizeKeyPacket(keyPacket []byte) ([]byte, error) {
+	p, err := packet.Read(bytes.NewReader(keyPacket))
+	if err != nil {
+		return nil, err
+	}
+
+	ek, ok := p.(*packet.EncryptedKey)
+	if !ok {
+		return nil, errors.New("gopenpgp: not a public-key encrypted session key packet")
+	}
+	ek.KeyId = 0
+
+	outbuf := &bytes.Buffer{}
+	if err = ek.Serialize(outbuf); err != nil {
+		return nil, fmt.Errorf("gopenpgp: cannot serialize encrypted key: %v", err)
+	}
+	return outbuf.Bytes(), nil
+}
+
+// ECDH KDF parameters allowed by RFC 6637, section 8.
+var (
+	ecdhKDFHashes  = map[uint8]bool{8: true, 9: true, 10: true} // SHA-256, SHA-384, SHA-512
+	ecdhKDFCiphers = map[uint8]bool{7: true, 8: true, 9: true}  // AES-128, AES-192, AES-256
+)
+
+// serializeEncryptedKey is like packet.SerializeEncryptedKey, but first checks
+// the KDF parameters of ECDH keys: the crypto library panics on some invalid
+// combinations, e.g. a hash shorter than the key wrapping key.
+func serializeEncryptedKey(
+	w io.Writer, pub *packet.PublicKey, cipherFunc packet.CipherFunction, key []byte, config *packet.Config,
+) error {
+	if ecdhPub, ok := pub.PublicKey.(*ecdh.PublicKey); ok {
+		if hash := ecdhPub.KDF.Hash.Id(); !ecdhKDFHashes[hash] {
+			return fmt.Errorf("gopenpgp: invalid ECDH KDF hash %d in key %x", hash, pub.KeyId)
+		}
+		if cipher := ecdhPub.KDF.Cipher.Id(); !ecdhKDFCiphers[cipher] {
+			return fmt.Errorf("gopenpgp: invalid ECDH KDF cipher %d in key %x", cipher, pub.KeyId)
+		}
+	}
+	return packet.SerializeEncryptedKey(w, pub, cipherFunc, key, config)
+}
+
+// errPrivateKeyGiven is returned when a private key is given where a public key
+// is expected, so that secret key material isn't used or passed on by mistake.
+var errPrivateKeyGiven = errors.New("gopenpgp: expected public key, got private key")
+
+// readPublicKeyRing reads the unarmored publicKey, returning errPrivateKeyGiven
+// if it contains secret key packets.
+func readPublicKeyRing(publicKey []byte) (openpgp.EntityList, error) {
+	entities, err := openpgp.ReadKeyRing(bytes.NewReader(publicKey))
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entities {
+		if e.PrivateKey != nil {
+			return nil, errPrivateKeyGiven
+		}
+		for _, subKey := range e.Subkeys {
+			if subKey.PrivateKey != nil {
+				return nil, errPrivateKeyGiven
+			}
+		}
+	}
+	return entities, nil
+}
+
+// getEncryptionKey reads the unarmored publicKey and returns the first public
+// key that may be used for encryption. If strict is true, the key flags must
+// explicitly allow encryption.
+func getEncryptionKey(publicKey []byte, strict bool) (*packet.PublicKey, error) {
+	pubKeyEntries, err := readPublicKeyRing(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
 	if len(pubKeyEntries) == 0 {
 		return nil, errors.New("cannot set key: key ring is empty")
 	}
 
 	var pub *packet.PublicKey
 	for _, e := range pubKeyEntries {
-		for _, subKey := range e.Subkeys {
-			if !subKey.Sig.FlagsValid || subKey.Sig.FlagEncryptStorage || subKey.Sig.FlagEncryptCommunications {
-				pub = subKey.PublicKey
-				break
-			}
-		}
-		if pub == nil && len(e.Identities) > 0 {
-			var i *openpgp.Identity
-			for _, i = range e.Identities {
-				break
-			}
-			if i.SelfSignature.FlagsValid || i.SelfSignature.FlagEncryptStorage || i.SelfSignature.FlagEncryptCommunications {
-				pub = e.PrimaryKey
-			}
+		if strict {
+			pub = getEntityEncryptionKeyStrict(e)
+		} else {
+			pub = getEntityEncryptionKey(e)
 		}
 		if pub != nil {
 			break
 		}
 	}
+	if pub == nil && strict {
+		return nil, errors.New("gopenpgp: cannot set key: no key with valid encryption key flags available")
+	}
 	if pub == nil {
 		return nil, errors.New("cannot set key: no public key available")
 	}
 
-	if err = packet.SerializeEncryptedKey(outbuf, pub, cf, sessionSplit.Key, nil); err != nil {
-		err = fmt.Errorf("gopenpgp: cannot set key: %v", err)
+	return pub, nil
+}
+
+// getEncryptionKeyAt reads the unarmored publicKey and returns the first public
+// key that may be used for encryption and is neither expired nor revoked at
+// now.
+func getEncryptionKeyAt(publicKey []byte, now time.Time) (*packet.PublicKey, error) {
+	pubKeyEntries, err := readPublicKeyRing(publicKey)
+	if err != nil {
 		return nil, err
 	}
-	return outbuf.Bytes(), nil
+	return getEntitiesEncryptionKeyAt(pubKeyEntries, now)
+}
+
+// getEntitiesEncryptionKeyAt returns the first public key of pubKeyEntries
+// that may be used for encryption and is neither expired nor revoked at now.
+func getEntitiesEncryptionKeyAt(pubKeyEntries openpgp.EntityList, now time.Time) (*packet.PublicKey, error) {
+	if len(pubKeyEntries) == 0 {
+		return nil, errors.New("cannot set key: key ring is empty")
+	}
+
+	var invalidErr error
+	for _, e := range pubKeyEntries {
+		if isEntityRevoked(e) {
+			invalidErr = newCryptoError(constants.ErrorCodeKeyRevoked,
+				fmt.Sprintf("gopenpgp: cannot set key: key %x is revoked", e.PrimaryKey.KeyId))
+			continue
+		}
+		i := getPrimaryIdentity(e)
+		if i != nil && (e.PrimaryKey.KeyExpired(i.SelfSignature, now) || i.SelfSignature.SigExpired(now)) {
+			invalidErr = newCryptoError(constants.ErrorCodeKeyExpired,
+				fmt.Sprintf("gopenpgp: cannot set key: key %x is expired", e.PrimaryKey.KeyId))
+			continue
+		}
+
+		for _, subKey := range e.Subkeys {
+			if subKey.Sig.FlagsValid && !subKey.Sig.FlagEncryptStorage && !subKey.Sig.FlagEncryptCommunications {
+				continue
+			}
+			if subKey.Sig.SigType == packet.SigTypeSubkeyRevocation {
+				invalidErr = newCryptoError(constants.ErrorCodeKeyRevoked,
+					fmt.Sprintf("gopenpgp: cannot set key: subkey %x is revoked", subKey.PublicKey.KeyId))
+				continue
+			}
+			if subKey.PublicKey.KeyExpired(subKey.Sig, now) || subKey.Sig.SigExpired(now) {
+				invalidErr = newCryptoError(constants.ErrorCodeKeyExpired,
+					fmt.Sprintf("gopenpgp: cannot set key: subkey %x is expired", subKey.PublicKey.KeyId))
+				continue
+			}
+			return subKey.PublicKey, nil
+		}
+
+		if i != nil && (!i.SelfSignature.FlagsValid || i.SelfSignature.FlagEncryptStorage ||
+			i.SelfSignature.FlagEncryptCommunications) && e.PrimaryKey.PubKeyAlgo.CanEncrypt() {
+			return e.PrimaryKey, nil
+		}
+	}
+
+	if invalidErr != nil {
+		return nil, invalidErr
+	}
+	return nil, errors.New("cannot set key: no public key available")
+}
+
+// getRecipientEncryptionKey returns the public key of the recipient e that
+// may be used for encryption and is neither expired nor revoked at now, as
+// openpgp.Encrypt requires.
+func getRecipientEncryptionKey(e *openpgp.Entity, now time.Time) (*packet.PublicKey, error) {
+	pub, err := getEntitiesEncryptionKeyAt(openpgp.EntityList{e}, now)
+	if err != nil {
+		return nil, wrapCryptoError(err, fmt.Sprintf("gopenpgp: cannot encrypt message to key id %x", e.PrimaryKey.KeyId))
+	}
+	return pub, nil
+}
+
+// getEntityEncryptionKey returns the first public key of e that may be used
+// for encryption, or nil if there is none.
+func getEntityEncryptionKey(e *openpgp.Entity) *packet.PublicKey {
+	for _, subKey := range e.Subkeys {
+		if !subKey.Sig.FlagsValid || subKey.Sig.FlagEncryptStorage || subKey.Sig.FlagEncryptCommunications {
+			return subKey.PublicKey
+		}
+	}
+	if len(e.Identities) > 0 {
+		var i *openpgp.Identity
+		for _, i = range e.Identities {
+			break
+		}
+		if i.SelfSignature.FlagsValid || i.SelfSignature.FlagEncryptStorage || i.SelfSignature.FlagEncryptCommunications {
+			return e.PrimaryKey
+		}
+	}
+	return nil
+}
+
+// getEntityEncryptionKeyStrict returns the first public key of e whose key
+// flags explicitly allow encryption, or nil if there is none.
+func getEntityEncryptionKeyStrict(e *openpgp.Entity) *packet.PublicKey {
+	for _, subKey := range e.Subkeys {
+		if subKey.Sig.FlagsValid && (subKey.Sig.FlagEncryptStorage || subKey.Sig.FlagEncryptCommunications) &&
+			subKey.PublicKey.PubKeyAlgo.CanEncrypt() {
+			return subKey.PublicKey
+		}
+	}
+	if i := getPrimaryIdentity(e); i != nil && i.SelfSignature.FlagsValid &&
+		(i.SelfSignature.FlagEncryptStorage || i.SelfSignature.FlagEncryptCommunications) &&
+		e.PrimaryKey.PubKeyAlgo.CanEncrypt() {
+		return e.PrimaryKey
+	}
+	return nil
 }
 
 // GetSessionFromSymmetricPacket decrypts the binary symmetrically encrypted
-// session key packet and returns the session key.
-func (pgp *GopenPGP) GetSessionFromSymmetricPacket(keyPacket []byte, password string) (*SymmetricKey, error) {
+// session key packet and returns the session key. If no packet decrypts with
+// password, a CryptoError with code constants.ErrorCodeWrongPassphrase is
+// returned, unless a packet uses a cipher the crypto library doesn't support,
+// in which case the password may well be right and an error naming the cipher
+// is returned instead.
+//
+// A wrong password can decrypt a packet to a garbage key by chance. If
+// keyPacket is followed by the data packet, the session key is checked against
+// it. Otherwise, an error is returned when the password decrypts several
+// packets to different keys, as it cannot tell which one is right.
+func (pgp *GopenPGP) GetSessionFromSymmetricPacket(
+	keyPacket []byte, password string,
+) (sessionKey *SymmetricKey, err error) {
+	defer recoverMalformedInput(&err)
+
+	return getSessionFromSymmetricPacket(keyPacket, nil, password)
+}
+
+// getSessionFromSymmetricPacket decrypts the session key of keyPacket with
+// password. If dataPacket is nil, the data packet following the key packets in
+// keyPacket, if any, is used. The session keys that a packet decrypts to are
+// checked against dataPacket, see checkSessionKey.
+func getSessionFromSymmetricPacket(keyPacket, dataPacket []byte, password string) (*SymmetricKey, error) {
 	keyReader := bytes.NewReader(keyPacket)
-	packets := packet.NewReader(keyReader)
+	packets := packet.NewOpaqueReader(keyReader)
 
 	var symKeys []*packet.SymmetricKeyEncrypted
+	hasAEADKeys := false
+	var unsupportedCipher packet.CipherFunction
 	for {
 
-		var p packet.Packet
+		var op *packet.OpaquePacket
 		var err error
-		if p, err = packets.Next(); err != nil {
+		if op, err = packets.Next(); err != nil {
 			break
 		}
 
+		if dataPacket == nil && (op.Tag == symmetricallyEncryptedTag || op.Tag == symmetricallyEncryptedMDCTag) {
+			var b bytes.Buffer
+			if err = op.Serialize(&b); err == nil {
+				dataPacket = b.Bytes()
+			}
+			break
+		}
+
+		if op.Tag != symmetricKeyEncryptedTag {
+			continue
+		}
+
+		// v5 packets are AEAD protected, which the crypto library can't parse
+		if len(op.Contents) > 0 && op.Contents[0] == symmetricKeyEncryptedAEADVersion {
+			hasAEADKeys = true
+			continue
+		}
+
+		if len(op.Contents) > 1 && packet.CipherFunction(op.Contents[1]).KeySize() == 0 {
+			unsupportedCipher = packet.CipherFunction(op.Contents[1])
+			continue
+		}
+
+		var p packet.Packet
+		if p, err = op.Parse(); err != nil {
+			continue
+		}
+
 		switch p := p.(type) {
 		case *packet.SymmetricKeyEncrypted:
 			symKeys = append(symKeys, p)
@@ -154,57 +620,415 @@ func (pgp *GopenPGP) GetSessionFromSymmetricPacket(keyPacket []byte, password st
 	}
 
 	pwdRaw := []byte(password)
-	// Try the symmetric passphrase first
-	if len(symKeys) != 0 && pwdRaw != nil {
-		for _, s := range symKeys {
-			key, cipherFunc, err := s.Decrypt(pwdRaw)
-			if err == nil {
-				return &SymmetricKey{
-					Key:  key,
-					Algo: getAlgo(cipherFunc),
-				}, nil
-			}
+	var sessionKey *SymmetricKey
+	for _, s := range symKeys {
+		key, cipherFunc, err := s.Decrypt(pwdRaw)
+		if err != nil {
+			continue
+		}
+		algo, err := getAlgo(cipherFunc)
+		if err != nil {
+			return nil, err
+		}
 
+		if dataPacket != nil {
+			if checkSessionKey(dataPacket, cipherFunc, key) {
+				return &SymmetricKey{Key: key, Algo: algo}, nil
+			}
+			continue
 		}
+		if sessionKey != nil && (sessionKey.Algo != algo || !bytes.Equal(sessionKey.Key, key)) {
+			return nil, errors.New(
+				"gopenpgp: password decrypts several session key packets to different keys, the data packet is needed",
+			)
+		}
+		sessionKey = &SymmetricKey{Key: key, Algo: algo}
+	}
+	if sessionKey != nil {
+		return sessionKey, nil
+	}
+
+	if hasAEADKeys {
+		return nil, errAEADUnsupported
+	}
+	if unsupportedCipher != 0 {
+		return nil, fmt.Errorf("gopenpgp: session key packet uses unsupported cipher %d", unsupportedCipher)
 	}
 
-	return nil, errors.New("password incorrect")
+	return nil, newCryptoError(constants.ErrorCodeWrongPassphrase, "password incorrect")
+}
+
+// checkSessionKey returns whether key decrypts the binary symmetrically
+// encrypted dataPacket, using the quick check of the encrypted prefix (RFC 4880
+// section 5.7), so only the beginning of the packet is read. A wrong key passes
+// the check once in 65536 tries.
+func checkSessionKey(dataPacket []byte, cipherFunc packet.CipherFunction, key []byte) bool {
+	p, err := packet.Read(bytes.NewReader(dataPacket))
+	if err != nil {
+		return false
+	}
+	se, ok := p.(*packet.SymmetricallyEncrypted)
+	if !ok {
+		return false
+	}
+	_, err = se.Decrypt(cipherFunc, key)
+	return err == nil
 }
 
 // SymmetricKeyPacketWithPassword encrypts the session key with the password and
 // returns a binary symmetrically encrypted session key packet.
 func (pgp *GopenPGP) SymmetricKeyPacketWithPassword(sessionSplit *SymmetricKey, password string) ([]byte, error) {
+	return pgp.SymmetricKeyPacketWithPasswords(sessionSplit, []string{password})
+}
+
+// ReKeySymmetricPacket decrypts the session key of the binary symmetrically
+// encrypted session key packet with oldPassword, and encrypts it again with
+// newPassword into a single new packet. The session key is checked against the
+// binary data packet it protects before being re-wrapped, as a wrong password
+// can decrypt a key packet to a garbage key; only the beginning of dataPacket
+// is read, so stored messages are cheap to re-wrap when a password changes.
+func (pgp *GopenPGP) ReKeySymmetricPacket(
+	keyPacket, dataPacket []byte, oldPassword, newPassword []byte,
+) (newKeyPacket []byte, err error) {
+	defer recoverMalformedInput(&err)
+
+	if len(dataPacket) == 0 {
+		return nil, errors.New("gopenpgp: no data packet given")
+	}
+
+	sessionKey, err := getSessionFromSymmetricPacket(keyPacket, dataPacket, string(oldPassword))
+	if err != nil {
+		return nil, err
+	}
+	return pgp.SymmetricKeyPacketWithPassword(sessionKey, string(newPassword))
+}
+
+// SymmetricKeyPacketWithPasswords encrypts the session key with each of the
+// passwords and returns the concatenated binary symmetrically encrypted session
+// key packets, one per password. Any of the passwords decrypts a message made
+// of these packets and a data packet encrypted with the session key.
+// GetSessionFromSymmetricPacket also tries every packet, see its documentation
+// for when the data packet must follow them.
+func (pgp *GopenPGP) SymmetricKeyPacketWithPasswords(sessionSplit *SymmetricKey, passwords []string) ([]byte, error) {
+	return pgp.symmetricKeyPacketWithPasswords(sessionSplit, passwords, nil)
+}
+
+// Valid iteration counts of the iterated and salted S2K, RFC 4880 section
+// 3.7.1.3.
+const (
+	minS2KCount = 1024
+	maxS2KCount = 65011712
+)
+
+// S2KOptions controls how a password is turned into a key, with the iterated
+// and salted S2K of RFC 4880 section 3.7.1.3.
+type S2KOptions struct {
+	// Count is the number of bytes hashed, between 1024 and 65011712. It is
+	// rounded up to the next value the packet format can represent. If 0, the
+	// crypto library default is used.
+	Count int
+	// Hash is the name of the hash algorithm, e.g. constants.SHA256. If empty,
+	// the crypto library default is used.
+	Hash string
+}
+
+// SymmetricKeyPacketWithPasswordOptions is like SymmetricKeyPacketWithPassword,
+// but derives the key encrypting the session key from the password as set by
+// opts, for instance to raise the S2K count of high-value passwords.
+func (pgp *GopenPGP) SymmetricKeyPacketWithPasswordOptions(
+	sessionSplit *SymmetricKey, password string, opts *S2KOptions,
+) ([]byte, error) {
+	return pgp.symmetricKeyPacketWithPasswords(sessionSplit, []string{password}, opts)
+}
+
+func (pgp *GopenPGP) symmetricKeyPacketWithPasswords(
+	sessionSplit *SymmetricKey, passwords []string, opts *S2KOptions,
+) ([]byte, error) {
 	outbuf := &bytes.Buffer{}
+	if err := pgp.writeSymmetricKeyPackets(outbuf, sessionSplit, passwords, opts); err != nil {
+		return nil, err
+	}
+	return outbuf.Bytes(), nil
+}
+
+// SymmetricKeyPacketWithPasswordWriter is like SymmetricKeyPacketWithPassword,
+// but writes the packet to w instead of returning it, e.g. to build a message
+// directly into a network connection. Nothing is written if password is empty.
+func (pgp *GopenPGP) SymmetricKeyPacketWithPasswordWriter(
+	w io.Writer, sessionSplit *SymmetricKey, password string,
+) error {
+	return pgp.writeSymmetricKeyPackets(w, sessionSplit, []string{password}, nil)
+}
 
+// writeSymmetricKeyPackets writes a symmetrically encrypted session key packet
+// per password to w. Every argument is checked before anything is written.
+func (pgp *GopenPGP) writeSymmetricKeyPackets(
+	w io.Writer, sessionSplit *SymmetricKey, passwords []string, opts *S2KOptions,
+) error {
 	cf := sessionSplit.GetCipherFunc()
 
+	if len(passwords) == 0 {
+		return errors.New("gopenpgp: no password given")
+	}
+	for _, password := range passwords {
+		if len(password) <= 0 {
+			return errors.New("password can't be empty")
+		}
+	}
+
+	config := *pgp.getConfig()
+	config.DefaultCipher = cf
+	if opts != nil {
+		if opts.Count != 0 && (opts.Count < minS2KCount || opts.Count > maxS2KCount) {
+			return fmt.Errorf("gopenpgp: invalid S2K count %d", opts.Count)
+		}
+		config.S2KCount = opts.Count
+		if opts.Hash != "" {
+			hash, ok := signatureHashes[opts.Hash]
+			if !ok {
+				return errors.New("gopenpgp: unsupported S2K hash " + opts.Hash)
+			}
+			config.DefaultHash = hash
+		}
+	}
+
+	for _, password := range passwords {
+		pwdRaw := []byte(password)
+
+		err := packet.SerializeSymmetricKeyEncryptedReuseKey(w, sessionSplit.Key, pwdRaw, &config)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BuildSessionPackets encrypts the session key to each of the armored
+// publicKeys and with each of the passwords, and returns all the session key
+// packets concatenated, public-key encrypted ones first. Joined with a data
+// packet encrypted with sessionSplit, the message can be decrypted either by
+// any of the matching private keys, e.g. with DecryptMessage, or with any of
+// the passwords, e.g. with DecryptMessageWithPassword.
+func (pgp *GopenPGP) BuildSessionPackets(
+	sessionSplit *SymmetricKey, publicKeys []string, passwords [][]byte,
+) ([]byte, error) {
+	if len(publicKeys) == 0 && len(passwords) == 0 {
+		return nil, errors.New("gopenpgp: no public key or password given")
+	}
+
+	outbuf := &bytes.Buffer{}
+	for _, publicKey := range publicKeys {
+		keyPacket, err := pgp.KeyPacketWithPublicKey(sessionSplit, publicKey)
+		if err != nil {
+			return nil, err
+		}
+		outbuf.Write(keyPacket)
+	}
+
+	if len(passwords) > 0 {
+		stringPasswords := make([]string, len(passwords))
+		for i, password := range passwords {
+			stringPasswords[i] = string(password)
+		}
+		if err := pgp.writeSymmetricKeyPackets(outbuf, sessionSplit, stringPasswords, nil); err != nil {
+			return nil, err
+		}
+	}
+	return outbuf.Bytes(), nil
+}
+
+// SymmetricKeyPacketWithPasswordAEAD is meant to encrypt the session key with
+// the password using the given AEAD mode and return a binary v5 symmetrically
+// encrypted session key packet. The crypto library used here only implements v4
+// (CFB) session key packets, so it always fails: with an error for an unknown
+// mode, else with an error saying that AEAD is not supported.
+func (pgp *GopenPGP) SymmetricKeyPacketWithPasswordAEAD(
+	sessionSplit *SymmetricKey, password string, mode AEADMode,
+) ([]byte, error) {
 	if len(password) <= 0 {
 		return nil, errors.New("password can't be empty")
 	}
 
-	pwdRaw := []byte(password)
+	if mode < AEADModeEAX || mode > AEADModeGCM {
+		return nil, fmt.Errorf("gopenpgp: unsupported AEAD mode: %d", mode)
+	}
 
-	config := &packet.Config{
-		DefaultCipher: cf,
+	return nil, errAEADUnsupported
+}
+
+// EncryptWithSessionKey encrypts plainData with the session key sk and returns
+// a binary symmetrically encrypted data packet, without any session key packet.
+// The data packet can be decrypted with DecryptWithSessionKey, or joined with a
+// key packet of sk.
+func (pgp *GopenPGP) EncryptWithSessionKey(plainData []byte, sk *SymmetricKey) ([]byte, error) {
+	if !isValidKeySize(len(sk.Key)) {
+		return nil, errors.New("gopenpgp: invalid session key size")
+	}
+
+	var outBuf bytes.Buffer
+	if err := pgp.writeDataPacket(&outBuf, bytes.NewReader(plainData), sk); err != nil {
+		return nil, err
 	}
+	return outBuf.Bytes(), nil
+}
+
+// writeDataPacket writes a symmetrically encrypted data packet of the data
+// read from plainReader, encrypted with the session key sk, to w.
+func (pgp *GopenPGP) writeDataPacket(w io.Writer, plainReader io.Reader, sk *SymmetricKey) error {
+	config := *pgp.getConfig()
+	config.Time = pgp.getTimeGenerator()
 
-	err := packet.SerializeSymmetricKeyEncryptedReuseKey(outbuf, sessionSplit.Key, pwdRaw, config)
+	encryptWriter, err := packet.SerializeSymmetricallyEncrypted(w, sk.GetCipherFunc(), sk.Key, &config)
 	if err != nil {
+		return err
+	}
+	literalWriter, err := packet.SerializeLiteral(encryptWriter, true, "", uint32(pgp.GetTimeUnix()))
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(literalWriter, plainReader); err != nil {
+		return err
+	}
+	// Closing the literal data packet also closes the encrypted data packet
+	return literalWriter.Close()
+}
+
+// DecryptWithSessionKey decrypts the binary symmetrically encrypted data packet
+// with the session key sk, for instance one stored separately from its key
+// packet. Signatures inside the data packet are not verified.
+func (pgp *GopenPGP) DecryptWithSessionKey(dataPacket []byte, sk *SymmetricKey) (plainData []byte, err error) {
+	defer recoverMalformedInput(&err)
+
+	return pgp.decryptDataPacket(dataPacket, sk, nil, true)
+}
+
+// decryptDataPacket decrypts dataPacket with sk, see DecryptWithSessionKey. If
+// limits is nil, the size set with SetMaxDecompressedSize applies.
+func (pgp *GopenPGP) decryptDataPacket(
+	dataPacket []byte, sk *SymmetricKey, limits *DecryptLimits, requireIntegrity bool,
+) (plainData []byte, err error) {
+	maxSize, maxDepth := pgp.maxDecompressedSize, 0
+	if limits != nil {
+		maxSize, maxDepth = limits.MaxSize, limits.MaxCompressionDepth
+	}
+
+	if isAEADEncrypted(bytes.NewReader(dataPacket)) {
+		return nil, errAEADDataUnsupported
+	}
+	var decrypted io.ReadCloser
+	if isUnprotected(bytes.NewReader(dataPacket)) {
+		if requireIntegrity {
+			return nil, ErrMessageNotProtected
+		}
+		if decrypted, err = decryptUnprotected(dataPacket, sk); err != nil {
+			return nil, err
+		}
+	} else {
+		p, err := packet.Read(bytes.NewReader(dataPacket))
+		if err != nil {
+			return nil, fmt.Errorf("gopenpgp: cannot read data packet: %v", err)
+		}
+		se, ok := p.(*packet.SymmetricallyEncrypted)
+		if !ok {
+			return nil, errors.New("gopenpgp: not a symmetrically encrypted data packet")
+		}
+
+		decrypted, err = se.Decrypt(sk.GetCipherFunc(), sk.Key)
+		if err == pgpErrors.ErrKeyIncorrect {
+			return nil, errIncorrectSessionKey
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	packets := packet.NewReader(decrypted)
+	depth := 0
+	for {
+		p, err := packets.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch p := p.(type) {
+		case *packet.Compressed:
+			// A valid message has a single compressed packet, so counting them
+			// all bounds the nesting depth
+			if depth++; maxDepth > 0 && depth > maxDepth {
+				return nil, ErrCompressionTooDeep
+			}
+			if err = packets.Push(p.Body); err != nil {
+				return nil, err
+			}
+		case *packet.LiteralData:
+			if plainData, err = ioutil.ReadAll(limitSize(p.Body, maxSize)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Closing checks the integrity protection
+	if err = decrypted.Close(); err != nil {
 		return nil, err
 	}
-	return outbuf.Bytes(), nil
+	if plainData == nil {
+		return nil, errors.New("gopenpgp: data packet doesn't contain literal data")
+	}
+	return plainData, nil
+}
+
+// errIncorrectSessionKey is returned when the session key doesn't decrypt the
+// data packet.
+var errIncorrectSessionKey = newCryptoError(
+	constants.ErrorCodeNoDecryptionKey, "gopenpgp: cannot decrypt data packet, incorrect session key",
+)
+
+// decryptUnprotected decrypts the legacy symmetrically encrypted data packet
+// dataPacket, which has no integrity protection, with sk. It uses the OpenPGP
+// CFB mode of RFC 4880, section 13.9, directly, so that decrypting old archives
+// doesn't depend on the crypto library still accepting such packets.
+func decryptUnprotected(dataPacket []byte, sk *SymmetricKey) (io.ReadCloser, error) {
+	op, err := packet.NewOpaqueReader(bytes.NewReader(dataPacket)).Next()
+	if err != nil {
+		return nil, fmt.Errorf("gopenpgp: cannot read data packet: %v", err)
+	}
+
+	var block cipher.Block
+	switch sk.GetCipherFunc() {
+	case packet.Cipher3DES:
+		block, err = des.NewTripleDESCipher(sk.Key)
+	case packet.CipherCAST5:
+		block, err = cast5.NewCipher(sk.Key)
+	default:
+		block, err = aes.NewCipher(sk.Key)
+	}
+	if err != nil {
+		return nil, errIncorrectSessionKey
+	}
+
+	prefixSize := block.BlockSize() + 2
+	if len(op.Contents) < prefixSize {
+		return nil, errors.New("gopenpgp: data packet is too short")
+	}
+	stream := packet.NewOCFBDecrypter(block, op.Contents[:prefixSize], packet.OCFBResync)
+	if stream == nil {
+		return nil, errIncorrectSessionKey
+	}
+	decrypted := make([]byte, len(op.Contents)-prefixSize)
+	stream.XORKeyStream(decrypted, op.Contents[prefixSize:])
+	return ioutil.NopCloser(bytes.NewReader(decrypted)), nil
 }
 
 func getSessionSplit(ek *packet.EncryptedKey) (*SymmetricKey, error) {
 	if ek == nil {
 		return nil, errors.New("can't decrypt key packet")
 	}
-	algo := constants.AES256
-	for k, v := range symKeyAlgos {
-		if v == ek.CipherFunc {
-			algo = k
-			break
-		}
+	algo, err := getAlgo(ek.CipherFunc)
+	if err != nil {
+		return nil, err
 	}
 
 	if ek.Key == nil {
@@ -217,14 +1041,12 @@ func getSessionSplit(ek *packet.EncryptedKey) (*SymmetricKey, error) {
 	}, nil
 }
 
-func getAlgo(cipher packet.CipherFunction) string {
-	algo := constants.AES256
+func getAlgo(cipher packet.CipherFunction) (string, error) {
 	for k, v := range symKeyAlgos {
 		if v == cipher {
-			algo = k
-			break
+			return k, nil
 		}
 	}
 
-	return algo
+	return "", fmt.Errorf("gopenpgp: unsupported cipher function: %v", cipher)
 }
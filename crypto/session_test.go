@@ -1,11 +1,21 @@
 package crypto
 
 import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/ProtonMail/gopenpgp/armor"
 	"github.com/ProtonMail/gopenpgp/constants"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
 )
 
 var testRandomToken []byte
@@ -20,12 +30,76 @@ func TestRandomToken(t *testing.T) {
 }
 
 func TestRandomTokenWith(t *testing.T) {
-	token, err := pgp.RandomTokenWith(40)
+	token, err := pgp.RandomTokenWith(24)
 	if err != nil {
 		t.Fatal("Expected no error while generating random token, got:", err)
 	}
 
-	assert.Len(t, token, 40)
+	assert.Len(t, token, 24)
+
+	_, err = pgp.RandomTokenWith(7)
+	assert.EqualError(t, err, "gopenpgp: invalid session key size 7")
+}
+
+func TestRandomTokenInto(t *testing.T) {
+	token := make([]byte, 16)
+	if err := pgp.RandomTokenInto(token); err != nil {
+		t.Fatal("Expected no error while generating random token, got:", err)
+	}
+	assert.NotEqual(t, make([]byte, 16), token)
+
+	previous := append([]byte(nil), token...)
+	if err := pgp.RandomTokenInto(token); err != nil {
+		t.Fatal("Expected no error while generating random token, got:", err)
+	}
+	assert.NotEqual(t, previous, token)
+
+	assert.EqualError(t, pgp.RandomTokenInto(make([]byte, 7)), "gopenpgp: invalid session key size 7")
+	assert.EqualError(t, pgp.RandomTokenInto(nil), "gopenpgp: invalid session key size 0")
+}
+
+func TestSetConfig(t *testing.T) {
+	var custom = GopenPGP{}
+	random := bytes.Repeat([]byte{0x42}, 64)
+
+	custom.SetConfig(&packet.Config{DefaultCipher: packet.CipherAES128, Rand: bytes.NewReader(random)})
+	token, err := custom.RandomToken()
+	if err != nil {
+		t.Fatal("Expected no error while generating random token, got:", err)
+	}
+	assert.Exactly(t, random[:16], token)
+
+	symmetricKey := &SymmetricKey{Key: testRandomToken, Algo: constants.AES256}
+	var keyPackets [2][]byte
+	for i := range keyPackets {
+		custom.SetConfig(&packet.Config{Rand: bytes.NewReader(random)})
+		keyPackets[i], err = custom.SymmetricKeyPacketWithPassword(symmetricKey, "password")
+		if err != nil {
+			t.Fatal("Expected no error while generating key packet, got:", err)
+		}
+	}
+	assert.Exactly(t, keyPackets[0], keyPackets[1])
+
+	publicKey := readTestFile("keyring_publicKey", false)
+	for _, keyPacket := range []func() ([]byte, error){
+		func() ([]byte, error) { return custom.KeyPacketWithPublicKey(symmetricKey, publicKey) },
+		func() ([]byte, error) { return custom.KeyPacketWithPublicKeys(symmetricKey, []string{publicKey}) },
+		func() ([]byte, error) { return custom.KeyPacketWithPublicKeyAt(symmetricKey, publicKey, testTime) },
+	} {
+		random := &countingReader{r: rand.Reader}
+		custom.SetConfig(&packet.Config{Rand: random})
+		if _, err = keyPacket(); err != nil {
+			t.Fatal("Expected no error while generating key packet, got:", err)
+		}
+		assert.NotZero(t, random.n)
+	}
+
+	custom.SetConfig(nil)
+	token, err = custom.RandomToken()
+	if err != nil {
+		t.Fatal("Expected no error while generating random token, got:", err)
+	}
+	assert.Len(t, token, 32)
 }
 
 func TestAsymmetricKeyPacket(t *testing.T) {
@@ -51,6 +125,106 @@ func TestAsymmetricKeyPacket(t *testing.T) {
 	assert.Exactly(t, symmetricKey, outputSymmetricKey)
 }
 
+func TestGetSessionFromKeyPacketStrict(t *testing.T) {
+	symmetricKey := &SymmetricKey{
+		Key:  testRandomToken,
+		Algo: constants.AES256,
+	}
+	publicKey, _ := testPrivateKeyRing.GetArmoredPublicKey()
+	keyPacket, err := pgp.KeyPacketWithPublicKey(symmetricKey, publicKey)
+	if err != nil {
+		t.Fatal("Expected no error while generating key packet, got:", err)
+	}
+	dataPacket, err := pgp.EncryptWithSessionKey([]byte("plain text"), symmetricKey)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting data packet, got:", err)
+	}
+
+	outputSymmetricKey, err := pgp.GetSessionFromKeyPacketStrict(keyPacket, testPrivateKeyRing, testMailboxPassword)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting key packet, got:", err)
+	}
+	assert.Exactly(t, symmetricKey, outputSymmetricKey)
+
+	withData := append(append([]byte{}, keyPacket...), dataPacket...)
+	outputSymmetricKey, err = pgp.GetSessionFromKeyPacket(withData, testPrivateKeyRing, testMailboxPassword)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting key packet, got:", err)
+	}
+	assert.Exactly(t, symmetricKey, outputSymmetricKey)
+
+	_, err = pgp.GetSessionFromKeyPacketStrict(withData, testPrivateKeyRing, testMailboxPassword)
+	assert.EqualError(t, err, "gopenpgp: unexpected packet with tag 18 in key packets")
+
+	_, err = pgp.GetSessionFromKeyPacketStrict(
+		append(append([]byte{}, keyPacket...), 0x00), testPrivateKeyRing, testMailboxPassword,
+	)
+	assert.Error(t, err)
+}
+
+func TestAsymmetricKeyPacketWithPrivateKey(t *testing.T) {
+	symmetricKey := &SymmetricKey{
+		Key:  testRandomToken,
+		Algo: constants.AES256,
+	}
+	privateKey := readTestFile("keyring_privateKey", false)
+
+	_, err := pgp.KeyPacketWithPublicKey(symmetricKey, privateKey)
+	assert.EqualError(t, err, "gopenpgp: expected public key, got private key")
+
+	_, err = pgp.KeyPacketWithPublicKeyAt(symmetricKey, privateKey, testTime)
+	assert.EqualError(t, err, "gopenpgp: expected public key, got private key")
+
+	_, err = pgp.KeyPacketWithPublicKeys(symmetricKey, []string{privateKey})
+	assert.EqualError(t, err, "gopenpgp: public key 0: gopenpgp: expected public key, got private key")
+}
+
+func TestAsymmetricKeyPacketECDHKDF(t *testing.T) {
+	symmetricKey := &SymmetricKey{
+		Key:  testRandomToken,
+		Algo: constants.AES256,
+	}
+
+	keyPacket, err := pgp.KeyPacketWithPublicKey(symmetricKey, ecPublicKey)
+	if err != nil {
+		t.Fatal("Expected no error while generating key packet, got:", err)
+	}
+	outputSymmetricKey, err := pgp.GetSessionFromKeyPacket(keyPacket, ecPrivateKeyRing, passphrase)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting key packet, got:", err)
+	}
+	assert.Exactly(t, symmetricKey, outputSymmetricKey)
+
+	rawKey, err := armor.Unarmor(ecPublicKey)
+	if err != nil {
+		t.Fatal("Expected no error while unarmoring key, got:", err)
+	}
+	packets := packet.NewOpaqueReader(bytes.NewReader(rawKey))
+	for {
+		op, err := packets.Next()
+		if err != nil {
+			t.Fatal("Expected no error while reading key packets, got:", err)
+		}
+		if op.Tag != 14 {
+			continue
+		}
+
+		// The KDF parameters end the ECDH subkey packet: 03 01 hash cipher.
+		// MD5 is too short for an AES-256 key wrapping key.
+		op.Contents[len(op.Contents)-2] = 1
+		op.Contents[len(op.Contents)-1] = 9
+		p, err := op.Parse()
+		if err != nil {
+			t.Fatal("Expected no error while parsing subkey, got:", err)
+		}
+		pub := p.(*packet.PublicKey)
+
+		err = serializeEncryptedKey(ioutil.Discard, pub, packet.CipherAES256, symmetricKey.Key, nil)
+		assert.EqualError(t, err, fmt.Sprintf("gopenpgp: invalid ECDH KDF hash 1 in key %x", pub.KeyId))
+		break
+	}
+}
+
 func TestSymmetricKeyPacket(t *testing.T) {
 	symmetricKey := &SymmetricKey{
 		Key:	testRandomToken,
@@ -74,3 +248,808 @@ func TestSymmetricKeyPacket(t *testing.T) {
 
 	assert.Exactly(t, symmetricKey, outputSymmetricKey)
 }
+
+func TestReKeySymmetricPacket(t *testing.T) {
+	symmetricKey := &SymmetricKey{
+		Key:  testRandomToken,
+		Algo: constants.AES256,
+	}
+
+	keyPacket, err := pgp.SymmetricKeyPacketWithPassword(symmetricKey, "old password")
+	if err != nil {
+		t.Fatal("Expected no error while generating key packet, got:", err)
+	}
+	dataPacket, err := pgp.EncryptWithSessionKey([]byte("plain text"), symmetricKey)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting with session key, got:", err)
+	}
+
+	newKeyPacket, err := pgp.ReKeySymmetricPacket(
+		keyPacket, dataPacket, []byte("old password"), []byte("new password"),
+	)
+	if err != nil {
+		t.Fatal("Expected no error while re-keying key packet, got:", err)
+	}
+	outputSymmetricKey, err := pgp.GetSessionFromSymmetricPacket(newKeyPacket, "new password")
+	if err != nil {
+		t.Fatal("Expected no error while decrypting key packet, got:", err)
+	}
+	assert.Exactly(t, symmetricKey, outputSymmetricKey)
+
+	// Only the beginning of the data packet is needed
+	_, err = pgp.ReKeySymmetricPacket(keyPacket, dataPacket[:40], []byte("old password"), []byte("new password"))
+	assert.NoError(t, err)
+
+	_, err = pgp.ReKeySymmetricPacket(keyPacket, dataPacket, []byte("wrong password"), []byte("new password"))
+	assert.Exactly(t, constants.ErrorCodeWrongPassphrase, GetErrorCode(err))
+
+	_, err = pgp.ReKeySymmetricPacket(keyPacket, nil, []byte("old password"), []byte("new password"))
+	assert.EqualError(t, err, "gopenpgp: no data packet given")
+
+	_, err = pgp.ReKeySymmetricPacket(keyPacket, dataPacket, []byte("old password"), nil)
+	assert.EqualError(t, err, "password can't be empty")
+}
+
+func TestReKeySymmetricPacketWithoutEncryptedKey(t *testing.T) {
+	// v4 packet without encrypted session key: AES-256, iterated and salted
+	// S2K with SHA256, so that any password decrypts it to a key
+	keyPacket := []byte{0xc3, 0x0d, 0x04, 0x09, 0x03, 0x08, 1, 2, 3, 4, 5, 6, 7, 8, 0x60}
+	dataPacket, err := pgp.EncryptWithSessionKey([]byte("plain text"), &SymmetricKey{
+		Key:  testRandomToken,
+		Algo: constants.AES256,
+	})
+	if err != nil {
+		t.Fatal("Expected no error while encrypting with session key, got:", err)
+	}
+
+	_, err = pgp.ReKeySymmetricPacket(keyPacket, dataPacket, []byte("wrong password"), []byte("new password"))
+	assert.Exactly(t, constants.ErrorCodeWrongPassphrase, GetErrorCode(err))
+}
+
+func TestSymmetricKeyPacketUnsupportedCipher(t *testing.T) {
+	// v4 packet: Twofish, iterated and salted S2K with SHA256
+	twofishPacket := []byte{0xc3, 0x0d, 0x04, 0x0a, 0x03, 0x08, 1, 2, 3, 4, 5, 6, 7, 8, 0x60}
+
+	_, err := pgp.GetSessionFromSymmetricPacket(twofishPacket, "I like encryption")
+	assert.EqualError(t, err, "gopenpgp: session key packet uses unsupported cipher 10")
+
+	keyPacket, err := pgp.SymmetricKeyPacketWithPassword(&SymmetricKey{
+		Key:  testRandomToken,
+		Algo: constants.AES256,
+	}, "I like encryption")
+	if err != nil {
+		t.Fatal("Expected no error while generating key packet, got:", err)
+	}
+	sessionKey, err := pgp.GetSessionFromSymmetricPacket(
+		append(append([]byte{}, twofishPacket...), keyPacket...), "I like encryption",
+	)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting key packet, got:", err)
+	}
+	assert.Exactly(t, testRandomToken, sessionKey.Key)
+}
+
+func TestSymmetricKeyPacketWithPasswordWriter(t *testing.T) {
+	symmetricKey := &SymmetricKey{
+		Key:  testRandomToken,
+		Algo: constants.AES256,
+	}
+
+	var keyPacket bytes.Buffer
+	if err := pgp.SymmetricKeyPacketWithPasswordWriter(&keyPacket, symmetricKey, "I like encryption"); err != nil {
+		t.Fatal("Expected no error while writing key packet, got:", err)
+	}
+	outputSymmetricKey, err := pgp.GetSessionFromSymmetricPacket(keyPacket.Bytes(), "I like encryption")
+	if err != nil {
+		t.Fatal("Expected no error while decrypting key packet, got:", err)
+	}
+	assert.Exactly(t, symmetricKey, outputSymmetricKey)
+
+	var empty bytes.Buffer
+	err = pgp.SymmetricKeyPacketWithPasswordWriter(&empty, symmetricKey, "")
+	assert.EqualError(t, err, "password can't be empty")
+	assert.Exactly(t, 0, empty.Len())
+}
+
+func TestBuildSessionPackets(t *testing.T) {
+	symmetricKey := &SymmetricKey{
+		Key:  testRandomToken,
+		Algo: constants.AES256,
+	}
+
+	keyPackets, err := pgp.BuildSessionPackets(
+		symmetricKey, []string{readTestFile("keyring_publicKey", false)}, [][]byte{[]byte("first"), []byte("second")},
+	)
+	if err != nil {
+		t.Fatal("Expected no error while building key packets, got:", err)
+	}
+	dataPacket, err := pgp.EncryptWithSessionKey([]byte("plain text"), symmetricKey)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting data packet, got:", err)
+	}
+	armored, err := JoinMessage(keyPackets, dataPacket)
+	if err != nil {
+		t.Fatal("Expected no error while joining message, got:", err)
+	}
+
+	decrypted, err := pgp.DecryptMessage(armored, testPrivateKeyRing, testMailboxPassword)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting with key, got:", err)
+	}
+	assert.Exactly(t, "plain text", decrypted)
+
+	for _, password := range []string{"first", "second"} {
+		decrypted, err = pgp.DecryptMessageWithPassword(armored, password)
+		if err != nil {
+			t.Fatal("Expected no error while decrypting with password, got:", err)
+		}
+		assert.Exactly(t, "plain text", decrypted)
+	}
+	_, err = pgp.DecryptMessageWithPassword(armored, "wrong")
+	assert.Error(t, err)
+
+	_, err = pgp.BuildSessionPackets(symmetricKey, nil, nil)
+	assert.EqualError(t, err, "gopenpgp: no public key or password given")
+	_, err = pgp.BuildSessionPackets(symmetricKey, nil, [][]byte{{}})
+	assert.EqualError(t, err, "password can't be empty")
+}
+
+func TestSetDefaultCipher(t *testing.T) {
+	defer func() { _ = pgp.SetDefaultCipher(0) }()
+
+	assert.EqualError(t, pgp.SetDefaultCipher(packet.CipherFunction(10)), "gopenpgp: unsupported cipher function: 10")
+	assert.EqualError(t, pgp.SetDefaultCipher(packet.CipherCAST5), "gopenpgp: weak cipher function 3 can't be the default")
+	assert.EqualError(t, pgp.SetDefaultCipher(packet.Cipher3DES), "gopenpgp: weak cipher function 2 can't be the default")
+	if err := pgp.SetDefaultCipher(packet.CipherAES128); err != nil {
+		t.Fatal("Expected no error while setting default cipher, got:", err)
+	}
+
+	token, err := pgp.RandomToken()
+	if err != nil {
+		t.Fatal("Expected no error while generating random token, got:", err)
+	}
+	assert.Len(t, token, 16)
+
+	encrypted, err := pgp.EncryptMessageWithPassword("plain text", "password")
+	if err != nil {
+		t.Fatal("Expected no error while encrypting, got:", err)
+	}
+	keyPacket, _, err := SplitMessage(encrypted)
+	if err != nil {
+		t.Fatal("Expected no error while splitting message, got:", err)
+	}
+	sessionKey, err := pgp.GetSessionFromSymmetricPacket(keyPacket, "password")
+	if err != nil {
+		t.Fatal("Expected no error while decrypting key packet, got:", err)
+	}
+	assert.Exactly(t, constants.AES128, sessionKey.Algo)
+
+	ap, err := pgp.EncryptAttachmentLowMemory(len("attachment"), "file.txt", testPublicKeyRing)
+	if err != nil {
+		t.Fatal("Expected no error while creating attachment processor, got:", err)
+	}
+	ap.Process([]byte("attachment"))
+	split, err := ap.Finish()
+	if err != nil {
+		t.Fatal("Expected no error while encrypting attachment, got:", err)
+	}
+	assert.Exactly(t, constants.AES128, split.Algo)
+}
+
+func TestSetAllowedCiphers(t *testing.T) {
+	defer func() { _ = pgp.SetAllowedCiphers(nil) }()
+
+	assert.EqualError(t, pgp.SetAllowedCiphers([]packet.CipherFunction{10}), "gopenpgp: unsupported cipher function: 10")
+
+	oldClient := &openpgp.Entity{Identities: map[string]*openpgp.Identity{
+		"old": {SelfSignature: &packet.Signature{PreferredSymmetric: []uint8{
+			uint8(packet.CipherAES128), uint8(packet.Cipher3DES),
+		}}},
+	}}
+	recipients := []*openpgp.Entity{oldClient}
+
+	assert.Exactly(t, packet.CipherAES128, pgp.getRecipientsCipher(recipients))
+	assert.Exactly(t, packet.CipherAES256, pgp.getRecipientsCipher([]*openpgp.Entity{{}}))
+
+	if err := pgp.SetAllowedCiphers([]packet.CipherFunction{packet.Cipher3DES, packet.CipherAES256}); err != nil {
+		t.Fatal("Expected no error while setting allowed ciphers, got:", err)
+	}
+	assert.Exactly(t, packet.Cipher3DES, pgp.getRecipientsCipher(recipients))
+
+	if err := pgp.SetAllowedCiphers([]packet.CipherFunction{packet.CipherAES192}); err != nil {
+		t.Fatal("Expected no error while setting allowed ciphers, got:", err)
+	}
+	assert.Exactly(t, packet.CipherAES256, pgp.getRecipientsCipher(recipients))
+}
+
+func TestSymmetricKeyPacketAEAD(t *testing.T) {
+	symmetricKey := &SymmetricKey{
+		Key:  testRandomToken,
+		Algo: constants.AES256,
+	}
+
+	_, err := pgp.SymmetricKeyPacketWithPasswordAEAD(symmetricKey, "I like encryption", AEADModeOCB)
+	assert.EqualError(t, err, "gopenpgp: AEAD session key packets are not supported by the crypto library")
+
+	_, err = pgp.SymmetricKeyPacketWithPasswordAEAD(symmetricKey, "I like encryption", AEADMode(4))
+	assert.EqualError(t, err, "gopenpgp: unsupported AEAD mode: 4")
+
+	// v5 packet: AES256, OCB, iterated and salted S2K with SHA256
+	aeadPacket := []byte{0xc3, 0x4d, 0x05, 0x09, 0x02, 0x03, 0x08}
+	aeadPacket = append(aeadPacket, make([]byte, 8+1+15+32+16)...)
+
+	_, err = pgp.GetSessionFromSymmetricPacket(aeadPacket, "I like encryption")
+	assert.EqualError(t, err, "gopenpgp: AEAD session key packets are not supported by the crypto library")
+}
+
+func TestAsymmetricKeyPacketWithKeyID(t *testing.T) {
+	symmetricKey := &SymmetricKey{
+		Key:  testRandomToken,
+		Algo: constants.AES256,
+	}
+
+	privateKeyRing, _ := ReadArmoredKeyRing(strings.NewReader(readTestFile("keyring_privateKey", false)))
+	publicKey, _ := testPrivateKeyRing.GetArmoredPublicKey()
+
+	keyPacket, err := pgp.KeyPacketWithPublicKey(symmetricKey, publicKey)
+	if err != nil {
+		t.Fatal("Expected no error while generating key packet, got:", err)
+	}
+
+	outputSymmetricKey, keyID, err := pgp.GetSessionFromKeyPacketWithKeyID(keyPacket, privateKeyRing, testMailboxPassword)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting key packet, got:", err)
+	}
+
+	assert.Exactly(t, symmetricKey, outputSymmetricKey)
+	assert.Exactly(t, privateKeyRing.entities[0].Subkeys[0].PublicKey.KeyId, keyID)
+}
+
+func TestMultipleAsymmetricKeyPackets(t *testing.T) {
+	symmetricKey := &SymmetricKey{
+		Key:  testRandomToken,
+		Algo: constants.AES256,
+	}
+
+	privateKeyRing, _ := ReadArmoredKeyRing(strings.NewReader(readTestFile("keyring_privateKey", false)))
+	publicKey, _ := testPrivateKeyRing.GetArmoredPublicKey()
+
+	keyPackets, err := pgp.KeyPacketWithPublicKeys(symmetricKey, []string{publicKey, publicKey})
+	if err != nil {
+		t.Fatal("Expected no error while generating key packets, got:", err)
+	}
+
+	packets := packet.NewReader(bytes.NewReader(keyPackets))
+	for i := 0; i < 2; i++ {
+		p, err := packets.Next()
+		if err != nil {
+			t.Fatal("Expected no error while reading key packet, got:", err)
+		}
+		assert.IsType(t, &packet.EncryptedKey{}, p)
+	}
+	_, err = packets.Next()
+	assert.Exactly(t, io.EOF, err)
+
+	outputSymmetricKey, err := pgp.GetSessionFromKeyPacket(keyPackets, privateKeyRing, testMailboxPassword)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting key packet, got:", err)
+	}
+	assert.Exactly(t, symmetricKey, outputSymmetricKey)
+
+	_, err = pgp.KeyPacketWithPublicKeys(symmetricKey, []string{publicKey, "not a key"})
+	assert.Contains(t, err.Error(), "gopenpgp: cannot read public key 1")
+}
+
+func TestAsymmetricKeyPacketsAnonymous(t *testing.T) {
+	symmetricKey := &SymmetricKey{
+		Key:  testRandomToken,
+		Algo: constants.AES256,
+	}
+
+	entity := generateTestEntity(t, name, name+"@"+domain)
+	otherKey := serializeTestPublicKey(t, entity)
+	publicKey, _ := testPrivateKeyRing.GetArmoredPublicKey()
+
+	keyPackets, err := pgp.KeyPacketWithPublicKeysAnonymous(symmetricKey, []string{otherKey, publicKey})
+	if err != nil {
+		t.Fatal("Expected no error while generating key packets, got:", err)
+	}
+
+	packets := packet.NewReader(bytes.NewReader(keyPackets))
+	for i := 0; i < 2; i++ {
+		p, err := packets.Next()
+		if err != nil {
+			t.Fatal("Expected no error while reading key packet, got:", err)
+		}
+		assert.Exactly(t, uint64(0), p.(*packet.EncryptedKey).KeyId)
+	}
+	_, err = packets.Next()
+	assert.Exactly(t, io.EOF, err)
+
+	outputSymmetricKey, err := pgp.GetSessionFromKeyPacket(keyPackets, testPrivateKeyRing, testMailboxPassword)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting key packet, got:", err)
+	}
+	assert.Exactly(t, symmetricKey, outputSymmetricKey)
+}
+
+func TestAsymmetricKeyPacketOtherKeyID(t *testing.T) {
+	symmetricKey := &SymmetricKey{
+		Key:  testRandomToken,
+		Algo: constants.AES256,
+	}
+	publicKey, _ := testPrivateKeyRing.GetArmoredPublicKey()
+	keyPacket, err := pgp.KeyPacketWithPublicKey(symmetricKey, publicKey)
+	if err != nil {
+		t.Fatal("Expected no error while generating key packet, got:", err)
+	}
+
+	// The packet is encrypted to testPrivateKeyRing, but names another key
+	op, err := packet.NewOpaqueReader(bytes.NewReader(keyPacket)).Next()
+	if err != nil {
+		t.Fatal("Expected no error while reading key packet, got:", err)
+	}
+	copy(op.Contents[1:9], []byte{1, 2, 3, 4, 5, 6, 7, 8})
+	var otherKeyPacket bytes.Buffer
+	if err = op.Serialize(&otherKeyPacket); err != nil {
+		t.Fatal("Expected no error while serializing key packet, got:", err)
+	}
+
+	_, err = pgp.GetSessionFromKeyPacket(otherKeyPacket.Bytes(), testPrivateKeyRing, testMailboxPassword)
+	assert.Exactly(t, constants.ErrorCodeNoDecryptionKey, GetErrorCode(err))
+}
+
+func TestGnuPGAnonymousRecipients(t *testing.T) {
+	// Encrypted by GnuPG with --throw-keyids to another key and testPublicKeyRing
+	armored := readTestFile("message_gnupgAnonymousRecipients", false)
+
+	keyPacket, dataPacket, err := SplitMessage(armored)
+	if err != nil {
+		t.Fatal("Expected no error while splitting message, got:", err)
+	}
+	sessionKey, err := pgp.GetSessionFromKeyPacket(keyPacket, testPrivateKeyRing, testMailboxPassword)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting key packet, got:", err)
+	}
+	plainData, err := pgp.DecryptWithSessionKey(dataPacket, sessionKey)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting data packet, got:", err)
+	}
+	assert.Exactly(t, "Hello from GnuPG\n", string(plainData))
+
+	decrypted, err := pgp.DecryptMessage(armored, testPrivateKeyRing, testMailboxPassword)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting message, got:", err)
+	}
+	assert.Exactly(t, "Hello from GnuPG\n", decrypted)
+}
+
+func TestGetSessionSplitUnknownCipher(t *testing.T) {
+	algo, err := getAlgo(packet.CipherAES128)
+	if err != nil {
+		t.Fatal("Expected no error while mapping cipher, got:", err)
+	}
+	assert.Exactly(t, constants.AES128, algo)
+
+	ek := &packet.EncryptedKey{
+		CipherFunc: packet.CipherFunction(10), // Twofish
+		Key:        testRandomToken,
+	}
+
+	_, err = getSessionSplit(ek)
+	assert.EqualError(t, err, "gopenpgp: unsupported cipher function: 10")
+}
+
+func TestAsymmetricKeyPacketReader(t *testing.T) {
+	symmetricKey := &SymmetricKey{
+		Key:  testRandomToken,
+		Algo: constants.AES256,
+	}
+
+	privateKeyRing, _ := ReadArmoredKeyRing(strings.NewReader(readTestFile("keyring_privateKey", false)))
+	publicKey, _ := testPrivateKeyRing.GetArmoredPublicKey()
+
+	keyPacket, err := pgp.KeyPacketWithPublicKey(symmetricKey, publicKey)
+	if err != nil {
+		t.Fatal("Expected no error while generating key packet, got:", err)
+	}
+
+	trailing := []byte("data packets")
+	r := bytes.NewReader(append(keyPacket, trailing...))
+	outputSymmetricKey, err := pgp.GetSessionFromKeyPacketReader(r, privateKeyRing, testMailboxPassword)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting key packet, got:", err)
+	}
+	assert.Exactly(t, symmetricKey, outputSymmetricKey)
+
+	rest, _ := ioutil.ReadAll(r)
+	assert.Exactly(t, trailing, rest)
+}
+
+func TestAnonymousAsymmetricKeyPacket(t *testing.T) {
+	symmetricKey := &SymmetricKey{
+		Key:  testRandomToken,
+		Algo: constants.AES256,
+	}
+
+	privateKeyRing, _ := ReadArmoredKeyRing(strings.NewReader(readTestFile("keyring_privateKey", false)))
+	publicKey, _ := testPrivateKeyRing.GetPublicKey()
+
+	keyPacket, err := pgp.KeyPacketWithPublicKeyBinAnonymous(symmetricKey, publicKey)
+	if err != nil {
+		t.Fatal("Expected no error while generating key packet, got:", err)
+	}
+
+	p, err := packet.Read(bytes.NewReader(keyPacket))
+	if err != nil {
+		t.Fatal("Expected no error while reading key packet, got:", err)
+	}
+	assert.Exactly(t, uint64(0), p.(*packet.EncryptedKey).KeyId)
+
+	outputSymmetricKey, err := pgp.GetSessionFromKeyPacket(keyPacket, privateKeyRing, testMailboxPassword)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting key packet, got:", err)
+	}
+	assert.Exactly(t, symmetricKey, outputSymmetricKey)
+}
+
+func TestAsymmetricKeyPacketStrict(t *testing.T) {
+	symmetricKey := &SymmetricKey{
+		Key:  testRandomToken,
+		Algo: constants.AES256,
+	}
+
+	publicKey, err := testPublicKeyRing.GetPublicKey()
+	if err != nil {
+		t.Fatal("Expected no error while serializing public key, got:", err)
+	}
+
+	keyPacket, err := pgp.KeyPacketWithPublicKeyBinStrict(symmetricKey, publicKey)
+	if err != nil {
+		t.Fatal("Expected no error while generating key packet, got:", err)
+	}
+
+	outputSymmetricKey, err := pgp.GetSessionFromKeyPacket(keyPacket, testPrivateKeyRing, testMailboxPassword)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting key packet, got:", err)
+	}
+	assert.Exactly(t, symmetricKey, outputSymmetricKey)
+
+	// A key whose only subkey has no key flags
+	entity := generateTestEntity(t, name, name+"@"+domain)
+	entity.Subkeys[0].Sig.FlagsValid = false
+	if err = entity.Subkeys[0].Sig.SignKey(entity.Subkeys[0].PublicKey, entity.PrivateKey, nil); err != nil {
+		t.Fatal("Expected no error while signing subkey, got:", err)
+	}
+
+	var legacyKey bytes.Buffer
+	if err = entity.Serialize(&legacyKey); err != nil {
+		t.Fatal("Expected no error while serializing key, got:", err)
+	}
+
+	_, err = pgp.KeyPacketWithPublicKeyBin(symmetricKey, legacyKey.Bytes())
+	assert.NoError(t, err)
+
+	_, err = pgp.KeyPacketWithPublicKeyBinStrict(symmetricKey, legacyKey.Bytes())
+	assert.EqualError(t, err, "gopenpgp: cannot set key: no key with valid encryption key flags available")
+}
+
+func TestAsymmetricKeyPacketAt(t *testing.T) {
+	symmetricKey := &SymmetricKey{
+		Key:  testRandomToken,
+		Algo: constants.AES256,
+	}
+
+	publicKey, err := testPublicKeyRing.GetArmoredPublicKey()
+	if err != nil {
+		t.Fatal("Expected no error while serializing public key, got:", err)
+	}
+
+	keyPacket, err := pgp.KeyPacketWithPublicKeyAt(symmetricKey, publicKey, testTime)
+	if err != nil {
+		t.Fatal("Expected no error while generating key packet, got:", err)
+	}
+
+	outputSymmetricKey, err := pgp.GetSessionFromKeyPacket(keyPacket, testPrivateKeyRing, testMailboxPassword)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting key packet, got:", err)
+	}
+	assert.Exactly(t, symmetricKey, outputSymmetricKey)
+
+	// A key whose only encryption subkey expires after an hour
+	entity := generateTestEntity(t, name, name+"@"+domain)
+	subKey := entity.Subkeys[0]
+	lifetime := uint32(3600)
+	subKey.Sig.KeyLifetimeSecs = &lifetime
+	if err = subKey.Sig.SignKey(subKey.PublicKey, entity.PrivateKey, nil); err != nil {
+		t.Fatal("Expected no error while signing subkey, got:", err)
+	}
+	expiringKey := serializeTestPublicKey(t, entity)
+	created := subKey.PublicKey.CreationTime.Unix()
+
+	_, err = pgp.KeyPacketWithPublicKeyAt(symmetricKey, expiringKey, created+60)
+	assert.NoError(t, err)
+
+	_, err = pgp.KeyPacketWithPublicKeyAt(symmetricKey, expiringKey, created+7200)
+	assert.EqualError(t, err, fmt.Sprintf("gopenpgp: cannot set key: subkey %x is expired", subKey.PublicKey.KeyId))
+
+	// The same subkey, revoked
+	subKey.Sig.SigType = packet.SigTypeSubkeyRevocation
+	if err = subKey.Sig.SignKey(subKey.PublicKey, entity.PrivateKey, nil); err != nil {
+		t.Fatal("Expected no error while signing subkey, got:", err)
+	}
+	revokedKey := serializeTestPublicKey(t, entity)
+
+	_, err = pgp.KeyPacketWithPublicKeyAt(symmetricKey, revokedKey, created+60)
+	assert.EqualError(t, err, fmt.Sprintf("gopenpgp: cannot set key: subkey %x is revoked", subKey.PublicKey.KeyId))
+}
+
+func TestEncryptionKeyRevocation(t *testing.T) {
+	entity := generateTestEntity(t, name, name+"@"+domain)
+	now := time.Now()
+
+	// Anyone can append an unsigned revocation to a public key
+	entity.Revocations = append(entity.Revocations, &packet.Signature{SigType: packet.SigTypeKeyRevocation})
+	encryptionKey, err := getEntitiesEncryptionKeyAt(openpgp.EntityList{entity}, now)
+	if err != nil {
+		t.Fatal("Expected no error while getting encryption key, got:", err)
+	}
+	assert.Exactly(t, entity.Subkeys[0].PublicKey, encryptionKey)
+
+	entity.Revocations = append(entity.Revocations, revokeTestEntity(t, entity))
+	_, err = getEntitiesEncryptionKeyAt(openpgp.EntityList{entity}, now)
+	assert.EqualError(t, err, fmt.Sprintf("gopenpgp: cannot set key: key %x is revoked", entity.PrimaryKey.KeyId))
+	assert.Exactly(t, constants.ErrorCodeKeyRevoked, GetErrorCode(err))
+}
+
+func serializeTestPublicKey(t *testing.T, entity *openpgp.Entity) string {
+	var rawKey bytes.Buffer
+	if err := entity.Serialize(&rawKey); err != nil {
+		t.Fatal("Expected no error while serializing key, got:", err)
+	}
+	armored, err := armor.ArmorKey(rawKey.Bytes())
+	if err != nil {
+		t.Fatal("Expected no error while armoring key, got:", err)
+	}
+	return armored
+}
+
+func TestEncryptWithSessionKey(t *testing.T) {
+	var message = "plain text"
+
+	sessionKey := &SymmetricKey{
+		Key:  testRandomToken,
+		Algo: constants.AES256,
+	}
+
+	dataPacket, err := pgp.EncryptWithSessionKey([]byte(message), sessionKey)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting with session key, got:", err)
+	}
+
+	decrypted, err := pgp.DecryptWithSessionKey(dataPacket, sessionKey)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting with session key, got:", err)
+	}
+	assert.Exactly(t, message, string(decrypted))
+
+	keyPacket, err := pgp.SymmetricKeyPacketWithPassword(sessionKey, "password")
+	if err != nil {
+		t.Fatal("Expected no error while generating key packet, got:", err)
+	}
+	armored, err := JoinMessage(keyPacket, dataPacket)
+	if err != nil {
+		t.Fatal("Expected no error while joining message, got:", err)
+	}
+	decryptedText, err := pgp.DecryptMessageWithPassword(armored, "password")
+	if err != nil {
+		t.Fatal("Expected no error while decrypting joined message, got:", err)
+	}
+	assert.Exactly(t, message, decryptedText)
+
+	wrongKey, err := pgp.RandomTokenWith(32)
+	if err != nil {
+		t.Fatal("Expected no error while generating random token, got:", err)
+	}
+	_, err = pgp.DecryptWithSessionKey(dataPacket, &SymmetricKey{Key: wrongKey, Algo: constants.AES256})
+	assert.Exactly(t, constants.ErrorCodeNoDecryptionKey, GetErrorCode(err))
+}
+
+func TestReKeySessionPacket(t *testing.T) {
+	var message = "plain text"
+
+	armored, err := pgp.EncryptMessage(message, testPublicKeyRing, nil, "", false)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting message, got:", err)
+	}
+	keyPacket, dataPacket, err := SplitMessage(armored)
+	if err != nil {
+		t.Fatal("Expected no error while splitting message, got:", err)
+	}
+
+	recipientKey := generateTestKey(t, "recipient")
+	recipientPublicKey, err := pgp.GetPublicKeyFromPrivate(recipientKey)
+	if err != nil {
+		t.Fatal("Expected no error while extracting public key, got:", err)
+	}
+	recipientKeyRing, err := ReadArmoredKeyRing(strings.NewReader(recipientKey))
+	if err != nil {
+		t.Fatal("Expected no error while reading key, got:", err)
+	}
+
+	newKeyPacket, err := pgp.ReKeySessionPacket(keyPacket, testPrivateKeyRing, testMailboxPassword, recipientPublicKey)
+	if err != nil {
+		t.Fatal("Expected no error while re-keying session packet, got:", err)
+	}
+
+	decrypted, err := pgp.DecryptAttachment(newKeyPacket, dataPacket, recipientKeyRing, []byte("recipient"))
+	if err != nil {
+		t.Fatal("Expected no error while decrypting re-keyed message, got:", err)
+	}
+	assert.Exactly(t, message, string(decrypted))
+
+	_, err = pgp.ReKeySessionPacket(newKeyPacket, testPrivateKeyRing, testMailboxPassword, recipientPublicKey)
+	assert.Error(t, err)
+}
+
+func TestSymmetricKeyPacketWithPasswords(t *testing.T) {
+	var message = "plain text"
+	passwords := []string{"first password", "second password", "third password"}
+
+	sessionKey := &SymmetricKey{
+		Key:  testRandomToken,
+		Algo: constants.AES256,
+	}
+
+	keyPacket, err := pgp.SymmetricKeyPacketWithPasswords(sessionKey, passwords)
+	if err != nil {
+		t.Fatal("Expected no error while generating key packets, got:", err)
+	}
+
+	dataPacket, err := pgp.EncryptWithSessionKey([]byte(message), sessionKey)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting with session key, got:", err)
+	}
+	for _, password := range passwords {
+		outputSessionKey, err := pgp.GetSessionFromSymmetricPacket(append(keyPacket, dataPacket...), password)
+		if err != nil {
+			t.Fatal("Expected no error while decrypting key packet, got:", err)
+		}
+		assert.Exactly(t, sessionKey, outputSessionKey)
+	}
+	_, err = pgp.GetSessionFromSymmetricPacket(append(keyPacket, dataPacket...), "wrong password")
+	assert.Exactly(t, constants.ErrorCodeWrongPassphrase, GetErrorCode(err))
+
+	armored, err := JoinMessage(keyPacket, dataPacket)
+	if err != nil {
+		t.Fatal("Expected no error while joining message, got:", err)
+	}
+	for _, password := range passwords {
+		decrypted, err := pgp.DecryptMessageWithPassword(armored, password)
+		if err != nil {
+			t.Fatal("Expected no error while decrypting message, got:", err)
+		}
+		assert.Exactly(t, message, decrypted)
+	}
+
+	_, err = pgp.SymmetricKeyPacketWithPasswords(sessionKey, nil)
+	assert.EqualError(t, err, "gopenpgp: no password given")
+
+	_, err = pgp.SymmetricKeyPacketWithPasswords(sessionKey, []string{"password", ""})
+	assert.EqualError(t, err, "password can't be empty")
+}
+
+func TestSymmetricKeyPacketAmbiguous(t *testing.T) {
+	sessionKey := &SymmetricKey{
+		Key:  testRandomToken,
+		Algo: constants.AES256,
+	}
+	otherSessionKey := &SymmetricKey{
+		Key:  bytes.Repeat([]byte{1}, 32),
+		Algo: constants.AES256,
+	}
+
+	keyPacket, err := pgp.SymmetricKeyPacketWithPassword(otherSessionKey, "password")
+	if err != nil {
+		t.Fatal("Expected no error while generating key packet, got:", err)
+	}
+	secondKeyPacket, err := pgp.SymmetricKeyPacketWithPassword(sessionKey, "password")
+	if err != nil {
+		t.Fatal("Expected no error while generating key packet, got:", err)
+	}
+	keyPacket = append(keyPacket, secondKeyPacket...)
+
+	_, err = pgp.GetSessionFromSymmetricPacket(keyPacket, "password")
+	assert.EqualError(
+		t, err, "gopenpgp: password decrypts several session key packets to different keys, the data packet is needed",
+	)
+
+	dataPacket, err := pgp.EncryptWithSessionKey([]byte("plain text"), sessionKey)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting with session key, got:", err)
+	}
+	outputSessionKey, err := pgp.GetSessionFromSymmetricPacket(append(keyPacket, dataPacket...), "password")
+	if err != nil {
+		t.Fatal("Expected no error while decrypting key packet, got:", err)
+	}
+	assert.Exactly(t, sessionKey, outputSessionKey)
+}
+
+func TestSymmetricKeyPacketWithPasswordOptions(t *testing.T) {
+	sessionKey := &SymmetricKey{
+		Key:  testRandomToken,
+		Algo: constants.AES256,
+	}
+	const password = "I like encryption"
+
+	keyPacket, err := pgp.SymmetricKeyPacketWithPasswordOptions(
+		sessionKey, password, &S2KOptions{Count: 1 << 20, Hash: constants.SHA512},
+	)
+	if err != nil {
+		t.Fatal("Expected no error while generating key packet, got:", err)
+	}
+
+	op, err := packet.NewOpaqueReader(bytes.NewReader(keyPacket)).Next()
+	if err != nil {
+		t.Fatal("Expected no error while reading key packet, got:", err)
+	}
+	// Version, cipher, S2K type, hash, 8 byte salt and coded count
+	assert.Exactly(t, byte(3), op.Contents[2])
+	assert.Exactly(t, byte(10), op.Contents[3])
+	assert.Exactly(t, byte(0xa0), op.Contents[12])
+
+	outputSessionKey, err := pgp.GetSessionFromSymmetricPacket(keyPacket, password)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting key packet, got:", err)
+	}
+	assert.Exactly(t, sessionKey, outputSessionKey)
+
+	_, err = pgp.SymmetricKeyPacketWithPasswordOptions(sessionKey, password, &S2KOptions{Count: 1000})
+	assert.EqualError(t, err, "gopenpgp: invalid S2K count 1000")
+
+	_, err = pgp.SymmetricKeyPacketWithPasswordOptions(sessionKey, password, &S2KOptions{Count: 1 << 26})
+	assert.EqualError(t, err, "gopenpgp: invalid S2K count 67108864")
+
+	_, err = pgp.SymmetricKeyPacketWithPasswordOptions(sessionKey, password, &S2KOptions{Hash: constants.MD5})
+	assert.EqualError(t, err, "gopenpgp: unsupported S2K hash "+constants.MD5)
+}
+
+func TestDeriveHardenedPassphrase(t *testing.T) {
+	params := &Argon2Params{Time: 1, Memory: 64, Threads: 1, KeyLength: 32}
+	salt := []byte("0123456789abcdef")
+
+	derived, err := DeriveHardenedPassphrase([]byte("password"), salt, params)
+	if err != nil {
+		t.Fatal("Expected no error while deriving passphrase, got:", err)
+	}
+	assert.Len(t, derived, 32)
+
+	again, err := DeriveHardenedPassphrase([]byte("password"), salt, params)
+	if err != nil {
+		t.Fatal("Expected no error while deriving passphrase, got:", err)
+	}
+	assert.Exactly(t, derived, again)
+
+	otherSalt, err := DeriveHardenedPassphrase([]byte("password"), []byte("fedcba9876543210"), params)
+	if err != nil {
+		t.Fatal("Expected no error while deriving passphrase, got:", err)
+	}
+	assert.NotEqual(t, derived, otherSalt)
+
+	password := base64.StdEncoding.EncodeToString(derived)
+	armored, err := pgp.EncryptMessageWithPassword("plain text", password)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting, got:", err)
+	}
+	decrypted, err := pgp.DecryptMessageWithPassword(armored, password)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting, got:", err)
+	}
+	assert.Exactly(t, "plain text", decrypted)
+
+	_, err = DeriveHardenedPassphrase([]byte("password"), salt[:8], params)
+	assert.EqualError(t, err, "gopenpgp: Argon2 salt must be at least 16 bytes long")
+
+	_, err = DeriveHardenedPassphrase([]byte("password"), salt, &Argon2Params{Time: 1, Memory: 4, Threads: 1, KeyLength: 32})
+	assert.EqualError(t, err, "gopenpgp: Argon2 memory must be at least 8 KiB per thread")
+}
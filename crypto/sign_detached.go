@@ -2,11 +2,17 @@ package crypto
 
 import (
 	"bytes"
+	"crypto"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"io"
+	"math"
 	"strings"
 	"time"
 
+	"github.com/ProtonMail/gopenpgp/armor"
+	"github.com/ProtonMail/gopenpgp/constants"
 	"github.com/ProtonMail/gopenpgp/internal"
 
 	"golang.org/x/crypto/openpgp"
@@ -21,7 +27,9 @@ func (kr *KeyRing) SignTextDetached(plainText string, passphrase string, trimNew
 		return "", err
 	}
 
-	config := &packet.Config{DefaultCipher: packet.CipherAES256, Time: pgp.getTimeGenerator()}
+	config := &packet.Config{
+		DefaultCipher: packet.CipherAES256, DefaultHash: pgp.getSignatureHash(), Time: pgp.getTimeGenerator(),
+	}
 
 	if trimNewlines {
 		plainText = internal.TrimNewlines(plainText)
@@ -46,7 +54,9 @@ func (kr *KeyRing) SignBinDetached(plainData []byte, passphrase string) (string,
 		return "", err
 	}
 
-	config := &packet.Config{DefaultCipher: packet.CipherAES256, Time: pgp.getTimeGenerator()}
+	config := &packet.Config{
+		DefaultCipher: packet.CipherAES256, DefaultHash: pgp.getSignatureHash(), Time: pgp.getTimeGenerator(),
+	}
 
 	att := bytes.NewReader(plainData)
 
@@ -59,10 +69,75 @@ func (kr *KeyRing) SignBinDetached(plainData []byte, passphrase string) (string,
 	return outBuf.String(), nil
 }
 
+// SignDetachedArmored creates an armored detached signature of binary data
+// with the keyring's signing subkey, or its primary key if it has none. The
+// keyring must be unlocked, otherwise an error is returned.
+func (kr *KeyRing) SignDetachedArmored(plainData []byte) (string, error) {
+	return kr.SignDetachedStream(bytes.NewReader(plainData))
+}
+
+// SignDetachedStream is like SignDetachedArmored, but signs the data read from
+// dataReader, hashing it as it is read so that large files don't have to be
+// held in memory.
+func (kr *KeyRing) SignDetachedStream(dataReader io.Reader) (string, error) {
+	return kr.signDetached(dataReader, nil)
+}
+
+// SignDetachedWithLifetime is like SignDetachedArmored, but the signature
+// expires lifetime seconds after its creation, e.g. for a signed token valid for
+// a day. Verifying it later fails with errors.ErrSignatureExpired (from
+// golang.org/x/crypto/openpgp/errors) rather than a bad signature error.
+func (kr *KeyRing) SignDetachedWithLifetime(plainData []byte, lifetime int64) (string, error) {
+	if lifetime <= 0 || lifetime > math.MaxUint32 {
+		return "", fmt.Errorf("gopenpgp: invalid signature lifetime %d", lifetime)
+	}
+	lifetimeSecs := uint32(lifetime)
+	return kr.signDetached(bytes.NewReader(plainData), &lifetimeSecs)
+}
+
+// signDetached creates an armored detached signature of the data read from
+// dataReader, expiring after lifetimeSecs if it isn't nil.
+func (kr *KeyRing) signDetached(dataReader io.Reader, lifetimeSecs *uint32) (string, error) {
+	config := &packet.Config{
+		DefaultCipher: packet.CipherAES256, DefaultHash: pgp.getSignatureHash(), Time: pgp.getTimeGenerator(),
+	}
+
+	signingKey, err := kr.getSigningKey(config.Now())
+	if err != nil {
+		return "", err
+	}
+
+	sig := &packet.Signature{
+		SigType:         packet.SigTypeBinary,
+		PubKeyAlgo:      signingKey.PubKeyAlgo,
+		Hash:            config.Hash(),
+		CreationTime:    config.Now(),
+		SigLifetimeSecs: lifetimeSecs,
+		IssuerKeyId:     &signingKey.KeyId,
+	}
+
+	h := sig.Hash.New()
+	if _, err = io.Copy(h, dataReader); err != nil {
+		return "", err
+	}
+	if err = sig.Sign(h, signingKey, config); err != nil {
+		return "", err
+	}
+
+	var outBuf bytes.Buffer
+	if err = sig.Serialize(&outBuf); err != nil {
+		return "", err
+	}
+
+	return armor.ArmorWithType(outBuf.Bytes(), constants.PGPSignatureHeader)
+}
+
 // VerifyTextDetachedSig verifies an armored detached signature given the plaintext as a string.
 func (kr *KeyRing) VerifyTextDetachedSig(
 	signature string, plainText string, verifyTime int64, trimNewlines bool,
-) (bool, error) {
+) (verified bool, err error) {
+	defer recoverMalformedInput(&err)
+
 	if trimNewlines {
 		plainText = internal.TrimNewlines(plainText)
 	}
@@ -72,27 +147,319 @@ func (kr *KeyRing) VerifyTextDetachedSig(
 }
 
 // VerifyBinDetachedSig verifies an armored detached signature given the plaintext as binary data.
-func (kr *KeyRing) VerifyBinDetachedSig(signature string, plainData []byte, verifyTime int64) (bool, error) {
+func (kr *KeyRing) VerifyBinDetachedSig(
+	signature string, plainData []byte, verifyTime int64,
+) (verified bool, err error) {
+	defer recoverMalformedInput(&err)
+
 	origText := bytes.NewReader(plainData)
 
 	return verifySignature(kr.GetEntities(), origText, signature, verifyTime)
 }
 
+// SignatureInfo contains details about a verified detached signature.
+type SignatureInfo struct {
+	// KeyID is the ID of the key that made the signature.
+	KeyID uint64
+	// Fingerprint is the hex fingerprint of the key that made the signature.
+	Fingerprint string
+	// Hash is the name of the hash algorithm used, e.g. constants.SHA256.
+	Hash string
+	// CreationTime is the signature creation time as a unix timestamp.
+	CreationTime int64
+	// ExpirationTime is the time the signature expires as a unix timestamp, or
+	// 0 if it doesn't expire.
+	ExpirationTime int64
+	// Notations are the notations of the hashed area of the signature, see
+	// SignDetachedWithNotations. Signatures with critical notations fail to
+	// verify.
+	Notations []*Notation
+}
+
+var hashAlgos = map[crypto.Hash]string{
+	crypto.MD5:       constants.MD5,
+	crypto.SHA1:      constants.SHA1,
+	crypto.RIPEMD160: constants.RIPEMD160,
+	crypto.SHA224:    constants.SHA224,
+	crypto.SHA256:    constants.SHA256,
+	crypto.SHA384:    constants.SHA384,
+	crypto.SHA512:    constants.SHA512,
+}
+
+// signatureHashes are the hash algorithms SetSignatureHash accepts.
+var signatureHashes = map[string]crypto.Hash{
+	constants.SHA1:   crypto.SHA1,
+	constants.SHA224: crypto.SHA224,
+	constants.SHA256: crypto.SHA256,
+	constants.SHA384: crypto.SHA384,
+	constants.SHA512: crypto.SHA512,
+}
+
+// SetSignatureHash sets the hash algorithm used by new signatures, e.g.
+// constants.SHA512. The default is constants.SHA256. When encrypting and
+// signing, the hash is only used if the recipients' keys accept it.
+//
+// Warning: constants.SHA1 is only accepted for interoperability with legacy
+// clients. SHA-1 is not collision resistant and signatures made with it can be
+// forged.
+func (pgp *GopenPGP) SetSignatureHash(hash string) error {
+	h, ok := signatureHashes[hash]
+	if !ok {
+		return errors.New("gopenpgp: unsupported signature hash algorithm: " + hash)
+	}
+	pgp.signatureHash = h
+	return nil
+}
+
+// GetSignatureHash returns the name of the hash algorithm used by new
+// signatures.
+func (pgp *GopenPGP) GetSignatureHash() string {
+	return hashAlgos[pgp.getSignatureHash()]
+}
+
+func (pgp *GopenPGP) getSignatureHash() crypto.Hash {
+	if pgp.signatureHash == 0 {
+		return crypto.SHA256
+	}
+	return pgp.signatureHash
+}
+
+// SignatureResult is the verification result of one of several detached
+// signatures, see VerifyBinDetachedSigs.
+type SignatureResult struct {
+	// Info describes the signature, it is nil if the signature can't be parsed.
+	// Its Fingerprint is only set if the signature is valid.
+	Info *SignatureInfo
+	// Err is nil if the signature is valid, otherwise it is the error
+	// VerifyBinDetachedSigWithInfo would return for this signature alone.
+	Err error
+}
+
+// VerifyBinDetachedSigs verifies every signature of an armored blob holding
+// several concatenated detached signatures, e.g. by several signers, given the
+// plaintext as binary data. A result is returned for each signature, in order.
+// An error is only returned if the blob can't be read.
+func (kr *KeyRing) VerifyBinDetachedSigs(
+	signature string, plainData []byte, verifyTime int64,
+) (results []SignatureResult, err error) {
+	defer recoverMalformedInput(&err)
+
+	rawSignature, err := armor.Unarmor(signature)
+	if err != nil {
+		return nil, err
+	}
+
+	packets := packet.NewOpaqueReader(bytes.NewReader(rawSignature))
+	for {
+		op, err := packets.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("gopenpgp: cannot read signature packets: %v", err)
+		}
+		if op.Tag != signatureTag {
+			return nil, fmt.Errorf("gopenpgp: unexpected packet with tag %d in signature", op.Tag)
+		}
+
+		var b bytes.Buffer
+		if err = op.Serialize(&b); err != nil {
+			return nil, err
+		}
+		single, err := armor.ArmorWithType(b.Bytes(), constants.PGPSignatureHeader)
+		if err != nil {
+			return nil, err
+		}
+
+		result := SignatureResult{}
+		if result.Info, result.Err = readSignatureInfo(single); result.Err == nil {
+			var info *SignatureInfo
+			if info, result.Err = kr.VerifyBinDetachedSigWithInfo(single, plainData, verifyTime); info != nil {
+				result.Info = info
+			}
+		}
+		results = append(results, result)
+	}
+
+	if len(results) == 0 {
+		return nil, errors.New("gopenpgp: no signature found")
+	}
+	return results, nil
+}
+
+// errUnknownSigner is returned when a signature was made by a key that isn't in
+// the verifier keyring.
+var errUnknownSigner = newCryptoError(
+	constants.ErrorCodeBadSignature, "gopenpgp: signature is not made by any key of the verifier keyring",
+)
+
+// VerifyBinDetachedSigWithInfo verifies an armored detached signature given
+// the plaintext as binary data, and returns details about the signature.
+// The keyring can contain several candidate signer keys, the Fingerprint of the
+// returned info tells which one made the signature.
+// If error is errors.ErrSignatureExpired (from golang.org/x/crypto/openpgp/errors),
+// the signature is cryptographically valid but expired, and its details are
+// still returned. Any other error means the signature is invalid.
+func (kr *KeyRing) VerifyBinDetachedSigWithInfo(
+	signature string, plainData []byte, verifyTime int64,
+) (info *SignatureInfo, err error) {
+	defer recoverMalformedInput(&err)
+
+	info, err = readSignatureInfo(signature)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := checkSignature(kr.GetEntities(), bytes.NewReader(plainData), signature, verifyTime)
+	if err == errorsPGP.ErrUnknownIssuer {
+		return nil, errUnknownSigner
+	}
+	if err != nil && err != errorsPGP.ErrSignatureExpired {
+		return nil, newBadSignatureError(err)
+	}
+	if signer == nil {
+		return nil, errSignerEmpty
+	}
+
+	if keys := openpgp.EntityList([]*openpgp.Entity{signer}).KeysById(info.KeyID); len(keys) > 0 {
+		info.Fingerprint = hex.EncodeToString(keys[0].PublicKey.Fingerprint[:])
+	}
+
+	return info, err
+}
+
+// GetSignatureCreationTime returns the creation time of an armored detached
+// signature as a unix timestamp. The signature is not verified.
+func GetSignatureCreationTime(signature string) (int64, error) {
+	info, err := readSignatureInfo(signature)
+	if err != nil {
+		return 0, err
+	}
+	return info.CreationTime, nil
+}
+
+// GetSignatureKeyID returns the ID of the key that made an armored detached
+// signature, to find the key it should be verified with. The signature is not
+// verified.
+func GetSignatureKeyID(signature string) (uint64, error) {
+	info, err := readSignatureInfo(signature)
+	if err != nil {
+		return 0, err
+	}
+	return info.KeyID, nil
+}
+
+// VerifyDetachedStream verifies an armored detached signature over the data
+// read from dataReader, for data too large to be held in memory. The data is
+// hashed as it is read, in a single pass, and the signature is checked once
+// dataReader returns EOF. If the signature isn't made by a key of kr, nothing
+// is read. Errors are reported like in VerifyBinDetachedSigWithInfo.
+func (kr *KeyRing) VerifyDetachedStream(dataReader io.Reader, signature string, verifyTime int64) (err error) {
+	defer recoverMalformedInput(&err)
+
+	config := getVerifyConfig(verifyTime, internal.CreationTimeOffset)
+	signer, err := openpgp.CheckArmoredDetachedSignature(kr.GetEntities(), dataReader, strings.NewReader(signature), config)
+	if err == errorsPGP.ErrSignatureExpired && signer != nil {
+		if verifyTime == 0 { // time check disabled
+			return nil
+		}
+		// Maybe the creation time offset pushed it over the edge. The data
+		// can't be read again, but the signature is valid, so only check the
+		// expiration at the actual verification time.
+		p, err := readSignaturePacket(signature)
+		if err != nil {
+			return err
+		}
+		if sig, ok := p.(*packet.Signature); ok && !sig.SigExpired(time.Unix(verifyTime, 0)) {
+			return nil
+		}
+		return errorsPGP.ErrSignatureExpired
+	}
+	if err == errorsPGP.ErrUnknownIssuer {
+		return errUnknownSigner
+	}
+	if err != nil {
+		return newBadSignatureError(err)
+	}
+	if signer == nil {
+		return errSignerEmpty
+	}
+	return nil
+}
+
 // Internal
+func readSignatureInfo(signature string) (*SignatureInfo, error) {
+	p, err := readSignaturePacket(signature)
+	if err != nil {
+		return nil, err
+	}
+
+	switch sig := p.(type) {
+	case *packet.Signature:
+		if sig.IssuerKeyId == nil {
+			return nil, errors.New("gopenpgp: signature doesn't have an issuer")
+		}
+		notations, err := readNotations(signature)
+		if err != nil {
+			return nil, err
+		}
+		info := &SignatureInfo{
+			KeyID:        *sig.IssuerKeyId,
+			Hash:         hashAlgos[sig.Hash],
+			CreationTime: sig.CreationTime.Unix(),
+			Notations:    notations,
+		}
+		if sig.SigLifetimeSecs != nil && *sig.SigLifetimeSecs != 0 {
+			info.ExpirationTime = info.CreationTime + int64(*sig.SigLifetimeSecs)
+		}
+		return info, nil
+	case *packet.SignatureV3:
+		return &SignatureInfo{
+			KeyID:        sig.IssuerKeyId,
+			Hash:         hashAlgos[sig.Hash],
+			CreationTime: sig.CreationTime.Unix(),
+		}, nil
+	default:
+		return nil, errors.New("gopenpgp: not a signature packet")
+	}
+}
+
+// readSignaturePacket reads the first packet of an armored signature.
+func readSignaturePacket(signature string) (packet.Packet, error) {
+	block, err := internal.Unarmor(signature)
+	if err != nil {
+		return nil, err
+	}
+	return packet.Read(block.Body)
+}
+
 func verifySignature(
 	pubKeyEntries openpgp.EntityList, origText *bytes.Reader,
 	signature string, verifyTime int64,
 ) (bool, error) {
-	config := &packet.Config{}
-	if verifyTime == 0 {
-		config.Time = func() time.Time {
-			return time.Unix(0, 0)
-		}
-	} else {
-		config.Time = func() time.Time {
-			return time.Unix(verifyTime+internal.CreationTimeOffset, 0)
-		}
+	signer, err := checkSignature(pubKeyEntries, origText, signature, verifyTime)
+	if err == errorsPGP.ErrSignatureExpired {
+		return false, err
+	}
+
+	if signer == nil {
+		return false, errSignerEmpty
 	}
+	// if signer.PrimaryKey.KeyId != signed.PrimaryKey.KeyId {
+	// 	// t.Errorf("wrong signer got:%x want:%x", signer.PrimaryKey.KeyId, 0)
+	// 	return false, errors.New("signer is nil")
+	// }
+	return true, nil
+}
+
+// checkSignature checks an armored detached signature against pubKeyEntries.
+// An expired signature returns its signer along with errors.ErrSignatureExpired,
+// unless verifyTime is 0.
+func checkSignature(
+	pubKeyEntries openpgp.EntityList, origText *bytes.Reader,
+	signature string, verifyTime int64,
+) (*openpgp.Entity, error) {
+	config := getVerifyConfig(verifyTime, internal.CreationTimeOffset)
 	signatureReader := strings.NewReader(signature)
 
 	signer, err := openpgp.CheckArmoredDetachedSignature(pubKeyEntries, origText, signatureReader, config)
@@ -101,28 +468,37 @@ func verifySignature(
 		if verifyTime > 0 { // if verifyTime = 0: time check disabled, everything is okay
 			// Maybe the creation time offset pushed it over the edge
 			// Retry with the actual verification time
-			config.Time = func() time.Time {
-				return time.Unix(verifyTime, 0)
-			}
+			config = getVerifyConfig(verifyTime, 0)
 
 			_, err = signatureReader.Seek(0, io.SeekStart)
 			if err != nil {
-				return false, err
+				return nil, err
 			}
 
-			signer, err = openpgp.CheckArmoredDetachedSignature(pubKeyEntries, origText, signatureReader, config)
-			if err != nil {
-				return false, err
+			if _, err = origText.Seek(0, io.SeekStart); err != nil {
+				return nil, err
 			}
+
+			return openpgp.CheckArmoredDetachedSignature(pubKeyEntries, origText, signatureReader, config)
 		}
+		return signer, nil
 	}
 
-	if signer == nil {
-		return false, errors.New("gopenpgp: signer is empty")
+	return signer, err
+}
+
+// getVerifyConfig returns a config that checks signature expiration at
+// verifyTime plus offset, or disables the check if verifyTime is 0.
+func getVerifyConfig(verifyTime, offset int64) *packet.Config {
+	config := &packet.Config{}
+	if verifyTime == 0 {
+		config.Time = func() time.Time {
+			return time.Unix(0, 0)
+		}
+	} else {
+		config.Time = func() time.Time {
+			return time.Unix(verifyTime+offset, 0)
+		}
 	}
-	// if signer.PrimaryKey.KeyId != signed.PrimaryKey.KeyId {
-	// 	// t.Errorf("wrong signer got:%x want:%x", signer.PrimaryKey.KeyId, 0)
-	// 	return false, errors.New("signer is nil")
-	// }
-	return true, nil
+	return config
 }
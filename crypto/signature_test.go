@@ -1,11 +1,21 @@
 package crypto
 
 import (
+	"bytes"
+	"crypto"
+	"io"
+	"io/ioutil"
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/ProtonMail/gopenpgp/armor"
+	"github.com/ProtonMail/gopenpgp/constants"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/openpgp"
+	errorsPGP "golang.org/x/crypto/openpgp/errors"
+	"golang.org/x/crypto/openpgp/packet"
 )
 
 const signedPlainText = "Signed message"
@@ -89,3 +99,508 @@ func TestVerifyBinDetachedSig(t *testing.T) {
 
 	assert.Exactly(t, true, verified)
 }
+
+func TestSignDetachedArmored(t *testing.T) {
+	lockedKeyRing, err := ReadArmoredKeyRing(strings.NewReader(readTestFile("keyring_privateKey", false)))
+	if err != nil {
+		t.Fatal("Cannot read private key:", err)
+	}
+
+	_, err = lockedKeyRing.SignDetachedArmored([]byte(signedPlainText))
+	assert.EqualError(t, err, "gopenpgp: cannot sign message, key ring is not unlocked")
+
+	publicKeyRing, err := ReadArmoredKeyRing(strings.NewReader(readTestFile("keyring_publicKey", false)))
+	if err != nil {
+		t.Fatal("Cannot read public key:", err)
+	}
+
+	_, err = publicKeyRing.SignDetachedArmored([]byte(signedPlainText))
+	assert.EqualError(t, err, "gopenpgp: cannot sign message, no signing key found")
+
+	pgp.UpdateTime(testTime)
+
+	armoredSignature, err := signingKeyRing.SignDetachedArmored([]byte(signedPlainText))
+	if err != nil {
+		t.Fatal("Expected no error while signing with unlocked key, got:", err)
+	}
+
+	rTest := regexp.MustCompile("(?s)^-----BEGIN PGP SIGNATURE-----.*-----END PGP SIGNATURE-----$")
+	assert.Regexp(t, rTest, armoredSignature)
+
+	rawSignature, err := armor.Unarmor(armoredSignature)
+	if err != nil {
+		t.Fatal("Expected no error while unarmoring signature, got:", err)
+	}
+
+	p, err := packet.Read(bytes.NewReader(rawSignature))
+	if err != nil {
+		t.Fatal("Expected no error while reading signature packet, got:", err)
+	}
+
+	sig, ok := p.(*packet.Signature)
+	if !ok {
+		t.Fatal("Expected a signature packet")
+	}
+	assert.Exactly(t, int64(testTime), sig.CreationTime.Unix())
+
+	verified, err := signingKeyRing.VerifyBinDetachedSig(armoredSignature, []byte(signedPlainText), testTime)
+	if err != nil {
+		t.Fatal("Expected no error while verifying signature, got:", err)
+	}
+	assert.Exactly(t, true, verified)
+}
+
+func TestVerifyBinDetachedSigWithInfo(t *testing.T) {
+	info, err := signingKeyRing.VerifyBinDetachedSigWithInfo(signatureBin, []byte(signedPlainText), testTime)
+	if err != nil {
+		t.Fatal("Expected no error while verifying signature, got:", err)
+	}
+
+	assert.Exactly(t, signingKeyRing.GetEntities()[0].PrimaryKey.KeyId, info.KeyID)
+	assert.Exactly(t, "6e8ba229b0cccaf6962f97953eb6259edf21df24", info.Fingerprint)
+	assert.Exactly(t, constants.SHA256, info.Hash)
+	assert.NotZero(t, info.CreationTime)
+
+	_, err = signingKeyRing.VerifyBinDetachedSigWithInfo(signatureBin, []byte("wrong data"), testTime)
+	assert.Error(t, err)
+	assert.NotEqual(t, errorsPGP.ErrSignatureExpired, err)
+
+	privateKey := signingKeyRing.GetEntities()[0].PrivateKey
+	lifetime := uint32(60)
+	sig := &packet.Signature{
+		SigType:         packet.SigTypeBinary,
+		PubKeyAlgo:      privateKey.PubKeyAlgo,
+		Hash:            crypto.SHA256,
+		CreationTime:    time.Unix(testTime, 0),
+		SigLifetimeSecs: &lifetime,
+		IssuerKeyId:     &privateKey.KeyId,
+	}
+
+	h := sig.Hash.New()
+	h.Write([]byte(signedPlainText))
+	if err = sig.Sign(h, privateKey, nil); err != nil {
+		t.Fatal("Expected no error while signing, got:", err)
+	}
+
+	var rawSignature bytes.Buffer
+	if err = sig.Serialize(&rawSignature); err != nil {
+		t.Fatal("Expected no error while serializing signature, got:", err)
+	}
+
+	expiredSignature, err := armor.ArmorWithType(rawSignature.Bytes(), constants.PGPSignatureHeader)
+	if err != nil {
+		t.Fatal("Expected no error while armoring signature, got:", err)
+	}
+
+	info, err = signingKeyRing.VerifyBinDetachedSigWithInfo(expiredSignature, []byte(signedPlainText), testTime+3600)
+	assert.Exactly(t, errorsPGP.ErrSignatureExpired, err)
+	assert.Exactly(t, int64(testTime), info.CreationTime)
+	assert.Exactly(t, "6e8ba229b0cccaf6962f97953eb6259edf21df24", info.Fingerprint)
+}
+
+func TestSignDetachedWithLifetime(t *testing.T) {
+	pgp.UpdateTime(testTime)
+
+	armoredSignature, err := signingKeyRing.SignDetachedWithLifetime([]byte(signedPlainText), 24*3600)
+	if err != nil {
+		t.Fatal("Expected no error while signing, got:", err)
+	}
+
+	info, err := signingKeyRing.VerifyBinDetachedSigWithInfo(armoredSignature, []byte(signedPlainText), testTime+3600)
+	if err != nil {
+		t.Fatal("Expected no error while verifying signature, got:", err)
+	}
+	assert.Exactly(t, int64(testTime), info.CreationTime)
+	assert.Exactly(t, int64(testTime+24*3600), info.ExpirationTime)
+
+	info, err = signingKeyRing.VerifyBinDetachedSigWithInfo(armoredSignature, []byte(signedPlainText), testTime+25*3600)
+	assert.Exactly(t, errorsPGP.ErrSignatureExpired, err)
+	assert.Exactly(t, int64(testTime+24*3600), info.ExpirationTime)
+
+	_, err = signingKeyRing.VerifyBinDetachedSig(armoredSignature, []byte(signedPlainText), testTime+25*3600)
+	assert.Exactly(t, errorsPGP.ErrSignatureExpired, err)
+
+	_, err = signingKeyRing.VerifyBinDetachedSigWithInfo(armoredSignature, []byte("wrong data"), testTime+3600)
+	assert.NotEqual(t, errorsPGP.ErrSignatureExpired, err)
+
+	info, err = signingKeyRing.VerifyBinDetachedSigWithInfo(signatureBin, []byte(signedPlainText), testTime)
+	if err != nil {
+		t.Fatal("Expected no error while verifying signature, got:", err)
+	}
+	assert.Zero(t, info.ExpirationTime)
+
+	_, err = signingKeyRing.SignDetachedWithLifetime([]byte(signedPlainText), 0)
+	assert.EqualError(t, err, "gopenpgp: invalid signature lifetime 0")
+}
+
+func TestSignDetachedWithNotations(t *testing.T) {
+	notations := []*Notation{
+		{Name: "issuer@example.com", Value: []byte("12345"), HumanReadable: true},
+		{Name: "data@example.com", Value: []byte{0x00, 0xff}},
+	}
+	armoredSignature, err := signingKeyRing.SignDetachedWithNotations([]byte(signedPlainText), notations)
+	if err != nil {
+		t.Fatal("Expected no error while signing, got:", err)
+	}
+
+	info, err := signingKeyRing.VerifyBinDetachedSigWithInfo(armoredSignature, []byte(signedPlainText), testTime)
+	if err != nil {
+		t.Fatal("Expected no error while verifying signature, got:", err)
+	}
+	assert.Exactly(t, notations, info.Notations)
+	assert.Exactly(t, "6e8ba229b0cccaf6962f97953eb6259edf21df24", info.Fingerprint)
+	assert.Exactly(t, constants.SHA256, info.Hash)
+
+	// Unknown notations that aren't critical are ignored by the crypto library
+	verified, err := signingKeyRing.VerifyBinDetachedSig(armoredSignature, []byte(signedPlainText), testTime)
+	if err != nil {
+		t.Fatal("Expected no error while verifying signature, got:", err)
+	}
+	assert.True(t, verified)
+	assert.NoError(t, signingKeyRing.VerifyDetachedStream(strings.NewReader(signedPlainText), armoredSignature, testTime))
+
+	_, err = signingKeyRing.VerifyBinDetachedSigWithInfo(armoredSignature, []byte("wrong data"), testTime)
+	assert.Error(t, err)
+
+	info, err = signingKeyRing.VerifyBinDetachedSigWithInfo(signatureBin, []byte(signedPlainText), testTime)
+	if err != nil {
+		t.Fatal("Expected no error while verifying signature, got:", err)
+	}
+	assert.Empty(t, info.Notations)
+
+	critical := []*Notation{{Name: "unknown@example.com", Value: []byte("x"), HumanReadable: true, Critical: true}}
+	armoredSignature, err = signingKeyRing.SignDetachedWithNotations([]byte(signedPlainText), critical)
+	if err != nil {
+		t.Fatal("Expected no error while signing, got:", err)
+	}
+	_, err = signingKeyRing.VerifyBinDetachedSigWithInfo(armoredSignature, []byte(signedPlainText), testTime)
+	assert.Error(t, err)
+	_, err = signingKeyRing.VerifyBinDetachedSig(armoredSignature, []byte(signedPlainText), testTime)
+	assert.Error(t, err)
+	assert.Error(t, signingKeyRing.VerifyDetachedStream(strings.NewReader(signedPlainText), armoredSignature, testTime))
+	_, err = openpgp.CheckArmoredDetachedSignature(
+		signingKeyRing.GetEntities(), strings.NewReader(signedPlainText), strings.NewReader(armoredSignature), nil,
+	)
+	assert.IsType(t, errorsPGP.UnsupportedError(""), err)
+
+	_, err = signingKeyRing.SignDetachedWithNotations([]byte(signedPlainText), []*Notation{{Value: []byte("x")}})
+	assert.EqualError(t, err, "gopenpgp: notation name can't be empty")
+
+	if err = pgp.SetSignatureHash(constants.SHA512); err != nil {
+		t.Fatal("Expected no error while setting signature hash, got:", err)
+	}
+	defer pgp.SetSignatureHash(constants.SHA256)
+	armoredSignature, err = signingKeyRing.SignDetachedWithNotations([]byte(signedPlainText), notations)
+	if err != nil {
+		t.Fatal("Expected no error while signing, got:", err)
+	}
+	info, err = signingKeyRing.VerifyBinDetachedSigWithInfo(armoredSignature, []byte(signedPlainText), testTime)
+	if err != nil {
+		t.Fatal("Expected no error while verifying signature, got:", err)
+	}
+	assert.Exactly(t, constants.SHA512, info.Hash)
+	assert.Exactly(t, notations, info.Notations)
+}
+
+func TestSignDetachedStream(t *testing.T) {
+	var data = strings.Repeat(signedPlainText, 1000)
+
+	lockedKeyRing, err := ReadArmoredKeyRing(strings.NewReader(readTestFile("keyring_privateKey", false)))
+	if err != nil {
+		t.Fatal("Cannot read private key:", err)
+	}
+	_, err = lockedKeyRing.SignDetachedStream(strings.NewReader(data))
+	assert.EqualError(t, err, "gopenpgp: cannot sign message, key ring is not unlocked")
+
+	armoredSignature, err := signingKeyRing.SignDetachedStream(strings.NewReader(data))
+	if err != nil {
+		t.Fatal("Expected no error while signing stream, got:", err)
+	}
+
+	verified, err := signingKeyRing.VerifyBinDetachedSig(armoredSignature, []byte(data), testTime)
+	if err != nil {
+		t.Fatal("Expected no error while verifying signature, got:", err)
+	}
+	assert.Exactly(t, true, verified)
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (r *countingReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	r.n += n
+	return n, err
+}
+
+func TestVerifyDetachedStream(t *testing.T) {
+	dataReader := &countingReader{r: strings.NewReader(signedPlainText)}
+	if err := signingKeyRing.VerifyDetachedStream(dataReader, signatureBin, testTime); err != nil {
+		t.Fatal("Expected no error while verifying signature, got:", err)
+	}
+	assert.Exactly(t, len(signedPlainText), dataReader.n)
+
+	err := signingKeyRing.VerifyDetachedStream(strings.NewReader("wrong data"), signatureBin, testTime)
+	assert.Exactly(t, constants.ErrorCodeBadSignature, GetErrorCode(err))
+
+	privateKey := signingKeyRing.GetEntities()[0].PrivateKey
+	lifetime := uint32(60)
+	sig := &packet.Signature{
+		SigType:         packet.SigTypeBinary,
+		PubKeyAlgo:      privateKey.PubKeyAlgo,
+		Hash:            crypto.SHA256,
+		CreationTime:    time.Unix(testTime, 0),
+		SigLifetimeSecs: &lifetime,
+		IssuerKeyId:     &privateKey.KeyId,
+	}
+	h := sig.Hash.New()
+	h.Write([]byte(signedPlainText))
+	if err = sig.Sign(h, privateKey, nil); err != nil {
+		t.Fatal("Expected no error while signing, got:", err)
+	}
+	var rawSignature bytes.Buffer
+	if err = sig.Serialize(&rawSignature); err != nil {
+		t.Fatal("Expected no error while serializing signature, got:", err)
+	}
+	expiringSignature, err := armor.ArmorWithType(rawSignature.Bytes(), constants.PGPSignatureHeader)
+	if err != nil {
+		t.Fatal("Expected no error while armoring signature, got:", err)
+	}
+
+	// Expired with the creation time offset, but not at the verification time
+	err = signingKeyRing.VerifyDetachedStream(strings.NewReader(signedPlainText), expiringSignature, testTime+30)
+	assert.NoError(t, err)
+
+	err = signingKeyRing.VerifyDetachedStream(strings.NewReader(signedPlainText), expiringSignature, testTime+3600)
+	assert.Exactly(t, errorsPGP.ErrSignatureExpired, err)
+}
+
+func TestVerifyBinDetachedSigMultipleKeys(t *testing.T) {
+	otherKey := generateTestKey(t, "other")
+	otherKeyRing, err := ReadArmoredKeyRing(strings.NewReader(otherKey))
+	if err != nil {
+		t.Fatal("Expected no error while reading key, got:", err)
+	}
+
+	candidates := &KeyRing{}
+	candidates.entities = append(candidates.entities, otherKeyRing.GetEntities()...)
+	candidates.entities = append(candidates.entities, signingKeyRing.GetEntities()...)
+
+	info, err := candidates.VerifyBinDetachedSigWithInfo(signatureBin, []byte(signedPlainText), testTime)
+	if err != nil {
+		t.Fatal("Expected no error while verifying signature, got:", err)
+	}
+	assert.Exactly(t, "6e8ba229b0cccaf6962f97953eb6259edf21df24", info.Fingerprint)
+
+	_, err = otherKeyRing.VerifyBinDetachedSigWithInfo(signatureBin, []byte(signedPlainText), testTime)
+	assert.EqualError(t, err, "gopenpgp: signature is not made by any key of the verifier keyring")
+	assert.Exactly(t, constants.ErrorCodeBadSignature, GetErrorCode(err))
+}
+
+func TestVerifyBinDetachedSigs(t *testing.T) {
+	otherKey := generateTestKey(t, "other")
+	otherKeyRing, err := ReadArmoredKeyRing(strings.NewReader(otherKey))
+	if err != nil {
+		t.Fatal("Expected no error while reading key, got:", err)
+	}
+	otherSignature, err := otherKeyRing.SignBinDetached([]byte(signedPlainText), "other")
+	if err != nil {
+		t.Fatal("Expected no error while signing, got:", err)
+	}
+
+	var blob []byte
+	for _, sig := range []string{signatureBin, otherSignature} {
+		raw, err := armor.Unarmor(sig)
+		if err != nil {
+			t.Fatal("Expected no error while unarmoring signature, got:", err)
+		}
+		blob = append(blob, raw...)
+	}
+	armoredBlob, err := armor.ArmorWithType(blob, constants.PGPSignatureHeader)
+	if err != nil {
+		t.Fatal("Expected no error while armoring signatures, got:", err)
+	}
+
+	results, err := signingKeyRing.VerifyBinDetachedSigs(armoredBlob, []byte(signedPlainText), testTime)
+	if err != nil {
+		t.Fatal("Expected no error while verifying signatures, got:", err)
+	}
+	assert.Len(t, results, 2)
+	assert.NoError(t, results[0].Err)
+	assert.Exactly(t, "6e8ba229b0cccaf6962f97953eb6259edf21df24", results[0].Info.Fingerprint)
+	assert.Exactly(t, errUnknownSigner, results[1].Err)
+	assert.Exactly(t, otherKeyRing.GetEntities()[0].PrimaryKey.KeyId, results[1].Info.KeyID)
+
+	candidates := &KeyRing{}
+	candidates.entities = append(candidates.entities, signingKeyRing.GetEntities()...)
+	candidates.entities = append(candidates.entities, otherKeyRing.GetEntities()...)
+
+	results, err = candidates.VerifyBinDetachedSigs(armoredBlob, []byte(signedPlainText), testTime)
+	if err != nil {
+		t.Fatal("Expected no error while verifying signatures, got:", err)
+	}
+	assert.NoError(t, results[0].Err)
+	assert.NoError(t, results[1].Err)
+
+	results, err = candidates.VerifyBinDetachedSigs(armoredBlob, []byte("wrong data"), testTime)
+	if err != nil {
+		t.Fatal("Expected no error while verifying signatures, got:", err)
+	}
+	assert.Exactly(t, constants.ErrorCodeBadSignature, GetErrorCode(results[0].Err))
+	assert.Exactly(t, constants.ErrorCodeBadSignature, GetErrorCode(results[1].Err))
+}
+
+func TestGetSignatureInfoUnverified(t *testing.T) {
+	keyID, err := GetSignatureKeyID(signatureBin)
+	if err != nil {
+		t.Fatal("Expected no error while reading signature key ID, got:", err)
+	}
+	assert.Exactly(t, signingKeyRing.GetEntities()[0].PrimaryKey.KeyId, keyID)
+
+	creationTime, err := GetSignatureCreationTime(signatureBin)
+	if err != nil {
+		t.Fatal("Expected no error while reading signature creation time, got:", err)
+	}
+	info, err := signingKeyRing.VerifyBinDetachedSigWithInfo(signatureBin, []byte(signedPlainText), testTime)
+	if err != nil {
+		t.Fatal("Expected no error while verifying signature, got:", err)
+	}
+	assert.Exactly(t, info.CreationTime, creationTime)
+
+	_, err = GetSignatureKeyID(readTestFile("keyring_publicKey", false))
+	assert.EqualError(t, err, "gopenpgp: not a signature packet")
+}
+
+func TestSetTimeFunc(t *testing.T) {
+	frozen := time.Unix(1600000000, 0)
+	pgp.SetTimeFunc(func() time.Time { return frozen })
+	defer pgp.SetTimeFunc(nil)
+
+	assert.Exactly(t, frozen.Unix(), pgp.GetTimeUnix())
+
+	armoredSignature, err := signingKeyRing.SignDetachedArmored([]byte(signedPlainText))
+	if err != nil {
+		t.Fatal("Expected no error while signing, got:", err)
+	}
+
+	info, err := signingKeyRing.VerifyBinDetachedSigWithInfo(armoredSignature, []byte(signedPlainText), frozen.Unix())
+	if err != nil {
+		t.Fatal("Expected no error while verifying signature, got:", err)
+	}
+	assert.Exactly(t, frozen.Unix(), info.CreationTime)
+
+	pgp.SetTimeFunc(nil)
+	assert.NotEqual(t, frozen.Unix(), pgp.GetTimeUnix())
+}
+
+func TestSetSignatureHash(t *testing.T) {
+	assert.Exactly(t, constants.SHA256, pgp.GetSignatureHash())
+	assert.EqualError(t, pgp.SetSignatureHash(constants.MD5), "gopenpgp: unsupported signature hash algorithm: md5")
+
+	if err := pgp.SetSignatureHash(constants.SHA512); err != nil {
+		t.Fatal("Expected no error while setting signature hash, got:", err)
+	}
+	defer pgp.SetSignatureHash(constants.SHA256)
+	assert.Exactly(t, constants.SHA512, pgp.GetSignatureHash())
+
+	armoredSignature, err := signingKeyRing.SignDetachedArmored([]byte(signedPlainText))
+	if err != nil {
+		t.Fatal("Expected no error while signing, got:", err)
+	}
+	info, err := signingKeyRing.VerifyBinDetachedSigWithInfo(armoredSignature, []byte(signedPlainText), 0)
+	if err != nil {
+		t.Fatal("Expected no error while verifying signature, got:", err)
+	}
+	assert.Exactly(t, constants.SHA512, info.Hash)
+
+	cleartext, err := signingKeyRing.SignCleartext(signedPlainText)
+	if err != nil {
+		t.Fatal("Expected no error while signing cleartext, got:", err)
+	}
+	assert.Contains(t, cleartext, "Hash: SHA512")
+
+	encrypted, err := pgp.EncryptMessage(signedPlainText, testPublicKeyRing, testPrivateKeyRing, testMailboxPassword, false)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting, got:", err)
+	}
+	md, err := pgp.decryptCore(encrypted, nil, testPrivateKeyRing, testMailboxPassword, pgp.getTimeGenerator())
+	if err != nil {
+		t.Fatal("Expected no error while decrypting, got:", err)
+	}
+	if _, err = ioutil.ReadAll(md.UnverifiedBody); err != nil {
+		t.Fatal("Expected no error while reading message, got:", err)
+	}
+	assert.Exactly(t, crypto.SHA512, md.Signature.Hash)
+
+	keyRing, err := ReadArmoredKeyRing(strings.NewReader(readTestFile("keyring_privateKey", false)))
+	if err != nil {
+		t.Fatal("Expected no error while reading key, got:", err)
+	}
+	certificate, err := pgp.GenerateRevocationCertificate(keyRing, []byte(testMailboxPassword), constants.RevocationReasonNoReason, "")
+	if err != nil {
+		t.Fatal("Expected no error while generating revocation certificate, got:", err)
+	}
+	rawCertificate, err := armor.Unarmor(certificate)
+	if err != nil {
+		t.Fatal("Expected no error while unarmoring certificate, got:", err)
+	}
+	p, err := packet.Read(bytes.NewReader(rawCertificate))
+	if err != nil {
+		t.Fatal("Expected no error while reading certificate, got:", err)
+	}
+	revocation := p.(*packet.Signature)
+	assert.Exactly(t, crypto.SHA512, revocation.Hash)
+	assert.NoError(t, keyRing.GetEntities()[0].PrimaryKey.VerifyRevocationSignature(revocation))
+
+	if err = keyRing.AddUserID("Second", "", "second@example.com", []byte(testMailboxPassword)); err != nil {
+		t.Fatal("Expected no error while adding user ID, got:", err)
+	}
+	if err = keyRing.RevokeUserID("second@example.com", []byte(testMailboxPassword)); err != nil {
+		t.Fatal("Expected no error while revoking user ID, got:", err)
+	}
+	for _, sig := range keyRing.GetEntities()[0].Identities["Second <second@example.com>"].Signatures {
+		assert.Exactly(t, crypto.SHA512, sig.Hash)
+	}
+
+	if err = keyRing.AddEncryptionSubkey("x25519", 0, 0, []byte(testMailboxPassword)); err != nil {
+		t.Fatal("Expected no error while adding subkey, got:", err)
+	}
+	subkeys := keyRing.GetEntities()[0].Subkeys
+	assert.Exactly(t, crypto.SHA512, subkeys[len(subkeys)-1].Sig.Hash)
+}
+
+func TestSignCleartext(t *testing.T) {
+	text := "Release notes\n- fixed a bug   \nFrom the start"
+
+	signed, err := signingKeyRing.SignCleartext(text)
+	if err != nil {
+		t.Fatal("Expected no error while signing cleartext, got:", err)
+	}
+
+	rTest := regexp.MustCompile("(?s)^-----BEGIN PGP SIGNED MESSAGE-----\nHash: SHA256\n\n.*\n- - fixed a bug.*-----END PGP SIGNATURE-----$")
+	assert.Regexp(t, rTest, signed)
+
+	verified, err := signingKeyRing.VerifyCleartext(signed, testTime)
+	if err != nil {
+		t.Fatal("Expected no error while verifying cleartext, got:", err)
+	}
+	assert.Exactly(t, "Release notes\n- fixed a bug\nFrom the start", verified)
+
+	tampered := strings.Replace(signed, "fixed a bug", "fixed two bugs", 1)
+	_, err = signingKeyRing.VerifyCleartext(tampered, testTime)
+	assert.Error(t, err)
+
+	_, err = signingKeyRing.VerifyCleartext(signedPlainText, testTime)
+	assert.EqualError(t, err, "gopenpgp: not a cleartext signed message")
+}
+
+func TestVerifyGnuPGCleartext(t *testing.T) {
+	verified, err := signingKeyRing.VerifyCleartext(readTestFile("cleartext_gnupgMessage", false), testTime)
+	if err != nil {
+		t.Fatal("Expected no error while verifying GnuPG cleartext, got:", err)
+	}
+	assert.Exactly(t, "Release notes\n- fixed a bug\nFrom the start\n-----BEGIN not armor", verified)
+}
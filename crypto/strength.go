@@ -0,0 +1,98 @@
+package crypto
+
+import (
+	"crypto"
+	"fmt"
+
+	"github.com/ProtonMail/gopenpgp/constants"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// minKeyBits is the minimum size of RSA, DSA and ElGamal keys accepted by
+// CheckKeyStrength.
+const minKeyBits = 2048
+
+// weakHashes are the hash algorithms that aren't accepted for self-signatures.
+var weakHashes = map[crypto.Hash]bool{
+	crypto.MD5:       true,
+	crypto.SHA1:      true,
+	crypto.RIPEMD160: true,
+}
+
+// CheckKeyStrength checks that the armored public or private key meets the
+// minimum security requirements: RSA, DSA and ElGamal keys must be at least
+// 2048 bits long, and self-signatures must not only use MD5, SHA-1 or
+// RIPEMD-160. If not, a CryptoError with code constants.ErrorCodeWeakKey is
+// returned, whose message describes the weakness.
+func (pgp *GopenPGP) CheckKeyStrength(armoredKey string) error {
+	kr, err := pgp.BuildKeyRingArmored(armoredKey)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range kr.entities {
+		if err := checkEntityStrength(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkEntityStrength(e *openpgp.Entity) error {
+	if err := checkKeySize(e.PrimaryKey); err != nil {
+		return newWeakKeyError(e.PrimaryKey.KeyId, err.Error())
+	}
+
+	strongSelfSig := false
+	for _, ident := range e.Identities {
+		if ident.SelfSignature != nil && !weakHashes[ident.SelfSignature.Hash] {
+			strongSelfSig = true
+		}
+	}
+	if !strongSelfSig {
+		return newWeakKeyError(e.PrimaryKey.KeyId, "no self-signature uses a strong hash algorithm")
+	}
+
+	for _, subKey := range e.Subkeys {
+		if err := checkKeySize(subKey.PublicKey); err != nil {
+			return newWeakKeyError(subKey.PublicKey.KeyId, err.Error())
+		}
+		if weakHashes[subKey.Sig.Hash] {
+			return newWeakKeyError(subKey.PublicKey.KeyId,
+				fmt.Sprintf("binding signature uses weak hash algorithm %s", hashAlgos[subKey.Sig.Hash]))
+		}
+	}
+	return nil
+}
+
+// checkKeySize returns an error if pub is a finite field key shorter than
+// minKeyBits. Elliptic curve keys are accepted as is, as all supported curves
+// are strong enough.
+func checkKeySize(pub *packet.PublicKey) error {
+	var name string
+	switch pub.PubKeyAlgo {
+	case packet.PubKeyAlgoRSA, packet.PubKeyAlgoRSAEncryptOnly, packet.PubKeyAlgoRSASignOnly:
+		name = "RSA"
+	case packet.PubKeyAlgoDSA:
+		name = "DSA"
+	case packet.PubKeyAlgoElGamal:
+		name = "ElGamal"
+	default:
+		return nil
+	}
+
+	bits, err := pub.BitLength()
+	if err != nil {
+		return err
+	}
+	if bits < minKeyBits {
+		return fmt.Errorf("%s key is %d bits long, expected at least %d", name, bits, minKeyBits)
+	}
+	return nil
+}
+
+func newWeakKeyError(keyID uint64, reason string) *CryptoError {
+	return newCryptoError(constants.ErrorCodeWeakKey, fmt.Sprintf("gopenpgp: key %x is too weak: %s", keyID, reason))
+}
@@ -0,0 +1,152 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+	xrsa "golang.org/x/crypto/rsa"
+)
+
+const publicSubkeyTag = 14
+
+// AddEncryptionSubkey generates a new encryption subkey of the given keyType
+// ("rsa" or "x25519") and binds it to the primary key of the first key of
+// this KeyRing. If keyType is "rsa", bits is the RSA bitsize of the subkey. If
+// expirySeconds is not 0, the subkey expires that many seconds after its
+// creation. The primary key is unlocked with passphrase if needed, and the new
+// subkey is protected with passphrase if the primary key is.
+func (kr *KeyRing) AddEncryptionSubkey(keyType string, bits int, expirySeconds uint32, passphrase []byte) error {
+	if len(kr.entities) == 0 {
+		return errors.New("gopenpgp: cannot add subkey, no private key available")
+	}
+	e := kr.entities[0]
+	primary, err := getUnlockedPrimaryKey(e, passphrase)
+	if err != nil {
+		return err
+	}
+
+	// An unlocked primary key still has its locked copy if it is protected
+	locked, isUnlocked := kr.getLockedKey(e.PrivateKey)
+	if isUnlocked {
+		if err = locked.Decrypt(passphrase); err != nil {
+			return fmt.Errorf("gopenpgp: cannot unlock key %x: %v", e.PrimaryKey.KeyId, err)
+		}
+	}
+
+	config := &packet.Config{Time: pgp.getTimeGenerator(), DefaultHash: pgp.getSignatureHash()}
+	pub, priv, err := newEncryptionSubkey(keyType, bits, config)
+	if err != nil {
+		return err
+	}
+	pub.IsSubkey = true
+	priv.IsSubkey = true
+
+	sig := &packet.Signature{
+		CreationTime:              config.Now(),
+		SigType:                   packet.SigTypeSubkeyBinding,
+		PubKeyAlgo:                e.PrimaryKey.PubKeyAlgo,
+		Hash:                      config.Hash(),
+		FlagsValid:                true,
+		FlagEncryptStorage:        true,
+		FlagEncryptCommunications: true,
+		IssuerKeyId:               &e.PrimaryKey.KeyId,
+	}
+	if expirySeconds != 0 {
+		sig.KeyLifetimeSecs = &expirySeconds
+	}
+	if err = sig.SignKey(pub, primary, config); err != nil {
+		return fmt.Errorf("gopenpgp: cannot sign subkey: %v", err)
+	}
+
+	switch {
+	case e.PrivateKey.Encrypted:
+		if err = priv.Encrypt(passphrase); err != nil {
+			return fmt.Errorf("gopenpgp: cannot encrypt subkey: %v", err)
+		}
+	case isUnlocked:
+		lockedSubkey := *priv
+		if err = lockedSubkey.Encrypt(passphrase); err != nil {
+			return fmt.Errorf("gopenpgp: cannot encrypt subkey: %v", err)
+		}
+		kr.addLockedKey(priv, lockedSubkey)
+	}
+
+	e.Subkeys = append(e.Subkeys, openpgp.Subkey{PublicKey: pub, PrivateKey: priv, Sig: sig})
+	return nil
+}
+
+// newEncryptionSubkey generates an unencrypted key pair of the given keyType
+// that can be used for encryption.
+func newEncryptionSubkey(
+	keyType string, bits int, config *packet.Config,
+) (*packet.PublicKey, *packet.PrivateKey, error) {
+	now := config.Now()
+	switch keyType {
+	case "rsa":
+		key, err := xrsa.GenerateKey(config.Random(), bits)
+		if err != nil {
+			return nil, nil, err
+		}
+		return packet.NewRSAPublicKey(now, &key.PublicKey), packet.NewRSAPrivateKey(now, key), nil
+	case "x25519":
+		// The crypto library only generates X25519 keys as part of an entity
+		entity, err := openpgp.NewEntity("", "", "", &packet.Config{
+			Algorithm: packet.PubKeyAlgoEdDSA,
+			Time:      func() time.Time { return now },
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		pub, err := fixMPIBitLength(entity.Subkeys[0].PublicKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		priv := entity.Subkeys[0].PrivateKey
+		priv.PublicKey = *pub
+		return pub, priv, nil
+	default:
+		return nil, nil, errors.New("gopenpgp: unsupported key type: " + keyType)
+	}
+}
+
+// fixMPIBitLength returns a copy of the ECDH public key pub whose point has its
+// actual bit length. The crypto library encodes the bit length of X25519
+// points as a multiple of 8, which other implementations reject when checking
+// the subkey binding signature.
+func fixMPIBitLength(pub *packet.PublicKey) (*packet.PublicKey, error) {
+	body, err := serializePublicKeyBody(pub)
+	if err != nil {
+		return nil, err
+	}
+
+	// Version, creation time, algorithm and curve OID precede the point
+	offset := 7 + int(body[6])
+	if len(body) < offset+2 {
+		return nil, errors.New("gopenpgp: cannot serialize public key")
+	}
+	byteLength := (int(body[offset])<<8 | int(body[offset+1]) + 7) / 8
+	if len(body) < offset+2+byteLength {
+		return nil, errors.New("gopenpgp: cannot serialize public key")
+	}
+	bitLength := new(big.Int).SetBytes(body[offset+2 : offset+2+byteLength]).BitLen()
+	body[offset] = byte(bitLength >> 8)
+	body[offset+1] = byte(bitLength)
+
+	var serialized bytes.Buffer
+	writePacketHeader(&serialized, publicSubkeyTag, len(body))
+	serialized.Write(body)
+	p, err := packet.Read(&serialized)
+	if err != nil {
+		return nil, err
+	}
+	fixed, ok := p.(*packet.PublicKey)
+	if !ok {
+		return nil, errors.New("gopenpgp: cannot serialize public key")
+	}
+	return fixed, nil
+}
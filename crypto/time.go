@@ -17,6 +17,13 @@ func (pgp *GopenPGP) UpdateTime(newTime int64) {
 	pgp.latestClientTime = time.Now()
 }
 
+// SetTimeFunc makes f the clock used for signature and key creation times,
+// encryption and key validity checks, in place of the cached server time.
+// Setting it to nil restores the default clock.
+func (pgp *GopenPGP) SetTimeFunc(f func() time.Time) {
+	pgp.timeFunc = f
+}
+
 // GetTimeUnix gets latest cached time
 func (pgp *GopenPGP) GetTimeUnix() int64 {
 	return pgp.getNow().Unix()
@@ -28,6 +35,10 @@ func (pgp *GopenPGP) GetTime() time.Time {
 }
 
 func (pgp *GopenPGP) getNow() time.Time {
+	if pgp.timeFunc != nil {
+		return pgp.timeFunc()
+	}
+
 	if pgp.latestServerTime > 0 && !pgp.latestClientTime.IsZero() {
 		// Until is monotonic, it uses a monotonic clock in this case instead of the wall clock
 		extrapolate := int64(time.Until(pgp.latestClientTime).Seconds())
@@ -0,0 +1,90 @@
+package crypto
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/gopenpgp/constants"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// VerifyUserIDBinding checks that the armored key binds a user ID with the
+// given email at time at, given as a Unix timestamp: the user ID must have a
+// self-signature made before at that is still valid, the key must not be
+// expired, and neither the key nor the user ID may have been revoked before at.
+// If several user IDs share the email, one valid binding is enough. The
+// returned CryptoError tells why the binding isn't valid.
+func (pgp *GopenPGP) VerifyUserIDBinding(armoredKey string, email string, at int64) error {
+	kr, err := pgp.BuildKeyRingArmored(armoredKey)
+	if err != nil {
+		return err
+	}
+
+	now := time.Unix(at, 0)
+	var bindingErr error
+	for _, e := range kr.entities {
+		for _, ident := range e.Identities {
+			if !strings.EqualFold(ident.UserId.Email, email) {
+				continue
+			}
+			if bindingErr = checkUserIDBinding(e, ident, now); bindingErr == nil {
+				return nil
+			}
+		}
+	}
+
+	if bindingErr == nil {
+		return fmt.Errorf("gopenpgp: key has no user ID with email %s", email)
+	}
+	return bindingErr
+}
+
+// checkUserIDBinding checks the binding of ident to e at now, see
+// VerifyUserIDBinding.
+func checkUserIDBinding(e *openpgp.Entity, ident *openpgp.Identity, now time.Time) error {
+	for _, revocation := range e.Revocations {
+		if !revocation.CreationTime.After(now) && e.PrimaryKey.VerifyRevocationSignature(revocation) == nil {
+			return newCryptoError(constants.ErrorCodeKeyRevoked,
+				fmt.Sprintf("gopenpgp: key %x is revoked", e.PrimaryKey.KeyId))
+		}
+	}
+
+	// The parser only keeps the latest self-signature, look for the one that
+	// was current at now
+	var selfSig *packet.Signature
+	for _, sig := range ident.Signatures {
+		if !isSelfCertification(e, sig) || sig.CreationTime.After(now) {
+			continue
+		}
+		if selfSig == nil || sig.CreationTime.After(selfSig.CreationTime) {
+			selfSig = sig
+		}
+	}
+	if selfSig == nil {
+		return newCryptoError(constants.ErrorCodeBadSignature,
+			fmt.Sprintf("gopenpgp: user ID %q has no self-signature made before %d", ident.Name, now.Unix()))
+	}
+	if selfSig.SigExpired(now) {
+		return newCryptoError(constants.ErrorCodeKeyExpired,
+			fmt.Sprintf("gopenpgp: self-signature of user ID %q is expired", ident.Name))
+	}
+	if e.PrimaryKey.KeyExpired(selfSig, now) {
+		return newCryptoError(constants.ErrorCodeKeyExpired,
+			fmt.Sprintf("gopenpgp: key %x is expired", e.PrimaryKey.KeyId))
+	}
+
+	for _, sig := range ident.Signatures {
+		if sig.SigType != sigTypeCertificationRevocation || sig.IssuerKeyId == nil ||
+			*sig.IssuerKeyId != e.PrimaryKey.KeyId || sig.CreationTime.After(now) {
+			continue
+		}
+		if e.PrimaryKey.VerifyUserIdSignature(ident.Name, e.PrimaryKey, sig) == nil {
+			return newCryptoError(constants.ErrorCodeKeyRevoked,
+				fmt.Sprintf("gopenpgp: user ID %q is revoked", ident.Name))
+		}
+	}
+	return nil
+}
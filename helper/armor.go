@@ -0,0 +1,26 @@
+package helper
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/ProtonMail/gopenpgp/armor"
+)
+
+// Armor armors the binary OpenPGP data b, choosing the block type from its
+// first packet. It fails on empty data, on data that is already armored and on
+// data that doesn't start with a key, message or signature packet.
+func Armor(b []byte) (string, error) {
+	if len(b) == 0 {
+		return "", errors.New("gopenpgp: cannot armor empty data")
+	}
+	if bytes.HasPrefix(bytes.TrimLeft(b, " \t\r\n"), []byte("-----BEGIN ")) {
+		return "", errors.New("gopenpgp: data is already armored")
+	}
+
+	armorType, err := armor.GetArmorType(b)
+	if err != nil {
+		return "", err
+	}
+	return armor.ArmorWithType(b, armorType)
+}
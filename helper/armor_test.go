@@ -0,0 +1,35 @@
+package helper
+
+import (
+	"testing"
+
+	"github.com/ProtonMail/gopenpgp/armor"
+	"github.com/ProtonMail/gopenpgp/constants"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArmor(t *testing.T) {
+	key := serializeTestEntity(t, "alice@example.com")
+	armored, err := Armor(key)
+	if err != nil {
+		t.Fatal("Expected no error while armoring key, got:", err)
+	}
+	assert.Contains(t, armored, "-----BEGIN "+constants.PublicKeyHeader+"-----")
+
+	data, err := armor.Unarmor(armored)
+	if err != nil {
+		t.Fatal("Expected no error while unarmoring, got:", err)
+	}
+	assert.Exactly(t, key, data)
+
+	armored, err = Armor([]byte{0xc2, 0x01, 0x04})
+	if err != nil {
+		t.Fatal("Expected no error while armoring signature, got:", err)
+	}
+	assert.Contains(t, armored, "-----BEGIN "+constants.PGPSignatureHeader+"-----")
+
+	for _, invalid := range [][]byte{nil, {}, {0xcd, 0x00}, []byte("plain text"), []byte(armored)} {
+		_, err := Armor(invalid)
+		assert.Error(t, err)
+	}
+}
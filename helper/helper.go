@@ -0,0 +1,39 @@
+// Package helper contains convenience functions built on top of the crypto
+// package, such as fetching keys from the network.
+package helper
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/ProtonMail/gopenpgp/armor"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+var errNoMatchingKey = errors.New("gopenpgp: no matching key found")
+
+// filterKeys parses the binary keys in data and returns the ones for which
+// match returns true, armored. It returns errNoMatchingKey if there are none.
+func filterKeys(data []byte, match func(*openpgp.Entity) bool) (string, error) {
+	entities, err := openpgp.ReadKeyRing(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("gopenpgp: cannot read fetched key: %v", err)
+	}
+
+	var b bytes.Buffer
+	for _, e := range entities {
+		if !match(e) {
+			continue
+		}
+		if err := e.Serialize(&b); err != nil {
+			return "", err
+		}
+	}
+	if b.Len() == 0 {
+		return "", errNoMatchingKey
+	}
+
+	return armor.ArmorKey(b.Bytes())
+}
@@ -0,0 +1,146 @@
+package helper
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ProtonMail/gopenpgp/armor"
+	"github.com/ProtonMail/gopenpgp/constants"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// hkpPort is the default port of plain HKP servers.
+const hkpPort = "11371"
+
+// HKPFetch looks up a public key on the HKP keyserver at serverURL and returns
+// it armored. fingerprint is either a full fingerprint, a 16 hex digit key ID
+// or an 8 hex digit short key ID, with or without a 0x prefix. Only keys whose
+// primary key or a subkey match it are returned.
+func HKPFetch(ctx context.Context, serverURL, fingerprint string) (string, error) {
+	base, err := getHKPBaseURL(serverURL)
+	if err != nil {
+		return "", err
+	}
+
+	id, err := normalizeKeyID(fingerprint)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{"op": {"get"}, "options": {"mr"}, "search": {"0x" + id}}
+	data, err := fetchKey(ctx, base+"/pks/lookup?"+query.Encode())
+	if err != nil {
+		return "", fmt.Errorf("gopenpgp: cannot fetch key %s from keyserver: %v", id, err)
+	}
+
+	armored, err := filterKeys(data, func(e *openpgp.Entity) bool { return matchesKeyID(e, id) })
+	if err == errNoMatchingKey {
+		return "", fmt.Errorf("gopenpgp: keyserver returned no key matching %s", id)
+	}
+	return armored, err
+}
+
+// HKPSubmit uploads armoredKey to the HKP keyserver at serverURL. Private keys
+// are refused.
+func HKPSubmit(ctx context.Context, serverURL, armoredKey string) error {
+	base, err := getHKPBaseURL(serverURL)
+	if err != nil {
+		return err
+	}
+
+	armorType, err := armor.GetArmorType([]byte(armoredKey))
+	if err != nil {
+		return err
+	}
+	if armorType != constants.PublicKeyHeader {
+		return fmt.Errorf("gopenpgp: cannot submit %s to keyserver, expected a public key", armorType)
+	}
+
+	form := url.Values{"keytext": {armoredKey}}
+	req, err := http.NewRequest(http.MethodPost, base+"/pks/add", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("gopenpgp: cannot submit key to keyserver: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("gopenpgp: keyserver rejected key with status %s: %s",
+			resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// getHKPBaseURL converts serverURL to an HTTP(S) URL. hkp:// URLs use the
+// default HKP port unless another one is given, and hkps:// URLs use HTTPS.
+func getHKPBaseURL(serverURL string) (string, error) {
+	u, err := url.Parse(serverURL)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("gopenpgp: invalid keyserver URL %q", serverURL)
+	}
+
+	switch u.Scheme {
+	case "hkp":
+		u.Scheme = "http"
+		if u.Port() == "" {
+			u.Host += ":" + hkpPort
+		}
+	case "hkps":
+		u.Scheme = "https"
+	case "http", "https":
+	default:
+		return "", fmt.Errorf("gopenpgp: unsupported keyserver URL scheme %q", u.Scheme)
+	}
+
+	return strings.TrimSuffix(u.String(), "/"), nil
+}
+
+// normalizeKeyID strips an optional 0x prefix and spaces from fingerprint,
+// checks that it is a key ID or a fingerprint and returns it in lower case.
+func normalizeKeyID(fingerprint string) (string, error) {
+	id := strings.ToLower(strings.Replace(fingerprint, " ", "", -1))
+	id = strings.TrimPrefix(id, "0x")
+
+	switch len(id) {
+	case 8, 16, 40:
+	default:
+		return "", errors.New("gopenpgp: expected a fingerprint or key ID")
+	}
+	if _, err := hex.DecodeString(id); err != nil {
+		return "", errors.New("gopenpgp: expected a fingerprint or key ID")
+	}
+	return id, nil
+}
+
+// matchesKeyID returns whether the primary key or a subkey of e has the key ID
+// or fingerprint id, as returned by normalizeKeyID.
+func matchesKeyID(e *openpgp.Entity, id string) bool {
+	keys := []*packet.PublicKey{e.PrimaryKey}
+	for _, subkey := range e.Subkeys {
+		keys = append(keys, subkey.PublicKey)
+	}
+
+	// Key IDs are the low 64 bits of v4 fingerprints
+	for _, key := range keys {
+		fingerprint := hex.EncodeToString(key.Fingerprint[:])
+		if strings.HasSuffix(fingerprint, id) {
+			return true
+		}
+	}
+	return false
+}
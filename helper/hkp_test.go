@@ -0,0 +1,130 @@
+package helper
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/gopenpgp/armor"
+	"github.com/stretchr/testify/assert"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+func TestHKPBaseURL(t *testing.T) {
+	urls := map[string]string{
+		"hkp://keys.example.com":        "http://keys.example.com:11371",
+		"hkp://keys.example.com:80/":    "http://keys.example.com:80",
+		"hkps://keys.example.com":       "https://keys.example.com",
+		"https://keys.example.com/hkp/": "https://keys.example.com/hkp",
+	}
+	for serverURL, expected := range urls {
+		base, err := getHKPBaseURL(serverURL)
+		if err != nil {
+			t.Fatal("Expected no error while parsing keyserver URL, got:", err)
+		}
+		assert.Exactly(t, expected, base)
+	}
+
+	for _, invalid := range []string{"", "keys.example.com", "ftp://keys.example.com"} {
+		_, err := getHKPBaseURL(invalid)
+		assert.Error(t, err)
+	}
+}
+
+func TestHKPFetch(t *testing.T) {
+	key := serializeTestEntity(t, "alice@example.com")
+	entities, err := openpgp.ReadKeyRing(bytes.NewReader(key))
+	if err != nil {
+		t.Fatal("Expected no error while reading key, got:", err)
+	}
+	fingerprint := hex.EncodeToString(entities[0].PrimaryKey.Fingerprint[:])
+	subkeyID := hex.EncodeToString(entities[0].Subkeys[0].PublicKey.Fingerprint[12:])
+
+	armored, err := armor.ArmorKey(key)
+	if err != nil {
+		t.Fatal("Expected no error while armoring key, got:", err)
+	}
+
+	var search string
+	newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/pks/lookup" || r.URL.Query().Get("op") != "get" {
+			http.NotFound(w, r)
+			return
+		}
+		search = r.URL.Query().Get("search")
+		w.Write([]byte(armored))
+	}))
+
+	for _, id := range []string{fingerprint, "0x" + fingerprint[24:], subkeyID} {
+		fetched, err := HKPFetch(context.Background(), "hkps://keys.example.com", id)
+		if err != nil {
+			t.Fatal("Expected no error while fetching key, got:", err)
+		}
+		assert.Exactly(t, "0x"+strings.TrimPrefix(id, "0x"), search)
+
+		data, err := armor.Unarmor(fetched)
+		if err != nil {
+			t.Fatal("Expected no error while unarmoring fetched key, got:", err)
+		}
+		assert.Exactly(t, key, data)
+	}
+
+	_, err = HKPFetch(context.Background(), "hkps://keys.example.com", "0123456789abcdef")
+	assert.Contains(t, err.Error(), "no key matching 0123456789abcdef")
+
+	_, err = HKPFetch(context.Background(), "hkps://keys.example.com", "not a key ID")
+	assert.Error(t, err)
+}
+
+func TestHKPSubmit(t *testing.T) {
+	armored, err := armor.ArmorKey(serializeTestEntity(t, "alice@example.com"))
+	if err != nil {
+		t.Fatal("Expected no error while armoring key, got:", err)
+	}
+
+	var submitted string
+	newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		form, _ := url.ParseQuery(string(body))
+		submitted = form.Get("keytext")
+		if r.URL.Path != "/pks/add" || r.Method != http.MethodPost {
+			http.Error(w, "key rejected", http.StatusBadRequest)
+		}
+	}))
+
+	if err := HKPSubmit(context.Background(), "hkps://keys.example.com", armored); err != nil {
+		t.Fatal("Expected no error while submitting key, got:", err)
+	}
+	assert.Exactly(t, armored, submitted)
+
+	err = HKPSubmit(context.Background(), "hkps://keys.example.com/other", armored)
+	assert.Contains(t, err.Error(), "key rejected")
+
+	privateKey, err := armor.ArmorWithType([]byte{0xc5, 0x00}, "PGP PRIVATE KEY BLOCK")
+	if err != nil {
+		t.Fatal("Expected no error while armoring, got:", err)
+	}
+	err = HKPSubmit(context.Background(), "hkps://keys.example.com", privateKey)
+	assert.Contains(t, err.Error(), "expected a public key")
+}
+
+func TestHKPTimeout(t *testing.T) {
+	newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := HKPFetch(ctx, "hkps://keys.example.com", "0123456789abcdef")
+	assert.Contains(t, err.Error(), context.DeadlineExceeded.Error())
+}
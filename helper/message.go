@@ -0,0 +1,161 @@
+package helper
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+
+	"github.com/ProtonMail/gopenpgp/armor"
+	"github.com/ProtonMail/gopenpgp/constants"
+	"github.com/ProtonMail/gopenpgp/crypto"
+)
+
+// EncryptMessageArmored encrypts plaintext to the armored publicKey and returns
+// the armored message.
+func EncryptMessageArmored(publicKey, plaintext string) (string, error) {
+	pgp := crypto.GetGopenPGP()
+
+	publicKeyRing, err := pgp.BuildKeyRingArmored(publicKey)
+	if err != nil {
+		return "", err
+	}
+	return pgp.EncryptMessage(plaintext, publicKeyRing, nil, "", false)
+}
+
+// EncryptMessageBinary is like EncryptMessageArmored, but returns the binary
+// message.
+func EncryptMessageBinary(publicKey string, plaintext []byte) ([]byte, error) {
+	pgp := crypto.GetGopenPGP()
+
+	publicKeyRing, err := pgp.BuildKeyRingArmored(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return pgp.EncryptMessageBinary(plaintext, publicKeyRing, nil, "")
+}
+
+// EncryptMessageArmoredWithHeaders is like EncryptMessageArmored, but armors
+// the message with headers instead of the default Version and Comment headers.
+// An empty headers map produces no header lines.
+func EncryptMessageArmoredWithHeaders(publicKey, plaintext string, headers map[string]string) (string, error) {
+	encrypted, err := EncryptMessageBinary(publicKey, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	return armor.ArmorWithTypeAndHeaders(encrypted, constants.PGPMessageHeader, headers)
+}
+
+// DecryptMessageArmored decrypts the armored ciphertext with the armored
+// privateKey, unlocked with passphrase. The signature of the message, if any,
+// is not verified, see DecryptVerifyMessageArmored.
+func DecryptMessageArmored(privateKey, passphrase, ciphertext string) (string, error) {
+	privateKeyRing, err := unlockArmoredKey(privateKey, passphrase)
+	if err != nil {
+		return "", err
+	}
+	defer privateKeyRing.Lock()
+
+	return crypto.GetGopenPGP().DecryptMessage(ciphertext, privateKeyRing, passphrase)
+}
+
+// DecryptMessageBinary is like DecryptMessageArmored, but takes the binary
+// ciphertext.
+func DecryptMessageBinary(privateKey, passphrase string, ciphertext []byte) ([]byte, error) {
+	privateKeyRing, err := unlockArmoredKey(privateKey, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer privateKeyRing.Lock()
+
+	return crypto.GetGopenPGP().DecryptMessageBinary(ciphertext, privateKeyRing, passphrase)
+}
+
+// SignClearText signs text with the armored privateKey, unlocked with
+// passphrase, and returns the cleartext signed message.
+func SignClearText(privateKey, passphrase, text string) (string, error) {
+	privateKeyRing, err := unlockArmoredKey(privateKey, passphrase)
+	if err != nil {
+		return "", err
+	}
+	defer privateKeyRing.Lock()
+
+	return privateKeyRing.SignCleartext(text)
+}
+
+// unlockArmoredKey reads the armored privateKey and unlocks it with
+// passphrase. The caller must lock the returned keyring once done with it, to
+// discard the decrypted key material.
+func unlockArmoredKey(privateKey, passphrase string) (*crypto.KeyRing, error) {
+	privateKeyRing, err := crypto.GetGopenPGP().BuildKeyRingArmored(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	if err = privateKeyRing.Unlock([]byte(passphrase)); err != nil {
+		return nil, err
+	}
+	return privateKeyRing, nil
+}
+
+// ExplicitVerifyMessage is a decrypted message with the result of the
+// verification of its signature, in a single struct that can be returned
+// through the mobile bindings.
+type ExplicitVerifyMessage struct {
+	// Message is the decrypted plaintext.
+	Message []byte
+	// SignatureVerificationError is nil if the message is validly signed by
+	// the verifier key. Otherwise its Code is constants.ErrorCodeNotSigned or
+	// constants.ErrorCodeBadSignature.
+	SignatureVerificationError *crypto.CryptoError
+}
+
+// DecryptVerifyMessageArmored decrypts the armored ciphertext with the armored
+// privateKey, unlocked with passphrase, and verifies its signature with the
+// armored publicKey at the current time. An error is only returned if the
+// message can't be decrypted; an invalid or missing signature is reported in
+// the SignatureVerificationError of the result instead.
+func DecryptVerifyMessageArmored(
+	publicKey, privateKey, passphrase, ciphertext string,
+) (*ExplicitVerifyMessage, error) {
+	encrypted, err := armor.Unarmor(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	return DecryptVerifyMessageBinary(publicKey, privateKey, passphrase, encrypted)
+}
+
+// DecryptVerifyMessageBinary is like DecryptVerifyMessageArmored, but takes the
+// binary ciphertext.
+func DecryptVerifyMessageBinary(
+	publicKey, privateKey, passphrase string, ciphertext []byte,
+) (*ExplicitVerifyMessage, error) {
+	pgp := crypto.GetGopenPGP()
+
+	verifyKey, err := pgp.BuildKeyRingArmored(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	privateKeyRing, err := unlockArmoredKey(privateKey, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer privateKeyRing.Lock()
+
+	body, verify, err := pgp.DecryptStream(bytes.NewReader(ciphertext), privateKeyRing, verifyKey, pgp.GetTimeUnix())
+	if err != nil {
+		return nil, err
+	}
+	message, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &ExplicitVerifyMessage{Message: message}
+	if err = verify(); err != nil {
+		var cryptoErr *crypto.CryptoError
+		if !errors.As(err, &cryptoErr) {
+			return nil, err
+		}
+		out.SignatureVerificationError = cryptoErr
+	}
+	return out, nil
+}
@@ -0,0 +1,192 @@
+package helper
+
+import (
+	"testing"
+
+	"github.com/ProtonMail/gopenpgp/armor"
+	"github.com/ProtonMail/gopenpgp/constants"
+	"github.com/ProtonMail/gopenpgp/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+const testPassphrase = "passphrase"
+
+// generateTestKeys returns a new armored private key locked with
+// testPassphrase, and its armored public key.
+func generateTestKeys(t *testing.T, name string) (privateKey, publicKey string) {
+	pgp := crypto.GetGopenPGP()
+	privateKey, err := pgp.GenerateKey(name, "example.com", testPassphrase, "rsa", 1024)
+	if err != nil {
+		t.Fatal("Expected no error while generating key, got:", err)
+	}
+	publicKey, err = pgp.GetPublicKeyFromPrivate(privateKey)
+	if err != nil {
+		t.Fatal("Expected no error while extracting public key, got:", err)
+	}
+	return privateKey, publicKey
+}
+
+func TestMessageArmored(t *testing.T) {
+	privateKey, publicKey := generateTestKeys(t, "alice")
+
+	armored, err := EncryptMessageArmored(publicKey, "plain text")
+	if err != nil {
+		t.Fatal("Expected no error while encrypting, got:", err)
+	}
+	assert.Contains(t, armored, "-----BEGIN "+constants.PGPMessageHeader+"-----")
+
+	decrypted, err := DecryptMessageArmored(privateKey, testPassphrase, armored)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting, got:", err)
+	}
+	assert.Exactly(t, "plain text", decrypted)
+
+	_, err = DecryptMessageArmored(privateKey, "wrong", armored)
+	assert.Error(t, err)
+	_, err = EncryptMessageArmored("not a key", "plain text")
+	assert.Error(t, err)
+}
+
+func TestEncryptMessageArmoredWithHeaders(t *testing.T) {
+	privateKey, publicKey := generateTestKeys(t, "alice")
+
+	armored, err := EncryptMessageArmoredWithHeaders(publicKey, "plain text", map[string]string{"Comment": "for alice"})
+	if err != nil {
+		t.Fatal("Expected no error while encrypting, got:", err)
+	}
+	assert.Contains(t, armored, "\nComment: for alice\n")
+	assert.NotContains(t, armored, "Version:")
+
+	decrypted, err := DecryptMessageArmored(privateKey, testPassphrase, armored)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting, got:", err)
+	}
+	assert.Exactly(t, "plain text", decrypted)
+
+	armored, err = EncryptMessageArmoredWithHeaders(publicKey, "plain text", nil)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting, got:", err)
+	}
+	assert.Regexp(t, "^-----BEGIN PGP MESSAGE-----\n\n", armored)
+}
+
+func TestMessageBinary(t *testing.T) {
+	privateKey, publicKey := generateTestKeys(t, "alice")
+	plaintext := []byte{0x00, 0x01, 0xfe, 0xff}
+
+	encrypted, err := EncryptMessageBinary(publicKey, plaintext)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting, got:", err)
+	}
+	assert.Exactly(t, []string{"Public-Key Encrypted Session Key", "Sym. Encrypted Integrity Protected Data"},
+		describeTestPackets(t, encrypted))
+
+	decrypted, err := DecryptMessageBinary(privateKey, testPassphrase, encrypted)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting, got:", err)
+	}
+	assert.Exactly(t, plaintext, decrypted)
+
+	armored, err := armor.ArmorWithType(encrypted, constants.PGPMessageHeader)
+	if err != nil {
+		t.Fatal("Expected no error while armoring, got:", err)
+	}
+	decryptedArmored, err := DecryptMessageArmored(privateKey, testPassphrase, armored)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting, got:", err)
+	}
+	assert.Exactly(t, string(plaintext), decryptedArmored)
+
+	verified, err := DecryptVerifyMessageBinary(publicKey, privateKey, testPassphrase, encrypted)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting, got:", err)
+	}
+	assert.Exactly(t, plaintext, verified.Message)
+	assert.Exactly(t, constants.ErrorCodeNotSigned, verified.SignatureVerificationError.Code)
+
+	_, err = DecryptMessageBinary(privateKey, "wrong", encrypted)
+	assert.Error(t, err)
+}
+
+// describeTestPackets returns the names of the packets of the binary message.
+func describeTestPackets(t *testing.T, message []byte) []string {
+	descriptions, err := crypto.GetGopenPGP().DescribePackets(message)
+	if err != nil {
+		t.Fatal("Expected no error while reading packets, got:", err)
+	}
+	var names []string
+	for _, description := range descriptions {
+		names = append(names, description.Name)
+	}
+	return names
+}
+
+func TestSignClearText(t *testing.T) {
+	privateKey, publicKey := generateTestKeys(t, "alice")
+
+	signed, err := SignClearText(privateKey, testPassphrase, "signed text")
+	if err != nil {
+		t.Fatal("Expected no error while signing, got:", err)
+	}
+
+	pgp := crypto.GetGopenPGP()
+	publicKeyRing, err := pgp.BuildKeyRingArmored(publicKey)
+	if err != nil {
+		t.Fatal("Expected no error while reading key, got:", err)
+	}
+	text, err := publicKeyRing.VerifyCleartext(signed, pgp.GetTimeUnix())
+	if err != nil {
+		t.Fatal("Expected no error while verifying, got:", err)
+	}
+	assert.Exactly(t, "signed text", text)
+
+	_, err = SignClearText(privateKey, "wrong", "signed text")
+	assert.Error(t, err)
+}
+
+func TestDecryptVerifyMessageArmored(t *testing.T) {
+	pgp := crypto.GetGopenPGP()
+	privateKey, publicKey := generateTestKeys(t, "alice")
+	_, otherPublicKey := generateTestKeys(t, "bob")
+
+	privateKeyRing, err := pgp.BuildKeyRingArmored(privateKey)
+	if err != nil {
+		t.Fatal("Expected no error while reading key, got:", err)
+	}
+	publicKeyRing, err := pgp.BuildKeyRingArmored(publicKey)
+	if err != nil {
+		t.Fatal("Expected no error while reading key, got:", err)
+	}
+
+	signed, err := pgp.EncryptMessage("plain text", publicKeyRing, privateKeyRing, testPassphrase, false)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting, got:", err)
+	}
+	decrypted, err := DecryptVerifyMessageArmored(publicKey, privateKey, testPassphrase, signed)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting, got:", err)
+	}
+	assert.Exactly(t, []byte("plain text"), decrypted.Message)
+	assert.Nil(t, decrypted.SignatureVerificationError)
+
+	decrypted, err = DecryptVerifyMessageArmored(otherPublicKey, privateKey, testPassphrase, signed)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting, got:", err)
+	}
+	assert.Exactly(t, []byte("plain text"), decrypted.Message)
+	assert.Exactly(t, constants.ErrorCodeBadSignature, decrypted.SignatureVerificationError.Code)
+
+	unsigned, err := pgp.EncryptMessage("plain text", publicKeyRing, nil, "", false)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting, got:", err)
+	}
+	decrypted, err = DecryptVerifyMessageArmored(publicKey, privateKey, testPassphrase, unsigned)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting, got:", err)
+	}
+	assert.Exactly(t, []byte("plain text"), decrypted.Message)
+	assert.Exactly(t, constants.ErrorCodeNotSigned, decrypted.SignatureVerificationError.Code)
+
+	_, err = DecryptVerifyMessageArmored(publicKey, privateKey, "wrong", signed)
+	assert.Error(t, err)
+}
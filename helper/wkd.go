@@ -0,0 +1,136 @@
+package helper
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ProtonMail/gopenpgp/armor"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+// maxKeySize bounds the size of a key fetched from the network.
+const maxKeySize = 5 << 20
+
+// zBase32Alphabet is the human-oriented base-32 alphabet used by WKD.
+const zBase32Alphabet = "ybndrfg8ejkmcpqxot1uwisza345h769"
+
+// httpClient is the client used to fetch keys.
+var httpClient = http.DefaultClient
+
+// FetchKeyWKD looks up the public key of email in its domain's Web Key
+// Directory and returns it armored. The advanced method is tried first, then
+// the direct one. Only keys with a user ID matching email are returned.
+func FetchKeyWKD(ctx context.Context, email string) (string, error) {
+	advanced, direct, err := getWKDURLs(email)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := fetchKey(ctx, advanced)
+	if err != nil {
+		data, err = fetchKey(ctx, direct)
+		if err != nil {
+			return "", fmt.Errorf("gopenpgp: cannot fetch key for %s from WKD: %v", email, err)
+		}
+	}
+
+	return filterKeysByEmail(data, email)
+}
+
+// getWKDURLs returns the advanced and direct method URLs for email.
+func getWKDURLs(email string) (advanced, direct string, err error) {
+	at := strings.LastIndex(email, "@")
+	if at <= 0 || at == len(email)-1 {
+		return "", "", fmt.Errorf("gopenpgp: invalid email address %q", email)
+	}
+	localPart := email[:at]
+	domain := strings.ToLower(email[at+1:])
+
+	digest := sha1.Sum([]byte(strings.ToLower(localPart)))
+	hash := encodeZBase32(digest[:])
+	query := "?l=" + url.QueryEscape(localPart)
+
+	advanced = "https://openpgpkey." + domain + "/.well-known/openpgpkey/" + domain + "/hu/" + hash + query
+	direct = "https://" + domain + "/.well-known/openpgpkey/hu/" + hash + query
+	return advanced, direct, nil
+}
+
+// encodeZBase32 encodes data with the z-base-32 alphabet, without padding.
+func encodeZBase32(data []byte) string {
+	var out strings.Builder
+	var buffer, bits uint
+	for _, b := range data {
+		buffer = buffer<<8 | uint(b)
+		bits += 8
+		for bits >= 5 {
+			bits -= 5
+			out.WriteByte(zBase32Alphabet[(buffer>>bits)&0x1f])
+		}
+	}
+	if bits > 0 {
+		out.WriteByte(zBase32Alphabet[(buffer<<(5-bits))&0x1f])
+	}
+	return out.String()
+}
+
+// fetchKey downloads the key at keyURL and returns it unarmored.
+func fetchKey(ctx context.Context, keyURL string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, keyURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s from %s", resp.Status, req.URL.Host)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxKeySize))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, errors.New("empty response")
+	}
+
+	// WKD serves binary keys, but accept armored ones as well
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN ")) {
+		return armor.Unarmor(string(data))
+	}
+	return data, nil
+}
+
+// filterKeysByEmail parses the binary keys in data and returns the ones with a
+// user ID for email, armored.
+func filterKeysByEmail(data []byte, email string) (string, error) {
+	armored, err := filterKeys(data, func(e *openpgp.Entity) bool { return hasEmail(e, email) })
+	if err == errNoMatchingKey {
+		return "", fmt.Errorf("gopenpgp: fetched key has no user ID for %s", email)
+	}
+	return armored, err
+}
+
+// hasEmail returns whether e has a user ID with the given email address. The
+// comparison ignores case, which is what mail providers commonly do.
+func hasEmail(e *openpgp.Entity, email string) bool {
+	for _, ident := range e.Identities {
+		if ident.UserId != nil && strings.EqualFold(ident.UserId.Email, email) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package helper
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/gopenpgp/armor"
+	"github.com/stretchr/testify/assert"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+// newTestServer starts a TLS server for handler and routes every request made
+// through httpClient to it, whatever the host.
+func newTestServer(t *testing.T, handler http.Handler) {
+	server := httptest.NewTLSServer(handler)
+	transport := server.Client().Transport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, server.Listener.Addr().String())
+	}
+
+	oldClient := httpClient
+	httpClient = &http.Client{Transport: transport}
+	t.Cleanup(func() {
+		httpClient = oldClient
+		server.Close()
+	})
+}
+
+func serializeTestEntity(t *testing.T, email string) []byte {
+	entity, err := openpgp.NewEntity("Test", "", email, nil)
+	if err != nil {
+		t.Fatal("Expected no error while generating key, got:", err)
+	}
+	var b bytes.Buffer
+	if err := entity.Serialize(&b); err != nil {
+		t.Fatal("Expected no error while serializing key, got:", err)
+	}
+	return b.Bytes()
+}
+
+func TestWKDURLs(t *testing.T) {
+	advanced, direct, err := getWKDURLs("Joe.Doe@Example.ORG")
+	if err != nil {
+		t.Fatal("Expected no error while computing WKD URLs, got:", err)
+	}
+	assert.Exactly(t, "https://openpgpkey.example.org/.well-known/openpgpkey/example.org/hu/"+
+		"iy9q119eutrkn8s1mk4r39qejnbu3n5q?l=Joe.Doe", advanced)
+	assert.Exactly(t, "https://example.org/.well-known/openpgpkey/hu/iy9q119eutrkn8s1mk4r39qejnbu3n5q?l=Joe.Doe", direct)
+
+	for _, invalid := range []string{"", "joe", "@example.org", "joe@"} {
+		_, _, err = getWKDURLs(invalid)
+		assert.Error(t, err)
+	}
+}
+
+func TestFetchKeyWKD(t *testing.T) {
+	key := serializeTestEntity(t, "alice@example.com")
+	var requested []string
+	newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.Host)
+		// Only serve the direct method, forcing a fallback
+		if r.Host != "example.com" || !strings.HasPrefix(r.URL.Path, "/.well-known/openpgpkey/hu/") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(key)
+	}))
+
+	armored, err := FetchKeyWKD(context.Background(), "alice@example.com")
+	if err != nil {
+		t.Fatal("Expected no error while fetching key, got:", err)
+	}
+	assert.Exactly(t, []string{"openpgpkey.example.com", "example.com"}, requested)
+
+	data, err := armor.Unarmor(armored)
+	if err != nil {
+		t.Fatal("Expected no error while unarmoring fetched key, got:", err)
+	}
+	assert.Exactly(t, key, data)
+
+	_, err = FetchKeyWKD(context.Background(), "bob@example.com")
+	assert.Contains(t, err.Error(), "no user ID for bob@example.com")
+}
+
+func TestFetchKeyWKDNotFound(t *testing.T) {
+	newTestServer(t, http.NotFoundHandler())
+
+	_, err := FetchKeyWKD(context.Background(), "alice@example.com")
+	assert.Contains(t, err.Error(), "cannot fetch key for alice@example.com")
+}
@@ -3,6 +3,7 @@ package internal
 
 import (
 	"regexp"
+	"strings"
 
 	"github.com/ProtonMail/gopenpgp/constants"
 )
@@ -14,6 +15,12 @@ func TrimNewlines(input string) string {
 	return re.ReplaceAllString(input, "")
 }
 
+// CanonicalizeLineEndings converts all line endings of the input string to
+// CRLF, as required for text mode literal data.
+func CanonicalizeLineEndings(input string) string {
+	return strings.Replace(strings.Replace(input, "\r\n", "\n", -1), "\n", "\r\n", -1)
+}
+
 // CreationTimeOffset stores the amount of seconds that a signature may be
 // created in the future, to compensate for clock skew.
 const CreationTimeOffset = int64(60 * 60 * 24 * 2)
@@ -24,3 +24,44 @@ type DecryptSignedVerify struct {
 	//error message if verify failed
 	Message string
 }
+
+// LiteralMetadata contains the metadata of the literal data packet of a
+// message.
+type LiteralMetadata struct {
+	Filename string
+	IsBinary bool
+	ModTime  int64
+}
+
+// DecryptedWithMetadata contains a decrypted message and the metadata of its
+// literal data packet.
+type DecryptedWithMetadata struct {
+	Plaintext string
+	Metadata  *LiteralMetadata
+}
+
+// DecryptedSignerInfo contains a decrypted message and whether it was signed.
+// SignerKeyID is the key ID of the signer if WasSigned is true, even if the
+// signer's key is unknown.
+type DecryptedSignerInfo struct {
+	Plaintext   string
+	WasSigned   bool
+	SignerKeyID uint64
+}
+
+// PacketDescription describes an OpenPGP packet without its contents. Fields
+// that don't apply to the packet type are left empty.
+type PacketDescription struct {
+	Tag    int
+	Name   string
+	Length int
+	// KeyID is the ID of the key of key packets, of the recipient of encrypted
+	// session keys and of the issuer of signatures.
+	KeyID uint64
+	// Algorithm is the public key, cipher or compression algorithm.
+	Algorithm string
+	// Hash is the hash algorithm of signatures.
+	Hash string
+	// Filename is the file name of literal data packets.
+	Filename string
+}